@@ -11,16 +11,94 @@ package amd64
 import (
 	"runtime/goos"
 
+	"github.com/usbarmory/tamago/fault"
 	"github.com/usbarmory/tamago/internal/exception"
+	"github.com/usbarmory/tamago/internal/reg"
+)
+
+// Exception vectors
+// (Intel® 64 and IA-32 Architectures Software Developer’s Manual
+// Volume 3A - 6.15 Exception and Interrupt Reference).
+const (
+	DIVIDE_ERROR        = 0
+	DEBUG               = 1
+	BREAKPOINT          = 3
+	OVERFLOW            = 4
+	INVALID_OPCODE      = 6
+	DOUBLE_FAULT        = 8
+	INVALID_TSS         = 10
+	SEGMENT_NOT_PRESENT = 11
+	STACK_FAULT         = 12
+	GENERAL_PROTECTION  = 13
+	PAGE_FAULT          = 14
+	X87_FLOATING_POINT  = 16
+	ALIGNMENT_CHECK     = 17
+	MACHINE_CHECK       = 18
+	SIMD_FLOATING_POINT = 19
+	CONTROL_PROTECTION  = 21
+	VMM_COMMUNICATION   = 29
+	SECURITY            = 30
+)
+
+// Page fault error code instruction fetch flag
+const PF_ID = 1 << 4
+
+// ExceptionContext represents the processor state captured on exceptions.
+type ExceptionContext struct {
+	// Vector is the exception vector number.
+	Vector int
+
+	// R holds general purpose registers (RAX, RBX, RCX, RDX, RSI, RDI,
+	// RBP, RSP, R8-R15).
+	R     [16]uint64
+	IP    uint64
+	CS    uint64
+	Flags uint64
+	SS    uint64
+
+	// ErrorCode holds the exception error code, when applicable.
+	ErrorCode uint64
+	// CR2 holds the page fault linear address.
+	CR2 uint64
+
+	// stack linking information address, set by exception.s
+	frame uint64
+	// ISR address, set by exception.s
+	isr uint64
+	// interrupt stack frame address
+	iret uint64
+}
+
+const (
+	// maximum number of cores, indexed by initial APIC ID
+	maxCores = 256
+	// maximum exception nesting level, per core
+	excNesting = 2
 )
 
 var (
 	isr        uintptr
-	eip        uintptr
 	isThrowing bool
+
+	// per-core exception contexts, by nesting level
+	excContexts [maxCores][excNesting]ExceptionContext
+	// per-core exception nesting level
+	excLevel [maxCores]uint64
+
+	systemExceptionFn = systemException
 )
 
-func currentVectorNumber() (id int) {
+var registerNames = [...]string{
+	"rax", "rbx", "rcx", "rdx", "rsi", "rdi", "rbp", "rsp", "r8", "r9",
+	"r10", "r11", "r12", "r13", "r14", "r15", "rip", "cs", "rflags", "ss",
+	"error", "cr2",
+}
+
+func currentVectorNumber() int {
+	return vectorNumber(isr)
+}
+
+func vectorNumber(isr uintptr) (id int) {
 	id = int(isr - irqHandlerAddr)
 
 	if id >= 0 {
@@ -30,8 +108,111 @@ func currentVectorNumber() (id int) {
 	return
 }
 
-// DefaultExceptionHandler handles an exception by printing its vector and
-// processor mode before panicking.
+func hasErrorCode(id int) bool {
+	switch id {
+	case DOUBLE_FAULT, INVALID_TSS, SEGMENT_NOT_PRESENT, STACK_FAULT,
+		GENERAL_PROTECTION, PAGE_FAULT, ALIGNMENT_CHECK,
+		CONTROL_PROTECTION, VMM_COMMUNICATION, SECURITY:
+		return true
+	}
+
+	return false
+}
+
+func (ctx *ExceptionContext) load() {
+	ctx.Vector = vectorNumber(uintptr(ctx.isr))
+	ctx.ErrorCode = 0
+
+	// skip stack linking information (see irqHandler)
+	ctx.iret = ctx.frame + 8
+
+	if hasErrorCode(ctx.Vector) {
+		ctx.ErrorCode = reg.Read64(ctx.iret)
+		ctx.iret += 8
+	}
+
+	// AMD64 Architecture Programmer’s Manual
+	// Volume 2 - 8.9.3 Interrupt Stack Frame
+	ctx.IP = reg.Read64(ctx.iret)
+	ctx.CS = reg.Read64(ctx.iret + 8)
+	ctx.Flags = reg.Read64(ctx.iret + 16)
+	ctx.R[7] = reg.Read64(ctx.iret + 24)
+	ctx.SS = reg.Read64(ctx.iret + 32)
+}
+
+func (ctx *ExceptionContext) store() {
+	reg.Write64(ctx.iret, ctx.IP)
+	reg.Write64(ctx.iret+16, ctx.Flags)
+}
+
+// Class returns the exception class.
+func (ctx *ExceptionContext) Class() fault.Class {
+	switch ctx.Vector {
+	case DIVIDE_ERROR, OVERFLOW, X87_FLOATING_POINT, SIMD_FLOATING_POINT:
+		return fault.Arithmetic
+	case DEBUG, BREAKPOINT:
+		return fault.Breakpoint
+	case INVALID_OPCODE:
+		return fault.UndefinedInstruction
+	case PAGE_FAULT:
+		if ctx.ErrorCode&PF_ID != 0 {
+			return fault.InstructionFault
+		}
+
+		return fault.DataFault
+	case INVALID_TSS, SEGMENT_NOT_PRESENT, STACK_FAULT, GENERAL_PROTECTION:
+		return fault.DataFault
+	case ALIGNMENT_CHECK:
+		return fault.Alignment
+	case DOUBLE_FAULT, MACHINE_CHECK:
+		return fault.SystemError
+	}
+
+	return fault.Unknown
+}
+
+// ProgramCounter returns the exception program counter.
+func (ctx *ExceptionContext) ProgramCounter() uintptr {
+	return uintptr(ctx.IP)
+}
+
+// SetProgramCounter updates the program counter at which execution is
+// resumed.
+func (ctx *ExceptionContext) SetProgramCounter(pc uintptr) {
+	ctx.IP = uint64(pc)
+}
+
+// Address returns the faulting memory address for page faults.
+func (ctx *ExceptionContext) Address() uintptr {
+	if ctx.Vector == PAGE_FAULT {
+		return uintptr(ctx.CR2)
+	}
+
+	return 0
+}
+
+// Print prints the exception context registers.
+func (ctx *ExceptionContext) Print() {
+	var vals [len(registerNames)]uint64
+
+	copy(vals[:], ctx.R[:])
+	copy(vals[len(ctx.R):], []uint64{ctx.IP, ctx.CS, ctx.Flags, ctx.SS, ctx.ErrorCode, ctx.CR2})
+
+	print("exception: vector ", ctx.Vector, " (", ctx.Class().String(), ")\n")
+	exception.PrintRegisters(registerNames[:], vals[:], 16)
+}
+
+// currentContext returns the context of the exception being serviced on the
+// calling core.
+func currentContext() *ExceptionContext {
+	_, ebx, _, _ := cpuid(CPUID_INFO, 0)
+	core := ebx >> 24
+
+	return &excContexts[core][excLevel[core]-1]
+}
+
+// DefaultExceptionHandler handles an exception by printing its context before
+// panicking.
 func DefaultExceptionHandler() {
 	if isThrowing {
 		goos.Exit(1)
@@ -39,16 +220,30 @@ func DefaultExceptionHandler() {
 
 	isThrowing = true
 
-	print("exception: vector ", currentVectorNumber(), " \n")
-	exception.Throw(eip)
+	ctx := currentContext()
+	ctx.Print()
+	exception.Throw(uintptr(ctx.IP))
 }
 
 // SystemExceptionHandler allows to override the default exception handler
 // executed at any exception by the table returned by SystemVectorTable(),
 // which is used by default when initializing the CPU instance (e.g.
 // CPU.Init()).
+//
+// Handlers registered with fault.SetHandler() take precedence.
 var SystemExceptionHandler = DefaultExceptionHandler
 
+func systemException() {
+	ctx := currentContext()
+	ctx.load()
+
+	if !fault.Handle(ctx) {
+		SystemExceptionHandler()
+	}
+
+	ctx.store()
+}
+
 // EnableExceptions initializes handling of processor exceptions through
 // DefaultExceptionHandler().
 func (cpu *CPU) EnableExceptions() {
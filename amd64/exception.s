@@ -9,24 +9,113 @@
 #include "go_asm.h"
 #include "textflag.h"
 
+// EXCEPTION_LEVEL sets BX to the calling core initial APIC ID, DX to its
+// nesting level address and CX to its nesting level, AX is clobbered.
+#define EXCEPTION_LEVEL							\
+	MOVL	$1, AX							\
+	CPUID								\
+	SHRL	$24, BX							\
+	MOVQ	$·excLevel(SB), DX					\
+	LEAQ	(DX)(BX*8), DX						\
+	MOVQ	(DX), CX
+
+// EXCEPTION_CONTEXT sets AX to the exception context address for the core in
+// BX and nesting level in CX, BX is clobbered.
+#define EXCEPTION_CONTEXT						\
+	IMULQ	$const_excNesting, BX					\
+	ADDQ	CX, BX							\
+	IMULQ	$ExceptionContext__size, BX				\
+	MOVQ	$·excContexts(SB), AX					\
+	ADDQ	BX, AX
+
 TEXT ·handleException(SB),NOSPLIT|NOFRAME,$0
 	CLI
 
-	// find ISR offset from stack linking information (see irqHandler)
-	MOVQ	isr+(8*0)(SP), R12
-	SUBQ	$(const_callSize), R12
-	MOVQ	R12, ·isr(SB)
+	// save scratch registers
+	PUSHQ	AX
+	PUSHQ	BX
+	PUSHQ	CX
+	PUSHQ	DX
+
+	// increment nesting level, halt when exceeded
+	EXCEPTION_LEVEL
+	CMPQ	CX, $const_excNesting
+	JAE	halt
+	INCQ	(DX)
+	EXCEPTION_CONTEXT
+
+	// save exception context
+	MOVQ	24(SP), BX
+	MOVQ	BX, (ExceptionContext_R+0*8)(AX)
+	MOVQ	16(SP), BX
+	MOVQ	BX, (ExceptionContext_R+1*8)(AX)
+	MOVQ	8(SP), BX
+	MOVQ	BX, (ExceptionContext_R+2*8)(AX)
+	MOVQ	0(SP), BX
+	MOVQ	BX, (ExceptionContext_R+3*8)(AX)
+	MOVQ	SI, (ExceptionContext_R+4*8)(AX)
+	MOVQ	DI, (ExceptionContext_R+5*8)(AX)
+	MOVQ	BP, (ExceptionContext_R+6*8)(AX)
+	MOVQ	R8, (ExceptionContext_R+8*8)(AX)
+	MOVQ	R9, (ExceptionContext_R+9*8)(AX)
+	MOVQ	R10, (ExceptionContext_R+10*8)(AX)
+	MOVQ	R11, (ExceptionContext_R+11*8)(AX)
+	MOVQ	R12, (ExceptionContext_R+12*8)(AX)
+	MOVQ	R13, (ExceptionContext_R+13*8)(AX)
+	MOVQ	R14, (ExceptionContext_R+14*8)(AX)
+	MOVQ	R15, (ExceptionContext_R+15*8)(AX)
+
+	// discard scratch registers
+	ADDQ	$32, SP
 
-	// find EIP from handler's stack
-	ADDQ	$(8*2), SP
-	MOVQ	eip+(8*0)(SP), R12
-	MOVQ	R12, ·eip(SB)
+	MOVQ	CR2, BX
+	MOVQ	BX, ExceptionContext_CR2(AX)
+	MOVQ	SP, ExceptionContext_frame(AX)
+
+	// find ISR offset from stack linking information (see irqHandler)
+	MOVQ	isr+(8*0)(SP), BX
+	SUBQ	$(const_callSize), BX
+	MOVQ	BX, ExceptionContext_isr(AX)
 
 	// call exception handler on system stack (g0)
-	MOVQ	$·SystemExceptionHandler(SB), AX
+	MOVQ	$·systemExceptionFn(SB), AX
 	MOVQ	(AX), AX
 	PUSHQ	AX
 	CALL	runtime·systemstack(SB)
+	ADDQ	$8, SP
+
+	// decrement nesting level
+	EXCEPTION_LEVEL
+	DECQ	CX
+	MOVQ	CX, (DX)
+
+	// restore exception context
+	EXCEPTION_CONTEXT
+	MOVQ	(ExceptionContext_R+1*8)(AX), BX
+	MOVQ	(ExceptionContext_R+2*8)(AX), CX
+	MOVQ	(ExceptionContext_R+3*8)(AX), DX
+	MOVQ	(ExceptionContext_R+4*8)(AX), SI
+	MOVQ	(ExceptionContext_R+5*8)(AX), DI
+	MOVQ	(ExceptionContext_R+6*8)(AX), BP
+	MOVQ	(ExceptionContext_R+8*8)(AX), R8
+	MOVQ	(ExceptionContext_R+9*8)(AX), R9
+	MOVQ	(ExceptionContext_R+10*8)(AX), R10
+	MOVQ	(ExceptionContext_R+11*8)(AX), R11
+	MOVQ	(ExceptionContext_R+12*8)(AX), R12
+	MOVQ	(ExceptionContext_R+13*8)(AX), R13
+	MOVQ	(ExceptionContext_R+14*8)(AX), R14
+	MOVQ	(ExceptionContext_R+15*8)(AX), R15
+
+	// discard stack linking information and error code
+	MOVQ	ExceptionContext_iret(AX), SP
+	MOVQ	(ExceptionContext_R+0*8)(AX), AX
+
+	// return to caller
+	IRETQ
+
+halt:
+	HLT
+	JMP	halt
 
 // To allow a single user-defined ISR for all vectors, a jump table of CALLs,
 // which save the vector PC on the stack, is built to use as IDT offsets.
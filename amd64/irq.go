@@ -17,6 +17,7 @@ import (
 
 	"github.com/usbarmory/tamago/amd64/lapic"
 	"github.com/usbarmory/tamago/dma"
+	"github.com/usbarmory/tamago/internal/sample"
 )
 
 // Interrupt Gate Descriptor Attributes
@@ -56,6 +57,13 @@ var (
 func load_idt() (idt uintptr, irqHandler uintptr)
 func wfi()
 
+// irqSample records the interrupted call stack, when armed by a profiler.
+//
+//go:nosplit
+func irqSample(pc uintptr, fp uintptr) {
+	sample.Record(pc, fp)
+}
+
 //go:nosplit
 func irqHandler()
 
@@ -87,6 +95,13 @@ func (d *GateDescriptor) SetOffset(addr uintptr) {
 }
 
 func setIDT(start int, end int) {
+	writeIDT(start, end, func(i int) uintptr {
+		// set ISR to irqHandler.abi0 + vector offset
+		return irqHandlerAddr + uintptr(i*callSize)
+	})
+}
+
+func writeIDT(start int, end int, offset func(int) uintptr) {
 	if idtAddr == 0 || irqHandlerAddr == 0 {
 		idtAddr, irqHandlerAddr = load_idt()
 	}
@@ -113,13 +128,23 @@ func setIDT(start int, end int) {
 			break
 		}
 
-		// set ISR to irqHandler.abi0 + vector offset
-		off := irqHandlerAddr + uintptr(i*callSize)
-		desc.SetOffset(off)
+		desc.SetOffset(offset(i))
 		copy(idt[i*gateSize:], desc.Bytes())
 	}
 }
 
+// SetExceptionHandler updates the IDT gate for the argument exception vector
+// with the argument address, which must be the entry point of an assembly
+// handler returning with IRETQ.
+//
+// The address must be obtained in assembly (e.g. `MOVQ $·handler(SB), AX`), as
+// Go function values of assembly functions refer to ABI wrappers.
+func (cpu *CPU) SetExceptionHandler(id int, addr uintptr) {
+	writeIDT(id, id, func(_ int) uintptr {
+		return addr
+	})
+}
+
 // ClearInterrupt signals the end of an interrupt handling routine.
 func (cpu *CPU) ClearInterrupt() {
 	if cpu.init == 0 {
@@ -78,12 +78,56 @@ done:
 	STI
 	RET
 
+// SAMPLE records the interrupted call stack for profiling, the instruction
+// pointer is read from the interrupt stack frame at the argument offset. As
+// Go code is invoked all general purpose registers and X15 are preserved.
+#define SAMPLE(IP)							\
+	PUSHQ	AX							\
+	PUSHQ	BX							\
+	PUSHQ	CX							\
+	PUSHQ	DX							\
+	PUSHQ	SI							\
+	PUSHQ	DI							\
+	PUSHQ	R8							\
+	PUSHQ	R9							\
+	PUSHQ	R10							\
+	PUSHQ	R11							\
+	PUSHQ	R12							\
+	PUSHQ	R13							\
+	PUSHQ	R14							\
+	PUSHQ	R15							\
+	SUBQ	$32, SP							\
+	MOVOU	X15, 16(SP)						\
+	MOVQ	(IP+14*8+32)(SP), AX					\
+	MOVQ	AX, 0(SP)						\
+	MOVQ	BP, 8(SP)						\
+	CALL	·irqSample(SB)						\
+	MOVOU	16(SP), X15						\
+	ADDQ	$32, SP							\
+	POPQ	R15							\
+	POPQ	R14							\
+	POPQ	R13							\
+	POPQ	R12							\
+	POPQ	R11							\
+	POPQ	R10							\
+	POPQ	R9							\
+	POPQ	R8							\
+	POPQ	DI							\
+	POPQ	SI							\
+	POPQ	DX							\
+	POPQ	CX							\
+	POPQ	BX							\
+	POPQ	AX
+
 TEXT ·ignoreInterrupt(SB),NOSPLIT|NOFRAME,$0
 	// IRQs to ignore, used to resume halted processors, are generated by:
 	//  * ·handleInterrupt to wake idle APs
 	//  * CPU.LAPIC.SetTimer at timer expiration
 	//  * CPU.SetAlarm with null deadline
 
+	// sample interrupted call stack for profiling
+	SAMPLE(8)
+
 	// save caller registers
 	PUSHQ	AX
 
@@ -99,6 +143,9 @@ TEXT ·ignoreInterrupt(SB),NOSPLIT|NOFRAME,$0
 	IRETQ
 
 TEXT ·handleInterrupt(SB),NOSPLIT|NOFRAME,$0
+	// sample interrupted call stack for profiling
+	SAMPLE(8)
+
 	// save caller registers
 	PUSHQ	BX
 	PUSHQ	DX
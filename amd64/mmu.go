@@ -45,6 +45,12 @@ const (
 func read_cr0() uint64
 func write_cr0(val uint64)
 func read_cr3() uint64
+func write_cr3(val uint64)
+
+// FlushTLBs flushes the non-global Translation Lookaside Buffers entries.
+func (cpu *CPU) FlushTLBs() {
+	write_cr3(read_cr3())
+}
 
 // SetWriteProtect configures the Write Protect (WP) bit in Control Register 0
 // (CR0).
@@ -24,3 +24,9 @@ TEXT ·read_cr3(SB),$0-8
 	MOVQ	CR3, AX
 	MOVQ	AX, ret+0(FP)
 	RET
+
+// func write_cr3(val uint64)
+TEXT ·write_cr3(SB),$0-8
+	MOVQ	val+0(FP), AX
+	MOVQ	AX, CR3
+	RET
@@ -10,7 +10,7 @@
 // operations.
 //
 // The following architectures/cores are supported/tested:
-//   - ARMv7-A / Cortex-A7 (single-core)
+//   - ARMv7-A / Cortex-A7 (single-core, multi-core with CPU.InitSMP)
 //   - ARMv5TEJ / ARM926EJ-S (single-core, no VFP)
 //
 // This package is only meant to be used with `GOOS=tamago GOARCH=arm` as
@@ -64,6 +64,9 @@ type CPU struct {
 
 	// vector base address register
 	vbar uint32
+
+	// last initialized core index
+	init int
 }
 
 // defined in arm.s
@@ -20,6 +20,10 @@ func cache_enable()
 func cache_disable()
 func cache_flush_data()
 func cache_flush_instruction()
+func read_ctr() uint32
+func cache_clean_range(start uint32, end uint32, line uint32)
+func cache_invalidate_range(start uint32, end uint32, line uint32)
+func cache_clean_invalidate_range(start uint32, end uint32, line uint32)
 
 // EnableSMP sets the SMP bit in Cortex-A7 Auxiliary Control Register, to
 // enable coherent requests to the processor. This must be ensured before
@@ -51,6 +55,56 @@ func (cpu *CPU) FlushInstructionCache() {
 	cache_flush_instruction()
 }
 
+// DataCacheLineSize returns the smallest data cache line size.
+func (cpu *CPU) DataCacheLineSize() int {
+	ctr := read_ctr()
+
+	if ctr>>29 == 0b100 {
+		// ARMv7 format, DminLine is Log2 of the number of words
+		return 4 << ((ctr >> 16) & 0xf)
+	}
+
+	// ARMv5/ARMv6 format, Dsize LEN is Log2 of the number of words - 1
+	return 8 << ((ctr >> 12) & 0b11)
+}
+
+// CleanDataCacheRange cleans (writes back) the data cache lines, to the point
+// of coherency, for the given memory range.
+func (cpu *CPU) CleanDataCacheRange(addr uint, size int) {
+	if size <= 0 {
+		return
+	}
+
+	cache_clean_range(uint32(addr), uint32(addr)+uint32(size), uint32(cpu.DataCacheLineSize()))
+}
+
+// InvalidateDataCacheRange invalidates the data cache lines, to the point of
+// coherency, for the given memory range. Lines only partially covered by the
+// range are cleaned and invalidated, to preserve adjacent data.
+func (cpu *CPU) InvalidateDataCacheRange(addr uint, size int) {
+	if size <= 0 {
+		return
+	}
+
+	line := uint32(cpu.DataCacheLineSize())
+	start := uint32(addr)
+	end := start + uint32(size)
+
+	if start&(line-1) != 0 {
+		cache_clean_invalidate_range(start, start+1, line)
+		start = (start + line) &^ (line - 1)
+	}
+
+	if end&(line-1) != 0 && end > start {
+		cache_clean_invalidate_range(end-1, end, line)
+		end &^= line - 1
+	}
+
+	if end > start {
+		cache_invalidate_range(start, end, line)
+	}
+}
+
 // FlushTLBs flushes the ARM Translation Lookaside Buffers.
 func (cpu *CPU) FlushTLBs() {
 	flush_tlb()
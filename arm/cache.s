@@ -107,3 +107,60 @@ TEXT ·cache_flush_instruction(SB),$0
 	MOVW	$0, R0
 	MCR	15, 0, R0, C7, C5, 0
 	RET
+
+// func read_ctr() uint32
+TEXT ·read_ctr(SB),$0-4
+	MRC	15, 0, R0, C0, C0, 1
+	MOVW	R0, ret+0(FP)
+	RET
+
+// The CP15 data synchronization barrier is used, in place of DSB, for
+// compatibility with ARMv5 cores.
+
+// func cache_clean_range(start uint32, end uint32, line uint32)
+TEXT ·cache_clean_range(SB),$0-12
+	MOVW	start+0(FP), R0
+	MOVW	end+4(FP), R1
+	MOVW	line+8(FP), R2
+	SUB	$1, R2, R3
+	BIC	R3, R0
+clean:
+	MCR	15, 0, R0, C7, C10, 1		// clean by MVA to PoC
+	ADD	R2, R0
+	CMP	R1, R0
+	BLO	clean
+	MOVW	$0, R0
+	MCR	15, 0, R0, C7, C10, 4		// data synchronization barrier
+	RET
+
+// func cache_invalidate_range(start uint32, end uint32, line uint32)
+TEXT ·cache_invalidate_range(SB),$0-12
+	MOVW	start+0(FP), R0
+	MOVW	end+4(FP), R1
+	MOVW	line+8(FP), R2
+	SUB	$1, R2, R3
+	BIC	R3, R0
+invalidate:
+	MCR	15, 0, R0, C7, C6, 1		// invalidate by MVA to PoC
+	ADD	R2, R0
+	CMP	R1, R0
+	BLO	invalidate
+	MOVW	$0, R0
+	MCR	15, 0, R0, C7, C10, 4		// data synchronization barrier
+	RET
+
+// func cache_clean_invalidate_range(start uint32, end uint32, line uint32)
+TEXT ·cache_clean_invalidate_range(SB),$0-12
+	MOVW	start+0(FP), R0
+	MOVW	end+4(FP), R1
+	MOVW	line+8(FP), R2
+	SUB	$1, R2, R3
+	BIC	R3, R0
+flush:
+	MCR	15, 0, R0, C7, C14, 1		// clean and invalidate by MVA to PoC
+	ADD	R2, R0
+	CMP	R1, R0
+	BLO	flush
+	MOVW	$0, R0
+	MCR	15, 0, R0, C7, C10, 4		// data synchronization barrier
+	RET
@@ -12,6 +12,8 @@ import (
 	"runtime/goos"
 	"unsafe"
 
+	"github.com/usbarmory/tamago/fault"
+	"github.com/usbarmory/tamago/internal/exception"
 	"github.com/usbarmory/tamago/internal/reg"
 )
 
@@ -27,6 +29,14 @@ const (
 	FIQ            = 0x1c
 )
 
+// Fault status encodings
+// (B3.13.3 Fault Status and Fault Address registers in a VMSA implementation,
+// ARM Architecture Reference Manual ARMv7-A and ARMv7-R edition).
+const (
+	FS_ALIGNMENT = 0b00001
+	FS_DEBUG     = 0b00010
+)
+
 // linknamed by application as needed
 var vecTableStart uint32
 
@@ -42,6 +52,7 @@ const (
 
 // defined in exception.s or exception_v5.s (see build constraints)
 func set_exc_stack(addr uint32)
+func excHalt()
 func set_vbar(addr uint32)
 func set_mvbar(addr uint32)
 func resetHandler()
@@ -52,6 +63,10 @@ func dataAbortHandler()
 func irqHandler()
 func fiqHandler()
 func nullHandler()
+func read_dfsr() uint32
+func read_dfar() uint32
+func read_ifsr() uint32
+func read_ifar() uint32
 
 type ExceptionHandler func()
 
@@ -69,10 +84,179 @@ type VectorTable struct {
 	FIQ           ExceptionHandler
 }
 
-// DefaultExceptionHandler handles an exception by printing its vector and
-// processor mode before panicking.
+// ExceptionContext represents the processor state captured on exceptions
+// handled by the vector table returned by SystemVectorTable().
+type ExceptionContext struct {
+	// Vector is the exception vector offset.
+	Vector int
+
+	// R holds general purpose registers r0-r12, only r0-r7 are captured
+	// on FIQ exceptions.
+	R  [13]uint32
+	SP uint32
+	LR uint32
+	PC uint32
+	// CPSR holds the exception Saved Program Status Register.
+	CPSR uint32
+
+	// Data Fault Status and Address Registers
+	DFSR uint32
+	DFAR uint32
+
+	// Instruction Fault Status and Address Registers (IFAR is not
+	// captured on ARMv5 cores).
+	IFSR uint32
+	IFAR uint32
+
+	// saved registers address, set by exception.s
+	frame uint32
+}
+
+// maximum exception nesting level, per core
+const excNesting = 2
+
+var (
+	// per-core exception contexts, by nesting level
+	excContexts [maxCores][excNesting]ExceptionContext
+	// per-core exception nesting level
+	excLevel [maxCores]uint32
+)
+
+var registerNames = [...]string{
+	"r0", "r1", "r2", "r3", "r4", "r5", "r6", "r7", "r8", "r9", "r10",
+	"r11", "r12", "sp", "lr", "pc", "cpsr", "dfsr", "dfar", "ifsr", "ifar",
+}
+
+// saved registers count
+func (ctx *ExceptionContext) n() int {
+	if ctx.Vector == FIQ {
+		return 8
+	}
+
+	return len(ctx.R)
+}
+
+func (ctx *ExceptionContext) load(off int) {
+	ctx.Vector = off
+	ctx.R = [13]uint32{}
+	ctx.DFSR, ctx.DFAR, ctx.IFSR, ctx.IFAR = 0, 0, 0, 0
+
+	n := ctx.n()
+
+	for i := 0; i < n; i++ {
+		ctx.R[i] = reg.Read(ctx.frame + uint32(i*4))
+	}
+
+	ctx.PC = reg.Read(ctx.frame + uint32(n*4))
+	ctx.SP = ctx.frame + uint32((n+1)*4)
+
+	switch off {
+	case PREFETCH_ABORT:
+		ctx.IFSR = read_ifsr()
+		ctx.IFAR = read_ifar()
+	case DATA_ABORT:
+		ctx.DFSR = read_dfsr()
+		ctx.DFAR = read_dfar()
+	}
+}
+
+func (ctx *ExceptionContext) store() {
+	n := ctx.n()
+
+	for i := 0; i < n; i++ {
+		reg.Write(ctx.frame+uint32(i*4), ctx.R[i])
+	}
+
+	reg.Write(ctx.frame+uint32(n*4), ctx.PC)
+}
+
+func faultStatus(fsr uint32) uint32 {
+	return (fsr>>6)&0b10000 | fsr&0b1111
+}
+
+// Class returns the exception class.
+func (ctx *ExceptionContext) Class() fault.Class {
+	switch ctx.Vector {
+	case UNDEFINED:
+		return fault.UndefinedInstruction
+	case SUPERVISOR:
+		return fault.Syscall
+	case PREFETCH_ABORT:
+		if faultStatus(ctx.IFSR) == FS_DEBUG {
+			return fault.Breakpoint
+		}
+
+		return fault.InstructionFault
+	case DATA_ABORT:
+		switch faultStatus(ctx.DFSR) {
+		case FS_ALIGNMENT:
+			return fault.Alignment
+		case FS_DEBUG:
+			return fault.Breakpoint
+		}
+
+		return fault.DataFault
+	}
+
+	return fault.Unknown
+}
+
+// ProgramCounter returns the exception program counter.
+func (ctx *ExceptionContext) ProgramCounter() uintptr {
+	return uintptr(ctx.PC)
+}
+
+// SetProgramCounter updates the program counter at which execution is
+// resumed.
+func (ctx *ExceptionContext) SetProgramCounter(pc uintptr) {
+	ctx.PC = uint32(pc)
+}
+
+// Address returns the faulting memory address for data and prefetch aborts.
+func (ctx *ExceptionContext) Address() uintptr {
+	switch ctx.Vector {
+	case PREFETCH_ABORT:
+		return uintptr(ctx.IFAR)
+	case DATA_ABORT:
+		return uintptr(ctx.DFAR)
+	}
+
+	return 0
+}
+
+// Print prints the exception context registers.
+func (ctx *ExceptionContext) Print() {
+	var vals [len(registerNames)]uint64
+
+	for i, r := range ctx.R {
+		vals[i] = uint64(r)
+	}
+
+	copy(vals[len(ctx.R):], []uint64{
+		uint64(ctx.SP), uint64(ctx.LR), uint64(ctx.PC), uint64(ctx.CPSR),
+		uint64(ctx.DFSR), uint64(ctx.DFAR), uint64(ctx.IFSR), uint64(ctx.IFAR),
+	})
+
+	print("exception: vector ", VectorName(ctx.Vector), " mode ", ModeName(int(ctx.CPSR&0x1f)), " (", ctx.Class().String(), ")\n")
+	exception.PrintRegisters(registerNames[:], vals[:], 8)
+}
+
+// currentContext returns the context of the exception being serviced on the
+// calling core.
+func currentContext() *ExceptionContext {
+	var core uint32
+
+	if smpControl != nil {
+		core = read_mpidr() & 0xff
+	}
+
+	return &excContexts[core][excLevel[core]-1]
+}
+
+// DefaultExceptionHandler handles an exception by printing its context before
+// panicking.
 func DefaultExceptionHandler(off int) {
-	print("exception: vector ", off, " mode ", int(read_cpsr()&0x1f), "\n")
+	currentContext().Print()
 	panic("unhandled exception")
 }
 
@@ -80,10 +264,19 @@ func DefaultExceptionHandler(off int) {
 // executed at any exception by the table returned by SystemVectorTable(),
 // which is used by default when initializing the CPU instance (e.g.
 // CPU.Init()).
+//
+// Handlers registered with fault.SetHandler() take precedence.
 var SystemExceptionHandler = DefaultExceptionHandler
 
 func systemException(off int) {
-	SystemExceptionHandler(off)
+	ctx := currentContext()
+	ctx.load(off)
+
+	if !fault.Handle(ctx) {
+		SystemExceptionHandler(off)
+	}
+
+	ctx.store()
 }
 
 // SystemVectorTable returns a vector table that, for all exceptions, switches
@@ -0,0 +1,32 @@
+// ARM processor support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// EXCEPTION_LEVEL sets R1 to the calling core, R2 to its nesting level
+// address and R3 to its nesting level, the core is read from MPIDR only once
+// SMP is enabled (see CPU.InitSMP).
+#define EXCEPTION_LEVEL							\
+	MOVW	$0, R1							\
+	MOVW	·smpControl(SB), R2					\
+	CMP	$0, R2							\
+	B.EQ	3(PC)							\
+	MRC	15, 0, R1, C0, C0, 5	/* MPIDR */			\
+	AND	$0xff, R1						\
+	MOVW	$·excLevel(SB), R2					\
+	ADD	R1<<2, R2, R2						\
+	MOVW	(R2), R3
+
+// EXCEPTION_CONTEXT sets R0 to the exception context address for the core in
+// R1 and nesting level in R3, R2 is clobbered.
+#define EXCEPTION_CONTEXT						\
+	MOVW	$const_excNesting, R0					\
+	MUL	R0, R1, R0						\
+	ADD	R3, R0, R0						\
+	MOVW	$ExceptionContext__size, R2				\
+	MUL	R2, R0, R0						\
+	MOVW	$·excContexts(SB), R2					\
+	ADD	R2, R0, R0
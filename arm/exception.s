@@ -10,6 +10,7 @@
 
 #include "go_asm.h"
 #include "textflag.h"
+#include "exception.h"
 
 // func set_exc_stack(addr uint32)
 TEXT ·set_exc_stack(SB),NOSPLIT,$0-4
@@ -56,6 +57,30 @@ TEXT ·set_mvbar(SB),NOSPLIT,$0-4
 	MCR	15, 0, R0, C12, C0, 1
 	RET
 
+// func read_dfsr() uint32
+TEXT ·read_dfsr(SB),$0-4
+	MRC	15, 0, R0, C5, C0, 0
+	MOVW	R0, ret+0(FP)
+	RET
+
+// func read_dfar() uint32
+TEXT ·read_dfar(SB),$0-4
+	MRC	15, 0, R0, C6, C0, 0
+	MOVW	R0, ret+0(FP)
+	RET
+
+// func read_ifsr() uint32
+TEXT ·read_ifsr(SB),$0-4
+	MRC	15, 0, R0, C5, C0, 1
+	MOVW	R0, ret+0(FP)
+	RET
+
+// func read_ifar() uint32
+TEXT ·read_ifar(SB),$0-4
+	MRC	15, 0, R0, C6, C0, 2
+	MOVW	R0, ret+0(FP)
+	RET
+
 #define EXCEPTION(OFFSET, FN, LROFFSET, RN, SAVE_SIZE)			\
 	/* restore stack pointer */					\
 	WORD	$0xe105d200			/* mrs sp, SP_usr */	\
@@ -66,6 +91,22 @@ TEXT ·set_mvbar(SB),NOSPLIT,$0-4
 	/* save caller registers */					\
 	MOVM.DB.W	[R0-RN, R14], (R13)	/* push {r0-rN, r14} */	\
 									\
+	/* increment nesting level, halt when exceeded */		\
+	EXCEPTION_LEVEL							\
+	CMP	$const_excNesting, R3					\
+	B.LO	2(PC)							\
+	B	·excHalt(SB)						\
+	ADD	$1, R3, R0						\
+	MOVW	R0, (R2)						\
+									\
+	/* save exception context */					\
+	EXCEPTION_CONTEXT						\
+	MOVW	R13, ExceptionContext_frame(R0)				\
+	WORD	$0xe14f1000			/* mrs r1, SPSR */	\
+	MOVW	R1, ExceptionContext_CPSR(R0)				\
+	WORD	$0xe1061200			/* mrs r1, LR_usr */	\
+	MOVW	R1, ExceptionContext_LR(R0)				\
+									\
 	/* restore g in case this mode banks them */			\
 	MOVW	$SAVE_SIZE, R0						\
 	CMP	$44, R0							\
@@ -83,6 +124,18 @@ TEXT ·set_mvbar(SB),NOSPLIT,$0-4
 	MOVW	R14, R3							\
 	CALL	runtime·CallOnG0(SB)					\
 									\
+	/* decrement nesting level */					\
+	EXCEPTION_LEVEL							\
+	SUB	$1, R3, R3						\
+	MOVW	R3, (R2)						\
+									\
+	/* restore exception context */					\
+	EXCEPTION_CONTEXT						\
+	MOVW	ExceptionContext_CPSR(R0), R1				\
+	WORD	$0xe16ff001			/* msr SPSR_fsxc, r1 */	\
+	MOVW	ExceptionContext_LR(R0), R1				\
+	WORD	$0xe126f201			/* msr LR_usr, r1 */	\
+									\
 	/* restore caller registers */					\
 	MOVM.IA.W	(R13), [R0-RN, R14]	/* pop {r0-rN, r14} */	\
 									\
@@ -109,3 +162,8 @@ TEXT ·fiqHandler(SB),NOSPLIT|NOFRAME,$0
 
 TEXT ·nullHandler(SB),NOSPLIT|NOFRAME,$0
 	MOVW.S	R14, R15
+
+// nested exceptions exceeding excNesting are not recoverable
+TEXT ·excHalt(SB),NOSPLIT|NOFRAME,$0
+	WORD	$0xe320f003	// wfi
+	B	·excHalt(SB)
@@ -13,9 +13,11 @@
 
 #include "go_asm.h"
 #include "textflag.h"
+#include "exception.h"
 
 // set_exc_stack omits Monitor mode (ARMv6+ TrustZone only);
-// set_vbar and set_mvbar are identical to exception.s.
+// set_vbar, set_mvbar and fault register accessors are identical to
+// exception.s (except IFAR).
 
 // func set_exc_stack(addr uint32)
 TEXT ·set_exc_stack(SB),NOSPLIT,$0-4
@@ -59,6 +61,31 @@ TEXT ·set_mvbar(SB),NOSPLIT,$0-4
 	MCR	15, 0, R0, C12, C0, 1
 	RET
 
+// func read_dfsr() uint32
+TEXT ·read_dfsr(SB),$0-4
+	MRC	15, 0, R0, C5, C0, 0
+	MOVW	R0, ret+0(FP)
+	RET
+
+// func read_dfar() uint32
+TEXT ·read_dfar(SB),$0-4
+	MRC	15, 0, R0, C6, C0, 0
+	MOVW	R0, ret+0(FP)
+	RET
+
+// func read_ifsr() uint32
+TEXT ·read_ifsr(SB),$0-4
+	MRC	15, 0, R0, C5, C0, 1
+	MOVW	R0, ret+0(FP)
+	RET
+
+// func read_ifar() uint32
+TEXT ·read_ifar(SB),$0-4
+	// ARMv5 cores lack the Instruction Fault Address Register
+	MOVW	$0, R0
+	MOVW	R0, ret+0(FP)
+	RET
+
 // ARMv5 lacks `mrs sp, SP_usr` (used by exception.s); instead the preamble
 // loads excStack, saves R0/R1, round-trips through SYS mode to read the user
 // SP, then switches back.
@@ -87,6 +114,26 @@ TEXT ·set_mvbar(SB),NOSPLIT,$0-4
 	/* save caller registers */					\
 	MOVM.DB.W	[R0-RN, R14], (R13)	/* push {r0-rN, r14} */	\
 									\
+	/* increment nesting level, halt when exceeded */		\
+	EXCEPTION_LEVEL							\
+	CMP	$const_excNesting, R3					\
+	B.LO	2(PC)							\
+	B	·excHalt(SB)						\
+	ADD	$1, R3, R0						\
+	MOVW	R0, (R2)						\
+									\
+	/* save exception context, read user LR through SYS mode */	\
+	EXCEPTION_CONTEXT						\
+	MOVW	R0, R2							\
+	MOVW	R13, ExceptionContext_frame(R2)				\
+	WORD	$0xe14f1000			/* mrs r1, SPSR */	\
+	MOVW	R1, ExceptionContext_CPSR(R2)				\
+	WORD	$0xe10f0000			/* mrs r0, CPSR */	\
+	WORD	$0xe321f0df			/* msr CPSR_c, 0xdf */	\
+	MOVW	R14, R1							\
+	WORD	$0xe129f000			/* msr CPSR, r0 */	\
+	MOVW	R1, ExceptionContext_LR(R2)				\
+									\
 	/* FIQ mode banks r8-r14, including g (r10); recover the real g.\
 	 * Only FIQ needs this: its SAVE_SIZE is 36 while every other	\
 	 * mode passes 56, so 44 is simply a threshold between the two.	\
@@ -110,6 +157,21 @@ TEXT ·set_mvbar(SB),NOSPLIT,$0-4
 	MOVW	R14, R3							\
 	CALL	runtime·CallOnG0(SB)					\
 									\
+	/* decrement nesting level */					\
+	EXCEPTION_LEVEL							\
+	SUB	$1, R3, R3						\
+	MOVW	R3, (R2)						\
+									\
+	/* restore exception context, write user LR through SYS mode */	\
+	EXCEPTION_CONTEXT						\
+	MOVW	ExceptionContext_CPSR(R0), R1				\
+	WORD	$0xe16ff001			/* msr SPSR_fsxc, r1 */	\
+	MOVW	ExceptionContext_LR(R0), R1				\
+	WORD	$0xe10f0000			/* mrs r0, CPSR */	\
+	WORD	$0xe321f0df			/* msr CPSR_c, 0xdf */	\
+	MOVW	R1, R14							\
+	WORD	$0xe129f000			/* msr CPSR, r0 */	\
+									\
 	/* restore caller registers */					\
 	MOVM.IA.W	(R13), [R0-RN, R14]	/* pop {r0-rN, r14} */	\
 									\
@@ -136,3 +198,8 @@ TEXT ·fiqHandler(SB),NOSPLIT|NOFRAME,$0
 
 TEXT ·nullHandler(SB),NOSPLIT|NOFRAME,$0
 	MOVW.S	R14, R15
+
+// nested exceptions exceeding excNesting are not recoverable
+TEXT ·excHalt(SB),NOSPLIT|NOFRAME,$0
+	MCR	15, 0, R0, C7, C0, 4	// wait for interrupt
+	B	·excHalt(SB)
@@ -44,6 +44,11 @@ const (
 	GICD_ICENABLER = 0x180
 	GICD_ICPENDR   = 0x280
 
+	GICD_SGIR        = 0xf00
+	SGIR_TARGET_LIST = 16
+	SGIR_NSATT       = 15
+	SGIR_SGIINTID    = 0
+
 	// CPU interface register map
 	// (p76, Table 4-2, ARM Generic Interrupt Controller Architecture Specification).
 	GICC_CTLR  = 0x0000
@@ -104,6 +109,16 @@ func (hw *GIC) Init() {
 		reg.Write(addr, 0x00000000)
 	}
 
+	hw.InitCPUInterface()
+
+	reg.Set(hw.gicd+GICD_CTLR, CTLR_ENABLEGRP1)
+	reg.Set(hw.gicd+GICD_CTLR, CTLR_ENABLEGRP0)
+}
+
+// InitCPUInterface initializes the GIC CPU interface of the calling core, it
+// is invoked by Init for the primary core and must be invoked by each
+// secondary core, after Init, for SMP operation.
+func (hw *GIC) InitCPUInterface() {
 	// Set priority mask to allow Non-Secure world to use the lower half
 	// of the priority range.
 	reg.Write(hw.gicc+GICC_PMR, 0x80)
@@ -112,9 +127,6 @@ func (hw *GIC) Init() {
 
 	reg.Set(hw.gicc+GICC_CTLR, CTLR_ENABLEGRP1)
 	reg.Set(hw.gicc+GICC_CTLR, CTLR_ENABLEGRP0)
-
-	reg.Set(hw.gicd+GICD_CTLR, CTLR_ENABLEGRP1)
-	reg.Set(hw.gicd+GICD_CTLR, CTLR_ENABLEGRP0)
 }
 
 // FIQEn controls whether Group 0 (Secure) interrupts should be signalled as
@@ -173,6 +185,14 @@ func (hw *GIC) GetNonSecureInterrupt() (id int) {
 	return int(m)
 }
 
+// SendSGI generates the argument Software Generated Interrupt (0-15) on the
+// argument target core, it is typically used for inter-processor wake-up
+// signaling (see arm.SMP).
+func (hw *GIC) SendSGI(id int, core int) {
+	sgi := uint32(1<<core)<<SGIR_TARGET_LIST | uint32(id&0xf)<<SGIR_SGIINTID
+	reg.Write(hw.gicd+GICD_SGIR, sgi)
+}
+
 // SetInterruptGroup assigns the corresponding interrupt to either Group 0
 // (Secure, false) or 1 (Non-Secure, true).
 func (hw *GIC) SetInterruptGroup(id int, status bool) {
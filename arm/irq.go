@@ -12,6 +12,8 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+
+	"github.com/usbarmory/tamago/internal/sample"
 )
 
 // IRQ_SIGNAL represents the `os/signal` used to signal and service
@@ -25,6 +27,13 @@ func fiq_enable(spsr bool)
 func fiq_disable(spsr bool)
 func wfi()
 
+// irqSample records the interrupted call stack, when armed by a profiler.
+//
+//go:nosplit
+func irqSample(pc uintptr, fp uintptr) {
+	sample.Record(pc, fp)
+}
+
 // EnableInterrupts unmasks IRQ interrupts in the current or saved program
 // status.
 func (cpu *CPU) EnableInterrupts(saved bool) {
@@ -84,6 +84,14 @@ TEXT ·irqHandler(SB),NOSPLIT|NOFRAME,$0
 	// save caller registers
 	MOVM.DB.W	[R0-R12, R14], (R13)	// push {r0-r12, r14}
 
+	// sample interrupted program counter for profiling
+	SUB	$16, R13, R13
+	MOVW	R14, 4(R13)
+	MOVW	$0, R0
+	MOVW	R0, 8(R13)
+	CALL	·irqSample(SB)
+	ADD	$16, R13, R13
+
 	SUB	$8, R13, R13
 	MOVW	$(const_IRQ_SIGNAL), R0
 	MOVW	R0, 4(R13)
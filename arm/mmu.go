@@ -32,6 +32,7 @@ const (
 	TTE_BUFFERABLE    uint32 = (1 << 2)
 	TTE_CACHEABLE     uint32 = (1 << 3)
 	TTE_EXECUTE_NEVER uint32 = (1 << 4)
+	TTE_SHAREABLE     uint32 = (1 << 16)
 	TTE_SUPERSECTION  uint32 = (1 << 18) | (1 << 1)
 	TTE_NS            uint32 = (1 << 19)
 
@@ -215,3 +216,34 @@ func (cpu *CPU) SetAttributes(start, end, flags uint32) {
 func (cpu *CPU) SetAttribute(start, end, pos, val uint32) {
 	cpu.updateMMU(start, end, 0, int(pos), val<<pos)
 }
+
+// setShareable marks all cacheable memory mappings as shareable, as required
+// for cache coherency across cores.
+func (cpu *CPU) setShareable() {
+	l1pageTableStart := cpu.vbar + l1pageTableOffset
+
+	for i := uint32(0); i < l1pageTableSize; i++ {
+		page := l1pageTableStart + 4*i
+		entry := reg.Read(page)
+
+		switch {
+		case entry&0b11 == TTE_SECTION && entry&TTE_CACHEABLE != 0:
+			reg.Write(page, entry|TTE_SHAREABLE)
+		case entry&0b11 == TTE_PAGE_TABLE:
+			base := entry &^ (l2pageTableSize*4 - 1)
+
+			for j := uint32(0); j < l2pageTableSize; j++ {
+				page := base + 4*j
+				entry := reg.Read(page)
+
+				// small page shareable bit
+				if entry&TTE_SECTION != 0 && entry&TTE_CACHEABLE != 0 {
+					reg.Write(page, entry|1<<10)
+				}
+			}
+		}
+	}
+
+	cpu.FlushDataCache()
+	cpu.FlushTLBs()
+}
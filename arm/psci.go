@@ -0,0 +1,119 @@
+// ARM processor support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package arm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PSCI function identifiers, SMC32 calling convention
+// (Arm Power State Coordination Interface - DEN0022).
+const (
+	PSCI_VERSION      = 0x84000000
+	PSCI_CPU_OFF      = 0x84000002
+	PSCI_CPU_ON       = 0x84000003
+	PSCI_SYSTEM_OFF   = 0x84000008
+	PSCI_SYSTEM_RESET = 0x84000009
+)
+
+// PSCI return codes
+const (
+	PSCI_SUCCESS            = 0
+	PSCI_NOT_SUPPORTED      = -1
+	PSCI_INVALID_PARAMETERS = -2
+	PSCI_DENIED             = -3
+	PSCI_ALREADY_ON         = -4
+	PSCI_ON_PENDING         = -5
+	PSCI_INTERNAL_FAILURE   = -6
+	PSCI_NOT_PRESENT        = -7
+	PSCI_DISABLED           = -8
+	PSCI_INVALID_ADDRESS    = -9
+)
+
+// defined in psci.s
+func smc(fn uint32, a0 uint32, a1 uint32, a2 uint32) uint32
+func hvc(fn uint32, a0 uint32, a1 uint32, a2 uint32) uint32
+
+// PSCI represents a Power State Coordination Interface (PSCI) client,
+// implemented by the Secure Monitor or Hypervisor firmware.
+type PSCI struct {
+	// HVC selects the Hypervisor Call conduit, the Secure Monitor Call
+	// conduit is used otherwise.
+	HVC bool
+}
+
+func (p *PSCI) call(fn uint32, a0 uint32, a1 uint32, a2 uint32) int32 {
+	if p.HVC {
+		return int32(hvc(fn, a0, a1, a2))
+	}
+
+	return int32(smc(fn, a0, a1, a2))
+}
+
+func psciError(ret int32) error {
+	switch ret {
+	case PSCI_SUCCESS:
+		return nil
+	case PSCI_NOT_SUPPORTED:
+		return errors.New("not supported")
+	case PSCI_INVALID_PARAMETERS:
+		return errors.New("invalid parameters")
+	case PSCI_DENIED:
+		return errors.New("denied")
+	case PSCI_ALREADY_ON:
+		return errors.New("already on")
+	case PSCI_ON_PENDING:
+		return errors.New("on pending")
+	case PSCI_INTERNAL_FAILURE:
+		return errors.New("internal failure")
+	case PSCI_NOT_PRESENT:
+		return errors.New("not present")
+	case PSCI_DISABLED:
+		return errors.New("disabled")
+	case PSCI_INVALID_ADDRESS:
+		return errors.New("invalid address")
+	}
+
+	return fmt.Errorf("PSCI error %d", ret)
+}
+
+// Version returns the PSCI implementation major and minor version.
+func (p *PSCI) Version() (major int, minor int) {
+	v := uint32(p.call(PSCI_VERSION, 0, 0, 0))
+	return int(v >> 16), int(v & 0xffff)
+}
+
+// CPUOn powers up the core identified by the argument MPIDR affinity value,
+// which starts execution at the argument physical entry address with the
+// context identifier in R0.
+func (p *PSCI) CPUOn(mpidr uint32, entry uint32, context uint32) error {
+	return psciError(p.call(PSCI_CPU_ON, mpidr, entry, context))
+}
+
+// CPUOff powers down the calling core, it only returns on failure.
+func (p *PSCI) CPUOff() error {
+	return psciError(p.call(PSCI_CPU_OFF, 0, 0, 0))
+}
+
+// SystemOff shuts down the system, it only returns on failure.
+func (p *PSCI) SystemOff() error {
+	return psciError(p.call(PSCI_SYSTEM_OFF, 0, 0, 0))
+}
+
+// SystemReset resets the system, it only returns on failure.
+func (p *PSCI) SystemReset() error {
+	return psciError(p.call(PSCI_SYSTEM_RESET, 0, 0, 0))
+}
+
+// Start powers up the argument secondary core, within the first affinity
+// level, at the argument entry address (see SMP.Start).
+func (p *PSCI) Start(core int, entry uint32) error {
+	return p.CPUOn(uint32(core), entry, 0)
+}
@@ -0,0 +1,31 @@
+// ARM processor support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func smc(fn uint32, a0 uint32, a1 uint32, a2 uint32) uint32
+TEXT ·smc(SB),$0-20
+	MOVW	fn+0(FP), R0
+	MOVW	a0+4(FP), R1
+	MOVW	a1+8(FP), R2
+	MOVW	a2+12(FP), R3
+
+	WORD	$0xe1600070	// smc #0
+
+	MOVW	R0, ret+16(FP)
+	RET
+
+// func hvc(fn uint32, a0 uint32, a1 uint32, a2 uint32) uint32
+TEXT ·hvc(SB),$0-20
+	MOVW	fn+0(FP), R0
+	MOVW	a0+4(FP), R1
+	MOVW	a1+8(FP), R2
+	MOVW	a2+12(FP), R3
+
+	WORD	$0xe1400070	// hvc #0
+
+	MOVW	R0, ret+16(FP)
+	RET
@@ -0,0 +1,143 @@
+// ARM processor support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "go_asm.h"
+#include "textflag.h"
+
+// func read_mpidr() uint32
+TEXT ·read_mpidr(SB),NOSPLIT,$0-4
+	// ARM Architecture Reference Manual ARMv7-A and ARMv7-R edition
+	// B4.1.106 MPIDR, Multiprocessor Affinity Register, VMSA
+	MRC	15, 0, R0, C0, C0, 5
+	MOVW	R0, ret+0(FP)
+	RET
+
+// func read_l2ctlr() uint32
+TEXT ·read_l2ctlr(SB),NOSPLIT,$0-4
+	// Cortex™-A7 MPCore® Technical Reference Manual r0p5
+	// 4.3.53 L2 Control Register
+	MRC	15, 1, R0, C9, C0, 2
+	MOVW	R0, ret+0(FP)
+	RET
+
+// func wfe()
+TEXT ·wfe(SB),$0
+	// wait until an event is received in low-power state
+	WORD	$0xe320f002	// wfe
+	RET
+
+// func sev()
+TEXT ·sev(SB),$0
+	WORD	$0xf57ff04f	// dsb sy
+	WORD	$0xe320f004	// sev
+	RET
+
+// TASK loads the calling core task address in RN, R0 is clobbered.
+#define TASK(RN)							\
+	MRC	15, 0, R0, C0, C0, 5	/* read MPIDR */		\
+	AND	$0xff, R0, R0						\
+	MOVW	$task__size, RN						\
+	MUL	R0, RN, RN						\
+	MOVW	$·smpTasks(SB), R0					\
+	ADD	R0, RN, RN
+
+TEXT ·secondaryEntry(SB),NOSPLIT|NOFRAME,$0
+	// detect HYP mode and switch to SVC if necessary
+	WORD	$0xe10f0000	// mrs r0, CPSR
+	AND	$0x1f, R0, R0	// get processor mode
+
+	CMP	$0x1a, R0	// HYP mode
+	B.EQ	hyp
+	B	·secondaryStart(SB)
+hyp:
+	BIC	$0x1f, R0
+	ORR	$0x1d3, R0	// AIF masked, SVC mode
+	MOVW	$·secondaryStart(SB), R14
+	WORD	$0xe16ff000	// msr SPSR_fsxc, r0
+	WORD	$0xe12ef30e	// msr ELR_hyp, lr
+	WORD	$0xe160006e	// eret
+
+TEXT ·secondaryStart(SB),NOSPLIT|NOFRAME,$0
+	// enter System Mode, IRQ/FIQ masked
+	WORD	$0xe321f0df	// msr CPSR_c, 0xdf
+
+	// enable coherent requests to the processor (see CPU.EnableSMP)
+	MRC	15, 0, R0, C1, C0, 1
+	ORR	$(1<<const_ACTLR_SMP), R0
+	MCR	15, 0, R0, C1, C0, 1
+
+	// set per-core exception stack
+	MRC	15, 0, R1, C0, C0, 5	// read MPIDR
+	AND	$0xff, R1, R1
+	MOVW	$const_coreStackSize, R2
+	MUL	R1, R2, R2
+	MOVW	·excStack(SB), R0
+	SUB	R2, R0, R0
+
+	// use the exception stack until a task is received
+	MOVW	R0, R13
+	SUB	$8, R13, R13
+
+	MOVW	R0, 4(R13)
+	CALL	·set_exc_stack(SB)
+
+	// apply primary core vector table
+	MOVW	·smpVBAR(SB), R0
+	MOVW	R0, 4(R13)
+	CALL	·set_vbar(SB)
+
+	// apply primary core translation tables and enable MMU
+	MOVW	·smpVBAR(SB), R0
+	ADD	$const_l1pageTableOffset, R0, R0
+	MOVW	R0, 4(R13)
+	CALL	·set_ttbr0(SB)
+
+	CALL	·cache_enable(SB)
+	CALL	·vfp_enable(SB)
+
+	// signal readiness through the counting semaphore
+	MOVW	$·smpReady(SB), R1
+inc:
+	LDREX	(R1), R2
+	ADD	$1, R2, R2
+	STREX	R2, (R1), R3
+	CMP	$0, R3
+	B.NE	inc
+
+	WORD	$0xf57ff04f	// dsb sy
+wait:
+	// wait SEV from CPU.Task
+	WORD	$0xe320f002	// wfe
+
+	TASK(R4)
+	MOVW	task_pc(R4), R5
+	CMP	$0, R5
+	B.EQ	wait
+
+	WORD	$0xf57ff05f	// dmb sy
+
+	MOVW	task_sp(R4), R13
+	MOVW	task_gp(R4), g
+
+	// per-core initialization on the task system stack
+	CALL	·secondaryInit(SB)
+
+	TASK(R4)
+	MOVW	task_pc(R4), R5
+
+	// clear task
+	MOVW	$0, R0
+	MOVW	R0, task_sp(R4)
+	MOVW	R0, task_gp(R4)
+	MOVW	R0, task_pc(R4)
+
+	// call task target
+	BL	(R5)
+
+	// go back to idle state in case we return
+	B	wait
@@ -10,7 +10,7 @@
 // operations.
 //
 // The following architectures/cores are supported/tested:
-//   - ARMv8-A / Cortex-A53 (single-core)
+//   - ARMv8-A / Cortex-A53 (single-core, multi-core with CPU.InitSMP)
 //
 // This package is only meant to be used with `GOOS=tamago GOARCH=arm64` as
 // supported by the TamaGo framework for bare metal Go, see
@@ -28,6 +28,11 @@ type CPU struct {
 	TimerMultiplier float64
 	// Timer offset in nanoseconds
 	TimerOffset int64
+
+	// vector base address register
+	vbar uint64
+	// last initialized core index
+	init int
 }
 
 // defined in arm64.s
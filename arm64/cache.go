@@ -11,6 +11,10 @@ package arm64
 // defined in cache.s
 func cache_enable()
 func cache_disable()
+func read_ctr() uint64
+func cache_clean_range(start uint64, end uint64, line uint64)
+func cache_invalidate_range(start uint64, end uint64, line uint64)
+func cache_clean_invalidate_range(start uint64, end uint64, line uint64)
 
 // EnableCache activates the ARM instruction and data caches.
 func (cpu *CPU) EnableCache() {
@@ -22,6 +26,49 @@ func (cpu *CPU) DisableCache() {
 	cache_disable()
 }
 
+// DataCacheLineSize returns the smallest data cache line size.
+func (cpu *CPU) DataCacheLineSize() int {
+	// DminLine is Log2 of the number of words
+	return 4 << ((read_ctr() >> 16) & 0xf)
+}
+
+// CleanDataCacheRange cleans (writes back) the data cache lines, to the point
+// of coherency, for the given memory range.
+func (cpu *CPU) CleanDataCacheRange(addr uint, size int) {
+	if size <= 0 {
+		return
+	}
+
+	cache_clean_range(uint64(addr), uint64(addr)+uint64(size), uint64(cpu.DataCacheLineSize()))
+}
+
+// InvalidateDataCacheRange invalidates the data cache lines, to the point of
+// coherency, for the given memory range. Lines only partially covered by the
+// range are cleaned and invalidated, to preserve adjacent data.
+func (cpu *CPU) InvalidateDataCacheRange(addr uint, size int) {
+	if size <= 0 {
+		return
+	}
+
+	line := uint64(cpu.DataCacheLineSize())
+	start := uint64(addr)
+	end := start + uint64(size)
+
+	if start&(line-1) != 0 {
+		cache_clean_invalidate_range(start, start+1, line)
+		start = (start + line) &^ (line - 1)
+	}
+
+	if end&(line-1) != 0 && end > start {
+		cache_clean_invalidate_range(end-1, end, line)
+		end &^= line - 1
+	}
+
+	if end > start {
+		cache_invalidate_range(start, end, line)
+	}
+}
+
 // FlushTLBs flushes the ARM Translation Lookaside Buffers.
 func (cpu *CPU) FlushTLBs() {
 	flush_tlb()
@@ -28,3 +28,54 @@ TEXT ·cache_enable(SB),$0
 	MSR	R0, SCTLR_EL1
 	ISB	SY
 	RET
+
+// func read_ctr() uint64
+TEXT ·read_ctr(SB),$0-8
+	MRS	CTR_EL0, R0
+	MOVD	R0, ret+0(FP)
+	RET
+
+// func cache_clean_range(start uint64, end uint64, line uint64)
+TEXT ·cache_clean_range(SB),$0-24
+	MOVD	start+0(FP), R0
+	MOVD	end+8(FP), R1
+	MOVD	line+16(FP), R2
+	SUB	$1, R2, R3
+	BIC	R3, R0, R0
+clean:
+	DC	CVAC, R0	// clean by VA to PoC
+	ADD	R2, R0, R0
+	CMP	R1, R0
+	BLO	clean
+	DSB	SY
+	RET
+
+// func cache_invalidate_range(start uint64, end uint64, line uint64)
+TEXT ·cache_invalidate_range(SB),$0-24
+	MOVD	start+0(FP), R0
+	MOVD	end+8(FP), R1
+	MOVD	line+16(FP), R2
+	SUB	$1, R2, R3
+	BIC	R3, R0, R0
+invalidate:
+	DC	IVAC, R0	// invalidate by VA to PoC
+	ADD	R2, R0, R0
+	CMP	R1, R0
+	BLO	invalidate
+	DSB	SY
+	RET
+
+// func cache_clean_invalidate_range(start uint64, end uint64, line uint64)
+TEXT ·cache_clean_invalidate_range(SB),$0-24
+	MOVD	start+0(FP), R0
+	MOVD	end+8(FP), R1
+	MOVD	line+16(FP), R2
+	SUB	$1, R2, R3
+	BIC	R3, R0, R0
+flush:
+	DC	CIVAC, R0	// clean and invalidate by VA to PoC
+	ADD	R2, R0, R0
+	CMP	R1, R0
+	BLO	flush
+	DSB	SY
+	RET
@@ -12,6 +12,7 @@ import (
 	"runtime/goos"
 	"unsafe"
 
+	"github.com/usbarmory/tamago/fault"
 	"github.com/usbarmory/tamago/internal/exception"
 	"github.com/usbarmory/tamago/internal/reg"
 )
@@ -21,6 +22,41 @@ const (
 	vecTableJump = 0xd61f0240 // br x18
 )
 
+// Exception classes
+// (D17.2.37 ESR_EL1, Exception Syndrome Register (EL1), ARM DDI 0487).
+const (
+	EC_UNKNOWN           = 0x00
+	EC_ILLEGAL_STATE     = 0x0e
+	EC_SMC_32            = 0x13
+	EC_SVC               = 0x15
+	EC_HVC               = 0x16
+	EC_SMC               = 0x17
+	EC_INSTR_ABORT_LOWER = 0x20
+	EC_INSTR_ABORT       = 0x21
+	EC_PC_ALIGNMENT      = 0x22
+	EC_DATA_ABORT_LOWER  = 0x24
+	EC_DATA_ABORT        = 0x25
+	EC_SP_ALIGNMENT      = 0x26
+	EC_FP_32             = 0x28
+	EC_FP_64             = 0x2c
+	EC_SERROR            = 0x2f
+	EC_BREAKPOINT_LOWER  = 0x30
+	EC_BREAKPOINT        = 0x31
+	EC_STEP_LOWER        = 0x32
+	EC_STEP              = 0x33
+	EC_WATCHPOINT_LOWER  = 0x34
+	EC_WATCHPOINT        = 0x35
+	EC_BKPT              = 0x38
+	EC_VECTOR_CATCH      = 0x3a
+	EC_BRK               = 0x3c
+)
+
+// Data Fault Status Code for alignment faults
+const DFSC_ALIGNMENT = 0b100001
+
+// maximum exception nesting level, per core
+const excNesting = 2
+
 // defined in exception.s
 func set_vbar(addr uint64)
 func read_el() uint64
@@ -33,10 +69,111 @@ func (fn exceptionHandler) vector() uint64 {
 	return **((**uint64)(unsafe.Pointer(&fn)))
 }
 
-var isThrowing bool
+// ExceptionContext represents the processor state captured on synchronous
+// exceptions and system errors.
+type ExceptionContext struct {
+	// R holds general purpose registers x0-x30.
+	R  [31]uint64
+	SP uint64
+	// PC holds the Exception Link Register (ELR_EL1).
+	PC uint64
+	// PSTATE holds the Saved Program Status Register (SPSR_EL1).
+	PSTATE uint64
+
+	// Exception Syndrome Register
+	ESR uint64
+	// Fault Address Register
+	FAR uint64
+
+	// fault handling result, read by exception.s
+	handled bool
+}
+
+var (
+	// per-core exception contexts, by nesting level
+	excContexts [maxCores][excNesting]ExceptionContext
+	// per-core exception nesting level
+	excLevel [maxCores]uint64
+
+	// last unhandled exception context
+	excContext ExceptionContext
+	isThrowing bool
+
+	faultHandlerFn = faultHandler
+)
+
+var registerNames = [...]string{
+	"x0", "x1", "x2", "x3", "x4", "x5", "x6", "x7", "x8", "x9", "x10",
+	"x11", "x12", "x13", "x14", "x15", "x16", "x17", "x18", "x19", "x20",
+	"x21", "x22", "x23", "x24", "x25", "x26", "x27", "x28", "x29", "x30",
+	"sp", "pc", "pstate", "esr", "far",
+}
+
+// Class returns the exception class.
+func (ctx *ExceptionContext) Class() fault.Class {
+	switch ctx.ESR >> 26 {
+	case EC_UNKNOWN, EC_ILLEGAL_STATE:
+		return fault.UndefinedInstruction
+	case EC_SVC, EC_HVC, EC_SMC, EC_SMC_32:
+		return fault.Syscall
+	case EC_INSTR_ABORT_LOWER, EC_INSTR_ABORT:
+		return fault.InstructionFault
+	case EC_PC_ALIGNMENT, EC_SP_ALIGNMENT:
+		return fault.Alignment
+	case EC_DATA_ABORT_LOWER, EC_DATA_ABORT:
+		if ctx.ESR&0x3f == DFSC_ALIGNMENT {
+			return fault.Alignment
+		}
+
+		return fault.DataFault
+	case EC_FP_32, EC_FP_64:
+		return fault.Arithmetic
+	case EC_SERROR:
+		return fault.SystemError
+	case EC_BREAKPOINT_LOWER, EC_BREAKPOINT, EC_STEP_LOWER, EC_STEP,
+		EC_WATCHPOINT_LOWER, EC_WATCHPOINT, EC_BKPT, EC_VECTOR_CATCH, EC_BRK:
+		return fault.Breakpoint
+	}
+
+	return fault.Unknown
+}
+
+// ProgramCounter returns the exception program counter.
+func (ctx *ExceptionContext) ProgramCounter() uintptr {
+	return uintptr(ctx.PC)
+}
+
+// SetProgramCounter updates the program counter at which execution is
+// resumed.
+func (ctx *ExceptionContext) SetProgramCounter(pc uintptr) {
+	ctx.PC = uint64(pc)
+}
+
+// Address returns the faulting memory address for instruction and data
+// aborts, PC and watchpoint exceptions.
+func (ctx *ExceptionContext) Address() uintptr {
+	switch ctx.ESR >> 26 {
+	case EC_INSTR_ABORT_LOWER, EC_INSTR_ABORT, EC_PC_ALIGNMENT,
+		EC_DATA_ABORT_LOWER, EC_DATA_ABORT, EC_WATCHPOINT_LOWER, EC_WATCHPOINT:
+		return uintptr(ctx.FAR)
+	}
+
+	return 0
+}
+
+// Print prints the exception context registers.
+func (ctx *ExceptionContext) Print() {
+	var vals [len(registerNames)]uint64
+
+	copy(vals[:], ctx.R[:])
+	copy(vals[len(ctx.R):], []uint64{ctx.SP, ctx.PC, ctx.PSTATE, ctx.ESR, ctx.FAR})
+
+	print("EL", int(read_el()&0b1100)>>2, " exception: class ", int(ctx.ESR>>26), " (", ctx.Class().String(), ")\n")
+	exception.PrintRegisters(registerNames[:], vals[:], 16)
+}
 
-// DefaultExceptionHandler handles an exception by printing its vector and
-// processor mode before panicking.
+// DefaultExceptionHandler handles an exception by printing its context before
+// panicking.
 func DefaultExceptionHandler(pc uintptr) {
 	if isThrowing {
 		goos.Exit(1)
@@ -44,13 +181,34 @@ func DefaultExceptionHandler(pc uintptr) {
 
 	isThrowing = true
 
-	print("EL", int(read_el()&0b1100)>>2, " exception\n")
+	excContext.Print()
 	exception.Throw(pc)
 }
 
 // SystemExceptionHandler allows to override the default exception handler.
+//
+// Handlers registered with fault.SetHandler() take precedence.
 var SystemExceptionHandler = DefaultExceptionHandler
 
+// currentContext returns the context of the exception being serviced on the
+// calling core.
+func currentContext() *ExceptionContext {
+	core := read_mpidr() & 0xff
+	return &excContexts[core][excLevel[core]-1]
+}
+
+// faultHandler is executed on the system stack (g0) to service exceptions
+// with handlers registered with fault.SetHandler().
+func faultHandler() {
+	ctx := currentContext()
+
+	if ctx.handled = fault.Handle(ctx); !ctx.handled {
+		excContext = *ctx
+	}
+}
+
+// systemException is executed on the faulting goroutine stack for exceptions
+// not serviced by faultHandler.
 func systemException(pc uintptr) {
 	SystemExceptionHandler(pc)
 }
@@ -78,19 +236,27 @@ func addJumps(addr uint64) {
 	addJump(addr, handleException)
 }
 
+// SetExceptionHandler updates the CPU synchronous exception vectors, for
+// exceptions taken from the current exception level, with the address of the
+// argument function.
+func (cpu *CPU) SetExceptionHandler(fn func()) {
+	addJump(cpu.vbar, fn)
+	addJump(cpu.vbar+0x200, fn)
+}
+
 //go:nosplit
 func (cpu *CPU) initVectorTable() {
 	// 2048-bytes alignment is required
-	vectorTable := uint64(goos.RamStart)
+	cpu.vbar = uint64(goos.RamStart)
 
 	// initialize jump tables
 	// Table D1-7 ARM Architecture Reference Manual ARMv8
 
 	// EL0
-	addJumps(vectorTable)
+	addJumps(cpu.vbar)
 	// ELx, x>0
-	addJumps(vectorTable + 0x200)
+	addJumps(cpu.vbar + 0x200)
 
 	// set vector base address register
-	set_vbar(vectorTable)
+	set_vbar(cpu.vbar)
 }
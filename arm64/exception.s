@@ -6,13 +6,135 @@
 // Use of this source code is governed by the license
 // that can be found in the LICENSE file.
 
+#include "go_asm.h"
 #include "textflag.h"
 
+// EXCEPTION_CONTEXT sets R0 to the exception context address for the core in
+// R1 and nesting level in R3, R2 is clobbered.
+#define EXCEPTION_CONTEXT				\
+	MOVD	$const_excNesting, R0			\
+	MUL	R0, R1, R0				\
+	ADD	R3, R0, R0				\
+	MOVD	$ExceptionContext__size, R2		\
+	MUL	R2, R0, R0				\
+	MOVD	$·excContexts(SB), R2			\
+	ADD	R2, R0, R0
+
+// EXCEPTION_LEVEL sets R1 to the calling core, R2 to its nesting level
+// address and R3 to its nesting level.
+#define EXCEPTION_LEVEL					\
+	MRS	MPIDR_EL1, R1				\
+	AND	$0xff, R1, R1				\
+	MOVD	$·excLevel(SB), R2			\
+	ADD	R1<<3, R2, R2				\
+	MOVD	(R2), R3
+
 TEXT ·handleException(SB),NOSPLIT|NOFRAME,$0
-	MRS	ELR_EL1, R0
-	MOVD	R0, 8(RSP)	// arg
+	// save caller registers
+	SUB	$32, RSP
+	STP	(R0, R1), (RSP)
+	STP	(R2, R3), 16(RSP)
+
+	// increment nesting level, halt when exceeded
+	EXCEPTION_LEVEL
+	CMP	$const_maxCores, R1
+	BHS	halt
+	CMP	$const_excNesting, R3
+	BHS	halt
+	ADD	$1, R3, R0
+	MOVD	R0, (R2)
+
+	// save exception context
+	EXCEPTION_CONTEXT
+	STP	(R4, R5), (ExceptionContext_R+4*8)(R0)
+	STP	(R6, R7), (ExceptionContext_R+6*8)(R0)
+	STP	(R8, R9), (ExceptionContext_R+8*8)(R0)
+	STP	(R10, R11), (ExceptionContext_R+10*8)(R0)
+	STP	(R12, R13), (ExceptionContext_R+12*8)(R0)
+	STP	(R14, R15), (ExceptionContext_R+14*8)(R0)
+	STP	(R16, R17), (ExceptionContext_R+16*8)(R0)
+	STP	(R18_PLATFORM, R19), (ExceptionContext_R+18*8)(R0)
+	STP	(R20, R21), (ExceptionContext_R+20*8)(R0)
+	STP	(R22, R23), (ExceptionContext_R+22*8)(R0)
+	STP	(R24, R25), (ExceptionContext_R+24*8)(R0)
+	STP	(R26, R27), (ExceptionContext_R+26*8)(R0)
+	STP	(g, R29), (ExceptionContext_R+28*8)(R0)
+	MOVD	R30, (ExceptionContext_R+30*8)(R0)
+
+	LDP	(RSP), (R1, R2)
+	STP	(R1, R2), (ExceptionContext_R)(R0)
+	LDP	16(RSP), (R1, R2)
+	STP	(R1, R2), (ExceptionContext_R+2*8)(R0)
+
+	ADD	$32, RSP, R1
+	MOVD	R1, ExceptionContext_SP(R0)
+	MRS	ELR_EL1, R1
+	MOVD	R1, ExceptionContext_PC(R0)
+	MRS	SPSR_EL1, R1
+	MOVD	R1, ExceptionContext_PSTATE(R0)
+	MRS	ESR_EL1, R1
+	MOVD	R1, ExceptionContext_ESR(R0)
+	MRS	FAR_EL1, R1
+	MOVD	R1, ExceptionContext_FAR(R0)
+
+	// call fault handlers on system stack (g0)
+	MOVD	$·faultHandlerFn(SB), R1
+	MOVD	(R1), R1
+	MOVD	R1, 8(RSP)
+	CALL	runtime·systemstack(SB)
+
+	// decrement nesting level
+	EXCEPTION_LEVEL
+	SUB	$1, R3, R3
+	MOVD	R3, (R2)
+	EXCEPTION_CONTEXT
+
+	MOVBU	ExceptionContext_handled(R0), R1
+	CBZ	R1, unhandled
+
+	// restore exception context, stack pointer changes are not supported
+	MOVD	ExceptionContext_PC(R0), R1
+	MSR	R1, ELR_EL1
+	MOVD	ExceptionContext_PSTATE(R0), R1
+	MSR	R1, SPSR_EL1
+
+	LDP	(ExceptionContext_R+2*8)(R0), (R2, R3)
+	LDP	(ExceptionContext_R+4*8)(R0), (R4, R5)
+	LDP	(ExceptionContext_R+6*8)(R0), (R6, R7)
+	LDP	(ExceptionContext_R+8*8)(R0), (R8, R9)
+	LDP	(ExceptionContext_R+10*8)(R0), (R10, R11)
+	LDP	(ExceptionContext_R+12*8)(R0), (R12, R13)
+	LDP	(ExceptionContext_R+14*8)(R0), (R14, R15)
+	LDP	(ExceptionContext_R+16*8)(R0), (R16, R17)
+	LDP	(ExceptionContext_R+18*8)(R0), (R18_PLATFORM, R19)
+	LDP	(ExceptionContext_R+20*8)(R0), (R20, R21)
+	LDP	(ExceptionContext_R+22*8)(R0), (R22, R23)
+	LDP	(ExceptionContext_R+24*8)(R0), (R24, R25)
+	LDP	(ExceptionContext_R+26*8)(R0), (R26, R27)
+	LDP	(ExceptionContext_R+28*8)(R0), (g, R29)
+	MOVD	(ExceptionContext_R+30*8)(R0), R30
+	MOVD	(ExceptionContext_R+1*8)(R0), R1
+	MOVD	(ExceptionContext_R)(R0), R0
+
+	// restore stack pointer
+	ADD	$32, RSP
+
+	// exception return
+	ERET
+
+unhandled:
+	// invoke default handler on the faulting goroutine stack
+	MOVD	(ExceptionContext_R+30*8)(R0), R30
+	MOVD	ExceptionContext_PC(R0), R1
+	ADD	$32, RSP
+	MOVD	R1, 8(RSP)	// arg
 	JMP	·systemException(SB)
 
+halt:
+	// nested exceptions exceeding excNesting are not recoverable
+	WFI
+	B	halt
+
 // func set_vbar(addr uint64)
 TEXT ·set_vbar(SB),NOSPLIT,$0
 	MOVD	addr+0(FP), R0
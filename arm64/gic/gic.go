@@ -50,11 +50,30 @@ const (
 	RD_BASE  = 0x00000
 	SGI_BASE = 0x10000
 
+	GICR_TYPER     = RD_BASE + 0x0008
+	TYPER_AFFINITY = 32
+	TYPER_LAST     = 4
+	TYPER_VLPIS    = 1
+
 	GICR_WAKER            = RD_BASE + 0x0014
 	WAKER_CHILDREN_ASLEEP = 2
 	WAKER_PROCESSOR_SLEEP = 1
 
 	GICR_IGROUPR = SGI_BASE + 0x0080
+
+	// Redistributor stride without/with virtual LPIs support
+	rdStride     = 0x20000
+	rdStrideVLPI = 0x40000
+)
+
+// ICC_SGI0R_EL1 bit positions
+// (12.2.23 ICC_SGI0R_EL1, ARM IHI 0069G).
+const (
+	SGIR_AFF3        = 48
+	SGIR_AFF2        = 32
+	SGIR_INTID       = 24
+	SGIR_AFF1        = 16
+	SGIR_TARGET_LIST = 0
 )
 
 const (
@@ -68,7 +87,7 @@ const (
 type GIC struct {
 	// GIC Distributor base address
 	GICD uint32
-	// GIC Redistributor base address
+	// GIC Redistributor base address (first core frame)
 	GICR uint32
 
 	// core identifier
@@ -82,6 +101,7 @@ func write_icc_pmr_el1(val uint64)
 func read_icc_iar0() uint64
 func read_mpidr_el1() uint64
 func write_icc_eoir0(val uint64)
+func write_icc_sgi0r_el1(val uint64)
 
 // InitGIC initializes an ARM Generic Interrupt Controller (GICv3) instance.
 func (hw *GIC) Init() {
@@ -89,13 +109,6 @@ func (hw *GIC) Init() {
 		panic("invalid GIC instance")
 	}
 
-	// Mark CPU as being online
-	reg.Clear(hw.GICR+GICR_WAKER, WAKER_PROCESSOR_SLEEP)
-
-	if !reg.WaitFor(1*time.Second, hw.GICR+GICR_WAKER, WAKER_CHILDREN_ASLEEP, 1, 0) {
-		panic("could not wake GICR")
-	}
-
 	// Get the maximum number of external interrupt lines
 	itLinesNum := reg.GetN(hw.GICD+GICD_TYPER, TYPER_ITLINES, 0x1f)
 
@@ -112,6 +125,36 @@ func (hw *GIC) Init() {
 		reg.Write(addr, 0xffffffff)
 	}
 
+	hw.InitRedistributor()
+
+	// Enable Group0 interrupts (Distributor)
+	reg.Set(hw.GICD+GICD_CTLR, CTLR_ENABLEGRP0)
+
+	// Enable affinity routing
+	reg.Set(hw.GICD+GICD_CTLR, CTLR_ARE_NS)
+	reg.Set(hw.GICD+GICD_CTLR, CTLR_ARE_S)
+
+	// Cache core identifier
+	hw.mpidr = read_mpidr_el1()
+}
+
+// InitRedistributor initializes the Redistributor and CPU interface of the
+// calling core, it is invoked by [GIC.Init] and must be invoked on each
+// secondary core before enabling its private interrupts (SGIs, PPIs).
+func (hw *GIC) InitRedistributor() {
+	rd := hw.redistributor()
+
+	if rd == 0 {
+		panic("could not find GICR")
+	}
+
+	// Mark CPU as being online
+	reg.Clear(rd+GICR_WAKER, WAKER_PROCESSOR_SLEEP)
+
+	if !reg.WaitFor(1*time.Second, rd+GICR_WAKER, WAKER_CHILDREN_ASLEEP, 1, 0) {
+		panic("could not wake GICR")
+	}
+
 	// Enable system register interface
 	write_icc_sre_el1(1)
 
@@ -120,16 +163,33 @@ func (hw *GIC) Init() {
 
 	// Enable Group0 interrupts (CPU interface)
 	write_icc_igrpen0_el1(1)
+}
 
-	// Enable Group0 interrupts (Distributor)
-	reg.Set(hw.GICD+GICD_CTLR, CTLR_ENABLEGRP0)
+// redistributor returns the Redistributor frame of the calling core, or zero
+// if not found.
+func (hw *GIC) redistributor() uint32 {
+	mpidr := read_mpidr_el1()
+	aff := (mpidr>>32&0xff)<<24 | mpidr&0xffffff
 
-	// Enable affinity routing
-	reg.Set(hw.GICD+GICD_CTLR, CTLR_ARE_NS)
-	reg.Set(hw.GICD+GICD_CTLR, CTLR_ARE_S)
+	for rd := hw.GICR; rd != 0; {
+		typer := reg.Read64(uint64(rd + GICR_TYPER))
 
-	// Cache core identifier
-	hw.mpidr = read_mpidr_el1()
+		if typer>>TYPER_AFFINITY == aff {
+			return rd
+		}
+
+		if typer&(1<<TYPER_LAST) != 0 {
+			break
+		}
+
+		if typer&(1<<TYPER_VLPIS) != 0 {
+			rd += rdStrideVLPI
+		} else {
+			rd += rdStride
+		}
+	}
+
+	return 0
 }
 
 func (hw *GIC) irq(m int, enable bool) {
@@ -138,12 +198,21 @@ func (hw *GIC) irq(m int, enable bool) {
 	}
 
 	var off uint32
+	var rd uint32
+
 	n := uint32(m / 32)
 	i := m % 32
 
+	if m < firstSPI {
+		// private interrupts are handled by the calling core frame
+		if rd = hw.redistributor(); rd == 0 {
+			return
+		}
+	}
+
 	if enable {
 		if m < firstSPI {
-			reg.Clear(hw.GICR+GICR_IGROUPR+4*n, i)
+			reg.Clear(rd+GICR_IGROUPR+4*n, i)
 		} else {
 			// route to core identified at initialization
 			reg.Write64(uint64(hw.GICD+GICD_IROUTER)+uint64(8*m), hw.mpidr)
@@ -157,7 +226,7 @@ func (hw *GIC) irq(m int, enable bool) {
 	}
 
 	if m < firstSPI {
-		reg.SetTo(hw.GICR+SGI_BASE+off+4*n, i, true)
+		reg.SetTo(rd+SGI_BASE+off+4*n, i, true)
 	} else {
 		reg.SetTo(hw.GICD+off+4*n, i, true)
 	}
@@ -175,6 +244,27 @@ func (hw *GIC) DisableInterrupt(id int) {
 	hw.irq(id, false)
 }
 
+// ClearPending clears the pending state of the corresponding interrupt,
+// without acknowledging other signaled interrupts (see [GIC.GetInterrupt]).
+func (hw *GIC) ClearPending(id int) {
+	if hw.GICD == 0 {
+		return
+	}
+
+	n := uint32(id / 32)
+	i := id % 32
+
+	if id >= firstSPI {
+		reg.SetTo(hw.GICD+GICD_ICPENDR+4*n, i, true)
+		return
+	}
+
+	// private interrupts are handled by the calling core frame
+	if rd := hw.redistributor(); rd != 0 {
+		reg.SetTo(rd+SGI_BASE+GICD_ICPENDR+4*n, i, true)
+	}
+}
+
 // GetInterrupt obtains and acknowledges a signaled interrupt.
 func (hw *GIC) GetInterrupt() (id int) {
 	if hw.GICD == 0 {
@@ -189,3 +279,22 @@ func (hw *GIC) GetInterrupt() (id int) {
 
 	return int(m)
 }
+
+// SendSGI generates a Software Generated Interrupt (SGI), as Group0 interrupt,
+// to the argument core within the same cluster of the calling core.
+func (hw *GIC) SendSGI(id int, core int) {
+	if hw.GICD == 0 || id >= firstPPI {
+		return
+	}
+
+	mpidr := read_mpidr_el1()
+	aff1 := (mpidr >> 8) & 0xff
+	aff2 := (mpidr >> 16) & 0xff
+	aff3 := (mpidr >> 32) & 0xff
+
+	val := aff3<<SGIR_AFF3 | aff2<<SGIR_AFF2 | aff1<<SGIR_AFF1
+	val |= uint64(id&0xf) << SGIR_INTID
+	val |= 1 << (uint64(core&0xf) + SGIR_TARGET_LIST)
+
+	write_icc_sgi0r_el1(val)
+}
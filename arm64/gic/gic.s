@@ -67,3 +67,13 @@ TEXT ·write_icc_eoir0(SB),$0-8
 	ISB	SY
 
 	RET
+
+// func write_icc_sgi0r_el1(val uint64)
+TEXT ·write_icc_sgi0r_el1(SB),$0-8
+	// ARM IHI 0069G
+	// 12.2.23 ICC_SGI0R_EL1, Interrupt Controller Software Generated Interrupt Group 0 Register
+	MOVD	val+0(FP), R0
+	MSR	R0, ICC_SGI0R_EL1
+	ISB	SY
+
+	RET
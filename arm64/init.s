@@ -9,6 +9,7 @@
 //go:build !linkcpuinit
 
 #include "arm64.h"
+#include "go_asm.h"
 #include "textflag.h"
 
 TEXT cpuinit(SB),NOSPLIT|NOFRAME,$0
@@ -31,6 +32,16 @@ TEXT cpuinit(SB),NOSPLIT|NOFRAME,$0
 	// ARM Architecture Reference Manual ARMv8, for ARMv8-A architecture
 	// profile.
 
+	// Install the EL3 exception vectors and stack to service Secure
+	// Monitor Calls (see CPU.Boot).
+	MOVD	$·el3Vectors(SB), R0
+	WORD	$0xd51ec000	// msr VBAR_EL3, x0
+	MOVD	$·monitorStack(SB), R0
+	ADD	$const_monitorStackSize, R0, R0
+	AND	$~15, R0, R0
+	MSR	$1, SPSel
+	MOVD	R0, RSP
+
 	// D12.2.99 SCR_EL3, Secure Configuration Register
 	MOVD	$0, R0
 	ORR	$1<<10, R0	// set lower levels as AArch64
@@ -45,6 +45,14 @@ TEXT ·handleInterrupt(SB),NOSPLIT|NOFRAME,$0
 	MOVD	NZCV, R0
 	MOVD	R0, -(16*16)(RSP)
 
+	// sample interrupted call stack for profiling
+	SUB	$(18*16), RSP
+	MRS	ELR_EL1, R0
+	MOVD	R0, 8(RSP)
+	MOVD	R29, 16(RSP)
+	CALL	·irqSample(SB)
+	ADD	$(18*16), RSP
+
 	SUB	$(17*16), RSP
 	MOVD	$(const_IRQ_SIGNAL), R0
 	MOVD	R0, 8(RSP)
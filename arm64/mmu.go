@@ -55,6 +55,12 @@ const (
 	deviceAttributeIndex = 0
 	memoryAttributeIndex = 1
 
+	// memory region attributes
+	//   * attr0: device
+	//   * attr1: memory
+	mair = MemoryRegion<<(8*memoryAttributeIndex) |
+		DeviceRegion<<(8*deviceAttributeIndex)
+
 	deviceAttributes = 1<<TTE_AF | TTE_OUTER_SH | TTE_AP_00<<TTE_AP | deviceAttributeIndex<<TTE_ATTR
 	memoryAttributes = 1<<TTE_AF | TTE_INNER_SH | TTE_AP_00<<TTE_AP | memoryAttributeIndex<<TTE_ATTR
 )
@@ -234,11 +240,7 @@ func (cpu *CPU) InitMMU() {
 	cpu.initL3Table(1, l3pageTableStart, 0)
 
 	// set memory region attributes
-	//   * attr0: device
-	//   * attr1: memory
-	write_mair_el1(
-		MemoryRegion<<(8*memoryAttributeIndex) |
-			DeviceRegion<<(8*deviceAttributeIndex))
+	write_mair_el1(mair)
 
 	// set translation control register
 	write_tcr_el1(tcr)
@@ -0,0 +1,376 @@
+// ARM64 processor support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package arm64
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// SMC Calling Convention function identifier fields and architecture calls
+// (Arm SMC Calling Convention - DEN0028).
+const (
+	SMCCC_FAST_CALL = 31
+	SMCCC_64        = 30
+	SMCCC_OWNER     = 24
+	SMCCC_FUNCTION  = 0
+
+	SMCCC_VERSION       = 0x80000000
+	SMCCC_ARCH_FEATURES = 0x80000001
+
+	// Unknown Function Identifier
+	SMC_UNK = -1
+)
+
+// SMC Calling Convention service owners
+const (
+	OWNER_ARCH     = 0
+	OWNER_CPU      = 1
+	OWNER_SIP      = 2
+	OWNER_OEM      = 3
+	OWNER_STANDARD = 4
+	OWNER_HYP      = 5
+)
+
+const (
+	// SMC Calling Convention v1.1
+	smcccVersion = 1<<16 | 1
+	// PSCI v1.1
+	psciVersion = 1<<16 | 1
+
+	// PSCI MIGRATE_INFO_TYPE: Trusted OS not present
+	psciNoTrustedOS = 2
+
+	// EL3 stack size, used only to save registers on exception entry
+	monitorStackSize = 0x100
+
+	// monitor states
+	monitorIdle    = 0
+	monitorBooting = 1
+	monitorRunning = 2
+
+	// ARM Architecture Reference Manual ARMv8, for ARMv8-A architecture profile
+	// D12.2.104 TCR_EL3, Translation Control Register (EL3).
+	TCR_EL3_PS = 16
+
+	// EL1 translation settings applied to EL3 (see tcr)
+	tcrEL3 uint64 = 1<<31 | 1<<23 |
+		// 40-bit physical address size
+		0b010<<TCR_EL3_PS |
+		tcr&0xffff
+)
+
+// defined in monitor.s
+func monitor_boot(fid uint64) uint64
+
+// SMCContext represents the lower exception level state captured on Secure
+// Monitor Calls.
+type SMCContext struct {
+	// X holds general purpose registers x0-x30, x0 holds the function
+	// identifier on entry while x0-x17 are used for arguments and results.
+	X [31]uint64
+	// PC holds the Exception Link Register (ELR_EL3).
+	PC uint64
+	// PSTATE holds the Saved Program Status Register (SPSR_EL3).
+	PSTATE uint64
+}
+
+// FunctionID returns the Secure Monitor Call function identifier.
+func (ctx *SMCContext) FunctionID() uint32 {
+	return uint32(ctx.X[0])
+}
+
+// SMC64 returns whether the SMC64 calling convention is used.
+func (ctx *SMCContext) SMC64() bool {
+	return ctx.FunctionID()&(1<<SMCCC_64) != 0
+}
+
+// Arg returns the argument Secure Monitor Call parameter (starting from x1),
+// truncated to 32 bits for the SMC32 calling convention.
+func (ctx *SMCContext) Arg(n int) uint64 {
+	if ctx.SMC64() {
+		return ctx.X[1+n]
+	}
+
+	return ctx.X[1+n] & 0xffffffff
+}
+
+// SetReturn sets the first Secure Monitor Call result (x0), sign extended for
+// return codes.
+func (ctx *SMCContext) SetReturn(ret int64) {
+	ctx.X[0] = uint64(ret)
+}
+
+// SMCHandler represents a Secure Monitor Call service handler, results must be
+// returned in the argument context x0-x17 registers.
+type SMCHandler func(ctx *SMCContext)
+
+// launch represents the non-secure OS launch parameters, read by the EL3
+// exception handler with MMU disabled.
+type launch struct {
+	state uint64 // monitor state
+	ttbr  uint64 // translation table base address
+	entry uint64 // entry point
+	arg   uint64 // x0 argument
+	spsr  uint64 // exception level and state
+}
+
+var (
+	// EL3 stack
+	monitorStack [monitorStackSize]byte
+	// EL3 Secure Monitor Call context
+	smcContext SMCContext
+	// non-secure OS launch parameters
+	monitorLaunch launch
+
+	// EL3 dispatcher goroutine and stack pointer
+	monitorG  uint64
+	monitorSP uint64
+
+	// EL3 dispatcher
+	monitor       *Monitor
+	smcBootFn     = smcBoot
+	smcDispatchFn = smcDispatch
+)
+
+// Monitor represents an EL3 runtime firmware Secure Monitor Call (SMC)
+// dispatcher, which implements the PSCI and SMC Calling Convention
+// architecture calls for a single-core non-secure OS.
+//
+// Additional SiP and OEM services can be registered with [Monitor.Register].
+//
+// Example for booting Linux as tamago BL31 (e.g. LAN969x):
+//
+//	monitor := &arm64.Monitor{
+//		SystemReset: lan969x.Reset,
+//	}
+//
+//	monitor.Register(arm64.OWNER_SIP, sipHandler)
+//
+//	// copy kernel and device tree, clean data cache
+//	ARM64.Boot(monitor, kernelEntry, dtbAddress, 2)
+type Monitor struct {
+	// SystemOff is the platform specific PSCI SYSTEM_OFF implementation,
+	// when not set or on return the calling core is halted.
+	SystemOff func()
+	// SystemReset is the platform specific PSCI SYSTEM_RESET
+	// implementation, when not set or on return the calling core is halted.
+	SystemReset func()
+
+	// Protect is an optional platform specific function, executed at EL3
+	// right before entering the non-secure OS, to restrict its access to
+	// tamago memory (e.g. TZC region configured as Secure only). At EL3
+	// tamago memory is accessed in Secure state.
+	Protect func()
+
+	services [64]SMCHandler
+}
+
+// Register sets the argument function as handler for all Secure Monitor Calls
+// issued to the argument service owner, only SiP and OEM services can be
+// registered.
+//
+// Handlers are executed at EL3 on a stopped Go scheduler, therefore they must
+// not block, allocate memory or use goroutines.
+func (m *Monitor) Register(owner int, fn SMCHandler) error {
+	if owner != OWNER_SIP && owner != OWNER_OEM {
+		return errors.New("invalid service owner")
+	}
+
+	m.services[owner] = fn
+
+	return nil
+}
+
+func (m *Monitor) handle(ctx *SMCContext) {
+	fid := ctx.FunctionID()
+
+	if fid&(1<<SMCCC_FAST_CALL) == 0 {
+		// yielding calls are not supported
+		ctx.SetReturn(SMC_UNK)
+		return
+	}
+
+	switch owner := (fid >> SMCCC_OWNER) & 0x3f; owner {
+	case OWNER_ARCH:
+		m.arch(ctx)
+	case OWNER_STANDARD:
+		m.psci(ctx)
+	default:
+		if fn := m.services[owner]; fn != nil {
+			fn(ctx)
+		} else {
+			ctx.SetReturn(SMC_UNK)
+		}
+	}
+}
+
+func (m *Monitor) arch(ctx *SMCContext) {
+	var ret int64
+
+	switch ctx.FunctionID() {
+	case SMCCC_VERSION:
+		ret = smcccVersion
+	case SMCCC_ARCH_FEATURES:
+		switch uint32(ctx.Arg(0)) {
+		case SMCCC_VERSION, SMCCC_ARCH_FEATURES:
+			ret = 0
+		default:
+			ret = SMC_UNK
+		}
+	default:
+		ret = SMC_UNK
+	}
+
+	ctx.SetReturn(ret)
+}
+
+// smc32 returns the SMC32 form of a function identifier.
+func smc32(fid uint32) uint32 {
+	return fid &^ (1 << SMCCC_64)
+}
+
+// self returns whether the argument MPIDR affinity value matches the calling
+// core.
+func self(mpidr uint64) bool {
+	return mpidr&0xff00ffffff == read_mpidr()&0xff00ffffff
+}
+
+func halt(fn func()) {
+	if fn != nil {
+		fn()
+	}
+
+	for {
+		wfi()
+	}
+}
+
+func (m *Monitor) psci(ctx *SMCContext) {
+	var ret int64
+
+	switch smc32(ctx.FunctionID()) {
+	case PSCI_VERSION:
+		ret = psciVersion
+	case smc32(PSCI_CPU_SUSPEND):
+		// standby until the next interrupt, which is serviced once
+		// back to the lower exception level
+		wfi()
+	case PSCI_CPU_OFF:
+		// the last running core cannot be powered down
+		ret = PSCI_DENIED
+	case smc32(PSCI_CPU_ON):
+		if self(ctx.Arg(0)) {
+			ret = PSCI_ALREADY_ON
+		} else {
+			ret = PSCI_INVALID_PARAMETERS
+		}
+	case smc32(PSCI_AFFINITY_INFO):
+		if !self(ctx.Arg(0)) {
+			ret = PSCI_INVALID_PARAMETERS
+		}
+	case PSCI_MIGRATE_INFO_TYPE:
+		ret = psciNoTrustedOS
+	case PSCI_SYSTEM_OFF:
+		halt(m.SystemOff)
+	case PSCI_SYSTEM_RESET:
+		halt(m.SystemReset)
+	case PSCI_FEATURES:
+		switch smc32(uint32(ctx.Arg(0))) {
+		case PSCI_VERSION, smc32(PSCI_CPU_SUSPEND), PSCI_CPU_OFF,
+			smc32(PSCI_CPU_ON), smc32(PSCI_AFFINITY_INFO),
+			PSCI_MIGRATE_INFO_TYPE, PSCI_SYSTEM_OFF,
+			PSCI_SYSTEM_RESET, PSCI_FEATURES, SMCCC_VERSION:
+			ret = PSCI_SUCCESS
+		default:
+			ret = PSCI_NOT_SUPPORTED
+		}
+	default:
+		ret = PSCI_NOT_SUPPORTED
+	}
+
+	ctx.SetReturn(ret)
+}
+
+// smcBoot is executed by the EL3 exception handler, on the system stack (g0)
+// of the goroutine which invoked [CPU.Boot], before entering the non-secure
+// OS.
+func smcBoot() {
+	if monitor.Protect != nil {
+		monitor.Protect()
+	}
+}
+
+// smcDispatch is executed by the EL3 exception handler, on the system stack
+// (g0) of the goroutine which invoked [CPU.Boot], to service Secure Monitor
+// Calls.
+func smcDispatch() {
+	monitor.handle(&smcContext)
+}
+
+// Boot launches a non-secure OS (e.g. Linux) at the argument exception level
+// (2 or 1) and entry point, with the argument value in x0 (e.g. device tree
+// address), using the argument monitor to service its Secure Monitor Calls.
+//
+// The function requires tamago to be loaded as EL3 runtime firmware (e.g.
+// BL31), and therefore entered at EL3 by cpuinit, it must be invoked after
+// [CPU.InitMMU] and after the OS image and arguments have been cleaned from
+// the data cache (see [CPU.CleanDataCacheRange]).
+//
+// On success the function never returns as the calling core is handed over
+// to the non-secure OS, Secure Monitor Calls are then serviced at EL3 on the
+// calling goroutine system stack (g0).
+//
+// The tamago image remains mapped in the same physical memory, which must be
+// protected from the non-secure OS (see [Monitor.Protect] and device tree
+// `/reserved-memory` node) to prevent it from altering EL3 code and data. As
+// tamago runs in Non-secure EL1 until then, such protection cannot be applied
+// before invoking Boot.
+func (cpu *CPU) Boot(m *Monitor, entry uint64, arg uint64, el int) error {
+	var spsr uint64
+
+	switch el {
+	case 1:
+		spsr = 0b0101 // EL1h
+	case 2:
+		spsr = 0b1001 // EL2h
+	default:
+		return errors.New("invalid exception level")
+	}
+
+	if m == nil || entry == 0 {
+		return errors.New("invalid argument")
+	}
+
+	// mask exceptions/interrupts
+	spsr |= 0b1111 << 6
+
+	monitor = m
+
+	monitorLaunch = launch{
+		state: monitorBooting,
+		ttbr:  cpu.vbar + l1pageTableOffset,
+		entry: entry,
+		arg:   arg,
+		spsr:  spsr,
+	}
+
+	// the EL3 exception handler starts with caches and MMU disabled
+	cpu.CleanDataCacheRange(uint(uintptr(unsafe.Pointer(&monitorLaunch))), int(unsafe.Sizeof(monitorLaunch)))
+
+	irq_disable()
+
+	// on success the EL3 exception handler switches to the non-secure OS
+	monitor_boot(SMCCC_VERSION)
+
+	monitorLaunch.state = monitorIdle
+	irq_enable()
+
+	return errors.New("EL3 monitor not available")
+}
@@ -0,0 +1,264 @@
+// ARM64 processor support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "arm64.h"
+#include "go_asm.h"
+#include "textflag.h"
+
+// ARM Architecture Reference Manual ARMv8, for ARMv8-A architecture profile
+// D1.10.2 Exception vectors, Table D1-7.
+TEXT ·el3Vectors(SB),NOSPLIT|NOFRAME,$0
+	// 2048-bytes alignment is required
+	PCALIGN	$2048
+
+	// current EL with SP0: Synchronous, IRQ, FIQ, SError
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+
+	// current EL with SPx: Synchronous, IRQ, FIQ, SError
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+
+	// lower EL using AArch64: Synchronous, IRQ, FIQ, SError
+	PCALIGN	$128
+	B	·el3Sync(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+
+	// lower EL using AArch32: Synchronous, IRQ, FIQ, SError
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+	PCALIGN	$128
+	B	·el3Halt(SB)
+
+TEXT ·el3Halt(SB),NOSPLIT|NOFRAME,$0
+	WFI
+	B	·el3Halt(SB)
+
+// func monitor_boot(fid uint64) uint64
+TEXT ·monitor_boot(SB),NOSPLIT,$0-16
+	// save dispatcher goroutine and stack pointer
+	MOVD	g, ·monitorG(SB)
+	MOVD	RSP, R0
+	MOVD	R0, ·monitorSP(SB)
+	DSB	SY
+
+	MOVD	fid+0(FP), R0
+	SMC	$0
+
+	// only reached without EL3 monitor
+	MOVD	R0, ret+8(FP)
+	RET
+
+TEXT ·el3Sync(SB),NOSPLIT|NOFRAME,$0
+	// save caller registers
+	SUB	$16, RSP
+	STP	(R0, R1), (RSP)
+
+	// save Secure Monitor Call context
+	MOVD	$·smcContext(SB), R0
+	STP	(R2, R3), (SMCContext_X+2*8)(R0)
+	STP	(R4, R5), (SMCContext_X+4*8)(R0)
+	STP	(R6, R7), (SMCContext_X+6*8)(R0)
+	STP	(R8, R9), (SMCContext_X+8*8)(R0)
+	STP	(R10, R11), (SMCContext_X+10*8)(R0)
+	STP	(R12, R13), (SMCContext_X+12*8)(R0)
+	STP	(R14, R15), (SMCContext_X+14*8)(R0)
+	STP	(R16, R17), (SMCContext_X+16*8)(R0)
+	STP	(R18_PLATFORM, R19), (SMCContext_X+18*8)(R0)
+	STP	(R20, R21), (SMCContext_X+20*8)(R0)
+	STP	(R22, R23), (SMCContext_X+22*8)(R0)
+	STP	(R24, R25), (SMCContext_X+24*8)(R0)
+	STP	(R26, R27), (SMCContext_X+26*8)(R0)
+	STP	(g, R29), (SMCContext_X+28*8)(R0)
+	MOVD	R30, (SMCContext_X+30*8)(R0)
+
+	LDP	(RSP), (R1, R2)
+	STP	(R1, R2), (SMCContext_X)(R0)
+	ADD	$16, RSP
+
+	WORD	$0xd53e4021	// mrs x1, ELR_EL3
+	MOVD	R1, SMCContext_PC(R0)
+	WORD	$0xd53e4001	// mrs x1, SPSR_EL3
+	MOVD	R1, SMCContext_PSTATE(R0)
+
+	// only Secure Monitor Calls are serviced
+	WORD	$0xd53e5201	// mrs x1, ESR_EL3
+	LSR	$26, R1, R1
+	CMP	$const_EC_SMC, R1
+	BEQ	smc
+	CMP	$const_EC_SMC_32, R1
+	BEQ	smc
+	B	·el3Halt(SB)
+smc:
+	MOVD	$·monitorLaunch(SB), R2
+	MOVD	launch_state(R2), R1
+	CMP	$const_monitorRunning, R1
+	BEQ	dispatch
+	CMP	$const_monitorBooting, R1
+	BEQ	boot
+
+	// no monitor, return Unknown Function Identifier
+	MOVD	$const_SMC_UNK, R1
+	MOVD	R1, (SMCContext_X)(R0)
+	B	restore
+boot:
+	// ARM Architecture Reference Manual ARMv8, for ARMv8-A architecture
+	// profile.
+
+	// apply EL1 translation tables to EL3 (see CPU.InitMMU)
+	MOVD	$const_mair, R1
+	WORD	$0xd51ea201	// msr MAIR_EL3, x1
+	MOVD	$const_tcrEL3, R1
+	WORD	$0xd51e2041	// msr TCR_EL3, x1
+	MOVD	launch_ttbr(R2), R1
+	WORD	$0xd51e2001	// msr TTBR0_EL3, x1
+	DSB	SY
+	ISB	SY
+
+	WORD	$0xd50e871f	// tlbi alle3
+	DSB	SY
+	ISB	SY
+
+	// D12.2.102 SCTLR_EL3, System Control Register (EL3)
+	WORD	$0xd53e1001	// mrs x1, SCTLR_EL3
+	BIC	$1<<19, R1	// clear WXN bit
+	BIC	$1<<1, R1	// clear A bit
+	ORR	$1<<12, R1	// enable I-cache
+	ORR	$1<<2, R1	// enable D-cache
+	ORR	$1<<0, R1	// enable MMU
+	WORD	$0xd51e1001	// msr SCTLR_EL3, x1
+	ISB	SY
+
+	// switch to the goroutine which invoked CPU.Boot
+	MOVD	·monitorSP(SB), R1
+	SUB	$16, R1
+	MOVD	R1, RSP
+	MOVD	·monitorG(SB), g
+	MOVD	ZR, R29
+
+	// call platform protection on system stack (g0)
+	MOVD	$·smcBootFn(SB), R1
+	MOVD	(R1), R1
+	MOVD	R1, 8(RSP)
+	CALL	runtime·systemstack(SB)
+
+	// restore EL3 stack
+	MOVD	$·monitorStack(SB), R0
+	ADD	$const_monitorStackSize, R0, R0
+	AND	$~15, R0, R0
+	MOVD	R0, RSP
+
+	MOVD	$·smcContext(SB), R0
+	MOVD	$·monitorLaunch(SB), R2
+
+	// D12.2.99 SCR_EL3, Secure Configuration Register
+	MOVD	$0, R1
+	ORR	$1<<10, R1	// set lower levels as AArch64
+	ORR	$1<<8, R1	// enable HVC
+	ORR	$1<<5, R1	// set reserved bit
+	ORR	$1<<4, R1	// set reserved bit
+	ORR	$1<<0, R1	// set Non-secure state
+	WORD	$0xd51e1101	// msr SCR_EL3, x1
+
+	// D12.2.44 HCR_EL2, Hypervisor Configuration Register
+	MOVD	$1<<31, R1	// set EL1 level as AArch64
+	WORD	$0xd51c1101	// msr HCR_EL2, x1
+
+	// D12.8.3 CNTHCTL_EL2, Counter-timer Hypervisor Control register
+	MOVD	$0b11, R1	// grant EL1 physical counter/timer access
+	WORD	$0xd51ce101	// msr CNTHCTL_EL2, x1
+	WORD	$0xd51ce07f	// msr CNTVOFF_EL2, xzr
+
+	// reset lower levels MMU and caches (RES1 bits only)
+	MOVD	$0x30c50830, R1
+	WORD	$0xd51c1001	// msr SCTLR_EL2, x1
+	MOVD	$0x30d00800, R1
+	MSR	R1, SCTLR_EL1
+	ISB	SY
+
+	// return to non-secure OS entry point with x0 argument
+	MOVD	launch_entry(R2), R1
+	MOVD	R1, SMCContext_PC(R0)
+	MOVD	launch_spsr(R2), R1
+	MOVD	R1, SMCContext_PSTATE(R0)
+	MOVD	launch_arg(R2), R1
+	MOVD	R1, (SMCContext_X+0*8)(R0)
+	MOVD	ZR, (SMCContext_X+1*8)(R0)
+	MOVD	ZR, (SMCContext_X+2*8)(R0)
+	MOVD	ZR, (SMCContext_X+3*8)(R0)
+
+	MOVD	$const_monitorRunning, R1
+	MOVD	R1, launch_state(R2)
+	B	restore
+dispatch:
+	// switch to the goroutine which invoked CPU.Boot
+	MOVD	·monitorSP(SB), R1
+	SUB	$16, R1
+	MOVD	R1, RSP
+	MOVD	·monitorG(SB), g
+	MOVD	ZR, R29
+
+	// call dispatcher on system stack (g0), which is never preempted
+	MOVD	$·smcDispatchFn(SB), R1
+	MOVD	(R1), R1
+	MOVD	R1, 8(RSP)
+	CALL	runtime·systemstack(SB)
+
+	// restore EL3 stack
+	MOVD	$·monitorStack(SB), R0
+	ADD	$const_monitorStackSize, R0, R0
+	AND	$~15, R0, R0
+	MOVD	R0, RSP
+
+	MOVD	$·smcContext(SB), R0
+restore:
+	MOVD	SMCContext_PC(R0), R1
+	WORD	$0xd51e4021	// msr ELR_EL3, x1
+	MOVD	SMCContext_PSTATE(R0), R1
+	WORD	$0xd51e4001	// msr SPSR_EL3, x1
+
+	LDP	(SMCContext_X+2*8)(R0), (R2, R3)
+	LDP	(SMCContext_X+4*8)(R0), (R4, R5)
+	LDP	(SMCContext_X+6*8)(R0), (R6, R7)
+	LDP	(SMCContext_X+8*8)(R0), (R8, R9)
+	LDP	(SMCContext_X+10*8)(R0), (R10, R11)
+	LDP	(SMCContext_X+12*8)(R0), (R12, R13)
+	LDP	(SMCContext_X+14*8)(R0), (R14, R15)
+	LDP	(SMCContext_X+16*8)(R0), (R16, R17)
+	LDP	(SMCContext_X+18*8)(R0), (R18_PLATFORM, R19)
+	LDP	(SMCContext_X+20*8)(R0), (R20, R21)
+	LDP	(SMCContext_X+22*8)(R0), (R22, R23)
+	LDP	(SMCContext_X+24*8)(R0), (R24, R25)
+	LDP	(SMCContext_X+26*8)(R0), (R26, R27)
+	LDP	(SMCContext_X+28*8)(R0), (g, R29)
+	MOVD	(SMCContext_X+30*8)(R0), R30
+	MOVD	(SMCContext_X+1*8)(R0), R1
+	MOVD	(SMCContext_X)(R0), R0
+
+	// exception return
+	ERET
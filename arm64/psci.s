@@ -0,0 +1,31 @@
+// ARM64 processor support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func smc(fn uint64, a0 uint64, a1 uint64, a2 uint64) uint64
+TEXT ·smc(SB),$0-40
+	MOVD	fn+0(FP), R0
+	MOVD	a0+8(FP), R1
+	MOVD	a1+16(FP), R2
+	MOVD	a2+24(FP), R3
+
+	SMC	$0
+
+	MOVD	R0, ret+32(FP)
+	RET
+
+// func hvc(fn uint64, a0 uint64, a1 uint64, a2 uint64) uint64
+TEXT ·hvc(SB),$0-40
+	MOVD	fn+0(FP), R0
+	MOVD	a0+8(FP), R1
+	MOVD	a1+16(FP), R2
+	MOVD	a2+24(FP), R3
+
+	HVC	$0
+
+	MOVD	R0, ret+32(FP)
+	RET
@@ -0,0 +1,265 @@
+// ARM64 processor support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package arm64
+
+import (
+	"math"
+	"runtime"
+	"runtime/goos"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"github.com/usbarmory/tamago/internal/reg"
+)
+
+const (
+	// maximum number of cores
+	maxCores = 4
+	// per-core idle stack size
+	coreStackSize = 0x1000
+)
+
+// defined in smp.s
+func read_mpidr() uint64
+func read_l2ctlr() uint64
+func secondaryEntry()
+func wfe()
+func sev()
+
+// task represents a CPU task
+type task struct {
+	sp uint64 // stack pointer
+	gp uint64 // G
+	pc uint64 // fn
+}
+
+var (
+	// secondary cores vector base address
+	smpVBAR uint64
+	// secondary cores timer kernel control
+	smpCNTKCTL uint32
+	// secondary cores ready for a task (counting semaphore)
+	smpReady uint32
+	// secondary cores tasks
+	smpTasks [maxCores]task
+	// secondary cores idle stacks
+	smpStacks [maxCores * coreStackSize]byte
+	// secondary cores control
+	smpControl *SMP
+)
+
+// SMP represents the platform specific control of secondary cores, used for
+// Symmetric Multiprocessing (SMP) operation (see [CPU.InitSMP]).
+//
+// Example for PSCI and GIC SGI based control (e.g. QEMU virt, i.MX8MP):
+//
+//	psci := &arm64.PSCI{}
+//
+//	smp := &arm64.SMP{
+//		Start: psci.Start,
+//		Init: func(_ int) {
+//			GIC.InitRedistributor()
+//			GIC.EnableInterrupt(WAKE_SGI)
+//		},
+//		Signal: func(core int) {
+//			GIC.SendSGI(WAKE_SGI, core)
+//		},
+//		Clear: func(_ int) {
+//			GIC.ClearPending(WAKE_SGI)
+//		},
+//	}
+//
+//	ARM64.InitSMP(-1, smp)
+type SMP struct {
+	// Start releases the argument secondary core, identified by its
+	// affinity level 0, at the argument physical entry address (e.g.
+	// [PSCI.Start]).
+	Start func(core int, entry uint64) error
+
+	// Init is an optional function executed on each core, on the primary
+	// one by [CPU.InitSMP] and on secondary ones before they join the Go
+	// scheduler, to initialize per-core resources (e.g. GIC Redistributor,
+	// wake-up interrupt), it must not allocate memory.
+	Init func(core int)
+
+	// Signal is an optional function which raises a wake-up interrupt on
+	// the argument core (e.g. GIC SGI), idle cores are waiting for it. When not set events (SEV/WFE) are used to wake up cores.
+	Signal func(core int)
+	// Clear is an optional function which acknowledges the wake-up
+	// interrupt raised by Signal on the argument core, it is executed on
+	// that core. As the primary core also services all other interrupts,
+	// Clear must not acknowledge any other signaled interrupt.
+	Clear func(core int)
+}
+
+// NumCPU returns the number of cores within the processor cluster, as reported
+// by the Cortex-A53/Cortex-A57 L2 Control Register.
+func NumCPU() (n int) {
+	if n = int((read_l2ctlr()>>24)&0b11) + 1; n > maxCores {
+		n = maxCores
+	}
+
+	return
+}
+
+// ID returns the processor identifier (MPIDR affinity level 0).
+func (cpu *CPU) ID() uint64 {
+	return read_mpidr() & 0xff
+}
+
+// Task schedules a goroutine on a previously initialized secondary core (see
+// [CPU.InitSMP]).
+//
+// On `GOOS=tamago` Go scheduler M's are never dropped, therefore the function
+// is invoked only once per secondary core (i.e. GOMAXPROCS-1).
+func (cpu *CPU) Task(sp, _, gp, fn unsafe.Pointer) {
+	if sp == nil || gp == nil {
+		return
+	}
+
+	if cpu.init+1 >= runtime.GOMAXPROCS(-1) {
+		panic("Task exceeds available resources")
+	}
+
+	cpu.init += 1
+
+	t := &smpTasks[cpu.init]
+	t.sp = uint64(uintptr(sp))
+	t.gp = uint64(uintptr(gp))
+
+	// the task is picked up only once its entry point is set
+	atomic.StoreUint64(&t.pc, uint64(uintptr(fn)))
+
+	sev()
+}
+
+// SendEvent signals an event to all cores (SEV).
+func (cpu *CPU) SendEvent() {
+	sev()
+}
+
+// Wake issues a wake-up interrupt (see [SMP.Signal]), or event, to the target
+// processor.
+func (cpu *CPU) Wake(procid uint64) {
+	if smpControl != nil && smpControl.Signal != nil {
+		smpControl.Signal(int(procid))
+		return
+	}
+
+	sev()
+}
+
+// smpIdleGovernor is the CPU idle time management function used when SMP is
+// enabled.
+func (cpu *CPU) smpIdleGovernor(pollUntil int64) {
+	// we have nothing to do forever
+	if pollUntil != math.MaxInt64 {
+		return
+	}
+
+	if smpControl.Signal == nil {
+		wfe()
+		return
+	}
+
+	cpu.WaitInterrupt()
+
+	if smpControl.Clear != nil {
+		smpControl.Clear(int(cpu.ID()))
+	}
+}
+
+// secondaryInit is executed on each secondary core, on its Go scheduler M
+// system stack, before its first task.
+func secondaryInit() {
+	// replicate primary core timer access control
+	write_cntkctl(smpCNTKCTL)
+
+	if smpControl.Init != nil {
+		smpControl.Init(int(read_mpidr() & 0xff))
+	}
+}
+
+// GOMAXPROCS sets the maximum number of CPUs that can be executing
+// simultaneously and returns the previous setting, it must be used instead of
+// [runtime.GOMAXPROCS] when using this package.
+//
+// The function checks if n-1 secondary cores are ready (within 1s) at their
+// idle state, if the condition fails the current state is not changed.
+func (cpu *CPU) GOMAXPROCS(n int) int {
+	if cpu.init > 0 {
+		return runtime.GOMAXPROCS(n)
+	}
+
+	ready := uint32(uintptr(unsafe.Pointer(&smpReady)))
+
+	if reg.WaitFor(1*time.Second, ready, 0, 0xff, uint32(n-1)) {
+		goos.ProcID = cpu.ID
+		goos.Task = cpu.Task
+		goos.Wake = cpu.Wake
+		goos.Idle = cpu.smpIdleGovernor
+	} else {
+		n = 1
+	}
+
+	return runtime.GOMAXPROCS(n)
+}
+
+// InitSMP enables Symmetric Multiprocessing (SMP) operation by initializing
+// available secondary cores through the argument platform specific control
+// functions, it must be invoked on the primary core after [CPU.InitMMU] and
+// [CPU.InitGenericTimers].
+//
+// A positive argument caps the total (primary+secondary) number of cores, a
+// negative argument initializes all available cores (see [NumCPU]), an
+// argument of 0 or 1 disables SMP.
+//
+// Secondary cores run at EL1 with interrupts masked, therefore all interrupts
+// are serviced by the primary core.
+//
+// After initialization [runtime.NumCPU] or [runtime.GOMAXPROCS] can be used to
+// verify SMP use by the runtime.
+func (cpu *CPU) InitSMP(n int, smp *SMP) {
+	var i int
+
+	if n == 0 || n == 1 || smp == nil || smp.Start == nil {
+		goos.Task = nil
+		runtime.GOMAXPROCS(1)
+		return
+	}
+
+	if n < 0 || n > NumCPU() {
+		n = NumCPU()
+	}
+
+	smpControl = smp
+	smpVBAR = cpu.vbar
+	smpCNTKCTL = read_cntkctl()
+	smpReady = 0
+	clear(smpTasks[:])
+
+	// the primary core is also woken up by Signal
+	if smp.Init != nil {
+		smp.Init(int(cpu.ID()))
+	}
+
+	// secondary cores start with caches and MMU disabled
+	cpu.CleanDataCacheRange(uint(uintptr(unsafe.Pointer(&smpVBAR))), 8)
+	cpu.CleanDataCacheRange(uint(uintptr(unsafe.Pointer(&smpStacks))), len(smpStacks))
+
+	for i = 1; i < n; i++ {
+		if err := smp.Start(i, exceptionHandler(secondaryEntry).vector()); err != nil {
+			print("WARNING: could not start core ", i, ", ", err.Error(), "\n")
+			break
+		}
+	}
+
+	cpu.GOMAXPROCS(i)
+}
@@ -0,0 +1,180 @@
+// ARM64 processor support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "arm64.h"
+#include "go_asm.h"
+#include "textflag.h"
+
+// func read_mpidr() uint64
+TEXT ·read_mpidr(SB),NOSPLIT,$0-8
+	// ARM Cortex-A53 MPCore Processor Technical Reference Manual
+	// 4.3.2 Multiprocessor Affinity Register
+	MRS	MPIDR_EL1, R0
+	MOVD	R0, ret+0(FP)
+	RET
+
+// func read_l2ctlr() uint64
+TEXT ·read_l2ctlr(SB),NOSPLIT,$0-8
+	// ARM Cortex-A53 MPCore Processor Technical Reference Manual
+	// 4.3.59 L2 Control Register, EL1
+	WORD	$0xd539b040	// mrs x0, s3_1_c11_c0_2
+	MOVD	R0, ret+0(FP)
+	RET
+
+// func wfe()
+TEXT ·wfe(SB),$0
+	// wait until an event is received in low-power state
+	WFE
+	RET
+
+// func sev()
+TEXT ·sev(SB),$0
+	DSB	SY
+	SEV
+	RET
+
+// TASK loads the calling core task address in RN, R0 is clobbered.
+#define TASK(RN)							\
+	MRS	MPIDR_EL1, R0						\
+	AND	$0xff, R0, R0						\
+	MOVD	$task__size, RN						\
+	MUL	R0, RN, RN						\
+	MOVD	$·smpTasks(SB), R0					\
+	ADD	R0, RN, RN
+
+TEXT ·secondaryEntry(SB),NOSPLIT|NOFRAME,$0
+	MRS	CurrentEL, R0
+	LSR	$2, R0, R0
+	AND	$0b11, R0, R0
+
+	// already at EL1
+	CMP	$1, R0
+	BEQ	el1
+
+	// ARM Architecture Reference Manual ARMv8, for ARMv8-A architecture
+	// profile.
+
+	// D12.2.44 HCR_EL2, Hypervisor Configuration Register
+	MOVD	$1<<31, R1	// set EL1 level as AArch64
+	WORD	$0xd51c1101	// msr HCR_EL2, x1
+
+	// C5.2.19 SPSR_ELx, Saved Program Status Register
+	MOVD	$0, R1
+	ORR	$0b1111<<6, R1	// mask exceptions/interrupts
+	ORR	$0b0101<<0, R1	// set EL1h
+
+	MOVD	$·secondaryStart(SB), R2
+
+	CMP	$2, R0
+	BEQ	el2
+
+	// D12.2.99 SCR_EL3, Secure Configuration Register
+	MOVD	$0, R0
+	ORR	$1<<10, R0	// set lower levels as AArch64
+	ORR	$1<<5, R0	// set reserved bit
+	ORR	$1<<4, R0	// set reserved bit
+	ORR	$1<<0, R0	// set Non-secure state
+	WORD	$0xd51e1100	// msr scr_el3, x0
+
+	// drop to EL1
+	WORD	$0xd51e4001	// msr SPSR_EL3, x1
+	WORD	$0xd51e4022	// msr ELR_EL3, x2
+	ISB	SY
+	ERET
+el2:
+	// D12.8.3 CNTHCTL_EL2, Counter-timer Hypervisor Control register
+	MOVD	$0b11, R0	// grant EL1 physical counter/timer access
+	WORD	$0xd51ce100	// msr CNTHCTL_EL2, x0
+	WORD	$0xd51ce07f	// msr CNTVOFF_EL2, xzr
+
+	// drop to EL1
+	WORD	$0xd51c4001	// msr SPSR_EL2, x1
+	WORD	$0xd51c4022	// msr ELR_EL2, x2
+	ISB	SY
+	ERET
+el1:
+	B	·secondaryStart(SB)
+
+TEXT ·secondaryStart(SB),NOSPLIT|NOFRAME,$0
+	// D12.2.100 SCTLR_EL1, System Control Register (EL1)
+	MRS	SCTLR_EL1, R0
+	BIC	$1<<1, R0	// clear A bit
+	BIC	$1<<0, R0	// clear M bit
+	MSR	R0, SCTLR_EL1
+	ISB	SY
+
+	// set per-core idle stack
+	MRS	MPIDR_EL1, R1
+	AND	$0xff, R1, R1
+	ADD	$1, R1, R1
+	MOVD	$const_coreStackSize, R2
+	MUL	R1, R2, R2
+	MOVD	$·smpStacks(SB), R0
+	ADD	R2, R0, R0
+	AND	$~15, R0, R0
+	SUB	$16, R0, R0
+	MOVD	R0, RSP
+
+	// apply primary core vector table
+	MOVD	·smpVBAR(SB), R0
+	MSR	R0, VBAR_EL1
+
+	// apply primary core memory attributes and translation tables, enable
+	// MMU and caches (see CPU.InitMMU)
+	MOVD	$const_mair, R0
+	MSR	R0, MAIR_EL1
+	MOVD	$const_tcr, R0
+	MSR	R0, TCR_EL1
+	ISB	SY
+
+	MOVD	·smpVBAR(SB), R0
+	ADD	$const_l1pageTableOffset, R0, R0
+	MOVD	R0, 8(RSP)
+	CALL	·set_ttbr0_el1(SB)
+
+	CALL	·fp_enable(SB)
+
+	// signal readiness through the counting semaphore
+	MOVD	$·smpReady(SB), R1
+inc:
+	LDAXRW	(R1), R2
+	ADDW	$1, R2, R2
+	STLXRW	R2, (R1), R3
+	CBNZW	R3, inc
+
+	DSB	SY
+wait:
+	// wait SEV from CPU.Task
+	WFE
+
+	TASK(R4)
+	MOVD	task_pc(R4), R5
+	CBZ	R5, wait
+
+	DMB	SY
+
+	MOVD	task_sp(R4), R0
+	MOVD	R0, RSP
+	MOVD	task_gp(R4), g
+
+	// per-core initialization on the task system stack
+	CALL	·secondaryInit(SB)
+
+	TASK(R4)
+	MOVD	task_pc(R4), R5
+
+	// clear task
+	MOVD	ZR, task_sp(R4)
+	MOVD	ZR, task_gp(R4)
+	MOVD	ZR, task_pc(R4)
+
+	// call task target
+	CALL	(R5)
+
+	// go back to idle state in case we return
+	B	wait
@@ -38,6 +38,7 @@ const TIMER_IRQ = 30
 
 // defined in timer.s
 func read_cntfrq() uint32
+func read_cntkctl() uint32
 func write_cntkctl(val uint32)
 func read_cntpct() uint64
 func write_cntptval(val uint32, enable bool)
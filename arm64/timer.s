@@ -18,6 +18,16 @@ TEXT ·read_cntfrq(SB),$0-4
 
 	RET
 
+// func read_cntkctl() uint32
+TEXT ·read_cntkctl(SB),$0-4
+	// ARM Architecture Reference Manual ARMv8, for ARMv8-A architecture profile
+	// D12.8.15 CNTKCTL_EL1, Counter-timer Kernel Control register
+	ISB	SY
+	MRS	CNTKCTL_EL1, R0
+	MOVW	R0, ret+0(FP)
+
+	RET
+
 // func write_cntkctl(val uint32)
 TEXT ·write_cntkctl(SB),$0-4
 	// ARM Architecture Reference Manual ARMv8, for ARMv8-A architecture profile
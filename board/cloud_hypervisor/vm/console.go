@@ -14,8 +14,17 @@ import (
 	_ "unsafe"
 )
 
+// Console represents an optional standard output sink, used instead of the
+// emulated serial port once set, which must not block or allocate memory.
+var Console func(c byte)
+
 //go:linkname printk runtime/goos.Printk
 func printk(c byte) {
+	if Console != nil {
+		Console(c)
+		return
+	}
+
 	UART0.Tx(c)
 
 	if c == 0x0a { // LF
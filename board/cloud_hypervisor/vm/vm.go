@@ -46,6 +46,10 @@ const (
 	// VirtIO Networking
 	VIRTIO_NET_PCI_VENDOR = 0x1af4 // Red Hat, Inc.
 	VIRTIO_NET_PCI_DEVICE = 0x1041 // Virtio 1.0 network device
+
+	// VirtIO Console
+	VIRTIO_CONSOLE_PCI_VENDOR = 0x1af4 // Red Hat, Inc.
+	VIRTIO_CONSOLE_PCI_DEVICE = 0x1043 // Virtio 1.0 console
 )
 
 // Peripheral instances
@@ -113,4 +117,38 @@ func init() {
 		dev.Write(0, pci.Bar0, 0x40000000)
 		dev.Write(0, pci.Bar0+4, 0x1)
 	}
+
+	if dev := pci.Probe(0, VIRTIO_CONSOLE_PCI_VENDOR, VIRTIO_CONSOLE_PCI_DEVICE); dev != nil {
+		// reconfigure BAR to mapped memory region
+		if setBar0(dev, 0x140080000) {
+			// set Memory Space Enable (MSE)
+			dev.Write(0, pci.Command, 1<<1)
+		}
+	}
+}
+
+// setBar0 relocates a 64-bit memory BAR0 to the argument address, which must
+// be naturally aligned to the BAR size, it returns whether the BAR has been
+// relocated.
+func setBar0(dev *pci.Device, addr uint64) bool {
+	bar := dev.Read(0, pci.Bar0)
+
+	// 64-bit memory space BAR
+	if bar&0b111 != 0b100 {
+		return false
+	}
+
+	// size BAR
+	dev.Write(0, pci.Bar0, 0xffffffff)
+	size := ^(dev.Read(0, pci.Bar0) &^ 0xf) + 1
+	dev.Write(0, pci.Bar0, bar)
+
+	if size == 0 || addr&uint64(size-1) != 0 {
+		return false
+	}
+
+	dev.Write(0, pci.Bar0, uint32(addr))
+	dev.Write(0, pci.Bar0+4, uint32(addr>>32))
+
+	return dev.BaseAddress(0) == uint(addr)
 }
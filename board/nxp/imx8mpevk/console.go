@@ -6,7 +6,7 @@
 // Use of this source code is governed by the license
 // that can be found in the LICENSE file.
 
-//go:build !linkprintk
+//go:build !linkprintk && !semihosting
 
 package imx8mpevk
 
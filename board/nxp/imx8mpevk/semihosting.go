@@ -0,0 +1,20 @@
+// 8MPLUSLPD4-EVK support for tamago/arm64
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build semihosting
+
+package imx8mpevk
+
+import (
+	_ "unsafe"
+
+	"github.com/usbarmory/tamago/semihosting"
+)
+
+//go:linkname printk runtime/goos.Printk
+func printk(c byte) { semihosting.WriteC(c) }
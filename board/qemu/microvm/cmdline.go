@@ -0,0 +1,82 @@
+// QEMU microvm support for tamago/amd64
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package microvm
+
+import (
+	"encoding/binary"
+	"os"
+	"strings"
+
+	"github.com/usbarmory/tamago/internal/reg"
+)
+
+// QEMU Firmware Configuration (fw_cfg) device
+// (https://www.qemu.org/docs/master/specs/fw_cfg.html).
+const (
+	FW_CFG_SELECTOR = 0x510
+	FW_CFG_DATA     = 0x511
+
+	FW_CFG_SIGNATURE = 0x00
+	FW_CFG_FILE_DIR  = 0x19
+)
+
+// CmdlineFile is the fw_cfg file from which, when present, `os.Args` is set
+// (e.g. `-fw_cfg name=opt/tamago/cmdline,string=...`), arguments are
+// separated by spaces.
+const CmdlineFile = "opt/tamago/cmdline"
+
+func readConfig(buf []byte) {
+	for i := range buf {
+		buf[i] = reg.In8(FW_CFG_DATA)
+	}
+}
+
+// ReadConfig returns the content of a fw_cfg file.
+func ReadConfig(name string) (buf []byte, ok bool) {
+	var hdr [4]byte
+	var entry [64]byte
+
+	reg.Out16(FW_CFG_SELECTOR, FW_CFG_SIGNATURE)
+
+	if readConfig(hdr[:]); string(hdr[:]) != "QEMU" {
+		return
+	}
+
+	reg.Out16(FW_CFG_SELECTOR, FW_CFG_FILE_DIR)
+	readConfig(hdr[:])
+
+	for n := binary.BigEndian.Uint32(hdr[:]); n > 0; n-- {
+		readConfig(entry[:])
+
+		if strings.TrimRight(string(entry[8:]), "\x00") != name {
+			continue
+		}
+
+		buf = make([]byte, binary.BigEndian.Uint32(entry[0:4]))
+
+		reg.Out16(FW_CFG_SELECTOR, binary.BigEndian.Uint16(entry[4:6]))
+		readConfig(buf)
+
+		return buf, true
+	}
+
+	return
+}
+
+func initArgs() {
+	if len(os.Args) > 1 {
+		return
+	}
+
+	if cmdline, ok := ReadConfig(CmdlineFile); ok {
+		if args := strings.Fields(string(cmdline)); len(args) > 0 {
+			os.Args = args
+		}
+	}
+}
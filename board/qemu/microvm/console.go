@@ -14,7 +14,16 @@ import (
 	_ "unsafe"
 )
 
+// Console, when set, replaces UART0 as standard output sink (e.g. a VirtIO
+// console port Tx function), it must not block or allocate memory.
+var Console func(c byte)
+
 //go:linkname printk runtime/goos.Printk
 func printk(c byte) {
+	if Console != nil {
+		Console(c)
+		return
+	}
+
 	UART0.Tx(c)
 }
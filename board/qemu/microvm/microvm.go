@@ -20,6 +20,7 @@ import (
 
 	"github.com/usbarmory/tamago/amd64"
 	"github.com/usbarmory/tamago/dma"
+	"github.com/usbarmory/tamago/internal/reg"
 	"github.com/usbarmory/tamago/kvm/pvclock"
 	"github.com/usbarmory/tamago/soc/intel/ioapic"
 	"github.com/usbarmory/tamago/soc/intel/rtc"
@@ -36,6 +37,11 @@ const (
 	// Communication port
 	COM1 = 0x3f8
 
+	// QEMU isa-debug-exit device port, when present (e.g. `-device
+	// isa-debug-exit,iobase=0xf4,iosize=0x04`) guest-initiated shut down
+	// results in QEMU exit status `(code << 1) | 1`.
+	DEBUG_EXIT = 0xf4
+
 	// Intel I/O Programmable Interrupt Controllers
 	IOAPIC0_BASE = 0xfec00000
 	IOAPIC1_BASE = 0xfec10000
@@ -100,7 +106,10 @@ func Init() {
 	// initialize serial console
 	UART0.Init()
 
-	goos.Exit = func(_ int32) {
+	goos.Exit = func(code int32) {
+		// report exit status, if the debug exit device is present
+		reg.Out32(DEBUG_EXIT, uint32(code))
+
 		// On microvm the recommended way to trigger a guest-initiated
 		// shut down is by generating a triple-fault.
 		amd64.Fault()
@@ -119,4 +128,7 @@ func init() {
 
 	// initialize KVM pvclock as needed
 	pvclock.Init(AMD64)
+
+	// set command line arguments, if passed through fw_cfg
+	initArgs()
 }
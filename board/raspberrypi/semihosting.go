@@ -0,0 +1,20 @@
+// Raspberry Pi support for tamago/arm
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) the pi package authors
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build semihosting
+
+package pi
+
+import (
+	_ "unsafe"
+
+	"github.com/usbarmory/tamago/semihosting"
+)
+
+//go:linkname printk runtime/goos.Printk
+func printk(c byte) { semihosting.WriteC(c) }
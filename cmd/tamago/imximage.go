@@ -0,0 +1,121 @@
+// tamago-go installer and runner (i.MX boot image generation)
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/usbarmory/tamago/soc/nxp/imximage"
+)
+
+// runIMXImage creates an i.MX bootable image from an ELF executable or flat
+// binary.
+func runIMXImage(args []string) int {
+	fs := flag.NewFlagSet("imximage", flag.ContinueOnError)
+	cfg := fs.String("c", "imximage.cfg", "imximage.cfg configuration file")
+	out := fs.String("o", "", "output file (default <input>.imx)")
+	load := fs.String("load", "", "load address for binary input")
+	entry := fs.String("entry", "", "entry point (default ELF entry or load address)")
+	csf := fs.Bool("csf", false, "pad image with CSF placeholder for HAB signing")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: tamago imximage [flags] <executable>\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil || fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	if err := imxImage(fs.Arg(0), *cfg, *out, *load, *entry, *csf); err != nil {
+		log.Printf("tamago: %v", err)
+		return 1
+	}
+
+	return 0
+}
+
+func parseAddr(s string) (uint32, error) {
+	addr, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid address %q", s)
+	}
+	return uint32(addr), nil
+}
+
+func imxImage(input, cfg, out, load, entry string, csf bool) error {
+	f, err := os.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c, err := imximage.Parse(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", cfg, err)
+	}
+
+	buf, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+
+	var payload []byte
+	var loadAddr, entryAddr uint32
+
+	if bytes.HasPrefix(buf, []byte("\x7fELF")) {
+		if payload, loadAddr, entryAddr, err = imximage.ParseELF(bytes.NewReader(buf)); err != nil {
+			return fmt.Errorf("%s: %v", input, err)
+		}
+	} else {
+		if load == "" {
+			return fmt.Errorf("%s: load address required for binary input", input)
+		}
+		payload = buf
+	}
+
+	if load != "" {
+		if loadAddr, err = parseAddr(load); err != nil {
+			return err
+		}
+		entryAddr = loadAddr
+	}
+
+	if entry != "" {
+		if entryAddr, err = parseAddr(entry); err != nil {
+			return err
+		}
+	}
+
+	img, err := c.Build(payload, loadAddr, entryAddr)
+	if err != nil {
+		return err
+	}
+
+	if out == "" {
+		out = input + ".imx"
+	}
+
+	if err = os.WriteFile(out, img.Bytes(csf), 0644); err != nil {
+		return err
+	}
+
+	if c.CSFSize > 0 {
+		start, off, size := img.HABBlocks()
+		fmt.Printf("HAB Blocks:   0x%08x 0x%08x 0x%08x\n", start, off, size)
+	}
+
+	return nil
+}
@@ -0,0 +1,423 @@
+// tamago-go installer and runner (toolchain installation)
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const defaultSource = "https://github.com/usbarmory/tamago-go"
+
+// Environment variables controlling the toolchain installation.
+const (
+	// git repository URL/path or local source tarball (.tar.gz/.tgz)
+	envSource = "TAMAGO_GO_SOURCE"
+	// prebuilt toolchain archive (.tar.gz/.tgz)
+	envArchive = "TAMAGO_GO_ARCHIVE"
+	// pin file
+	envPins = "TAMAGO_GO_PINS"
+	// skip verification of unpinned sources and archives (when set to 1)
+	envInsecure = "TAMAGO_GO_INSECURE"
+)
+
+// pins represents the commit hashes and archive checksums allowed for a
+// tamago-go version, as read from pins.txt or from the file specified with
+// TAMAGO_GO_PINS, with lines in the following format:
+//
+//	# version       kind    value
+//	tamago-go1.26.4 commit  <full git commit hash>
+//	tamago-go1.26.4 sha256  <source or prebuilt archive checksum>
+type pins struct {
+	tag    string
+	commit []string
+	sha256 []string
+}
+
+// defaultPins holds the pins for the default source of each tamago-go version
+// matching a tamago module release.
+//
+//go:embed pins.txt
+var defaultPins string
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+
+	_, err := hex.DecodeString(s)
+
+	return err == nil
+}
+
+func parsePins(name string, r io.Reader, tag string) (p *pins, err error) {
+	p = &pins{tag: tag}
+	s := bufio.NewScanner(r)
+
+	for n := 1; s.Scan(); n++ {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%s:%d: invalid pin", name, n)
+		}
+
+		kind := fields[1]
+		value := strings.ToLower(fields[2])
+
+		switch {
+		case kind == "commit" && isHex(value, 40):
+			if fields[0] == tag {
+				p.commit = append(p.commit, value)
+			}
+		case kind == "sha256" && isHex(value, 64):
+			if fields[0] == tag {
+				p.sha256 = append(p.sha256, value)
+			}
+		default:
+			return nil, fmt.Errorf("%s:%d: invalid %s pin %q", name, n, kind, fields[2])
+		}
+	}
+
+	if err = s.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read pins: %v", err)
+	}
+
+	return
+}
+
+// readPins returns the pins for the argument tamago-go version, the file
+// specified with TAMAGO_GO_PINS replaces the built-in ones.
+func readPins(tag string) (p *pins, err error) {
+	name := os.Getenv(envPins)
+	if name == "" {
+		return parsePins("pins.txt", strings.NewReader(defaultPins), tag)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pins: %v", err)
+	}
+	defer f.Close()
+
+	if p, err = parsePins(name, f, tag); err != nil {
+		return
+	}
+
+	if len(p.commit) == 0 && len(p.sha256) == 0 {
+		return nil, fmt.Errorf("no pins for %s in %s", tag, name)
+	}
+
+	return
+}
+
+// missing returns an error for the argument pin kind not being available,
+// unless verification is explicitly disabled with TAMAGO_GO_INSECURE.
+func (p *pins) missing(kind string) error {
+	if os.Getenv(envInsecure) != "1" {
+		return fmt.Errorf("no %s pin for %s, see %s", kind, p.tag, envPins)
+	}
+
+	fmt.Printf("tamago: WARNING: no %s pin for %s, skipping verification\n", kind, p.tag)
+
+	return nil
+}
+
+func (p *pins) verifyCommit(root string) error {
+	if len(p.commit) == 0 {
+		return p.missing("commit")
+	}
+
+	out, err := exec.Command("git", "-C", root, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return fmt.Errorf("failed to read commit: %v", err)
+	}
+
+	commit := strings.TrimSpace(string(out))
+
+	for _, pin := range p.commit {
+		if commit == pin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("commit %s does not match pins", commit)
+}
+
+func (p *pins) verifyChecksum(name string) error {
+	if len(p.sha256) == 0 {
+		return p.missing("sha256")
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+
+	sum := hex.EncodeToString(h.Sum(nil))
+
+	for _, pin := range p.sha256 {
+		if sum == pin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%s checksum %s does not match pins", name, sum)
+}
+
+func isTarball(name string) bool {
+	return strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz")
+}
+
+// archivePath returns the prebuilt toolchain archive to be used, if present.
+func archivePath(root string) string {
+	if name := os.Getenv(envArchive); name != "" {
+		return name
+	}
+
+	name := filepath.Base(root) + "." + runtime.GOOS + "-" + runtime.GOARCH + ".tar.gz"
+	name = filepath.Join(filepath.Dir(root), name)
+
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+
+	return ""
+}
+
+// walkTarball invokes fn for each entry of a gzip compressed tar archive.
+func walkTarball(name string, fn func(hdr *tar.Header, r io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", name, err)
+	}
+
+	r := tar.NewReader(gz)
+
+	for {
+		hdr, err := r.Next()
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read %s: %v", name, err)
+		}
+
+		if err = fn(hdr, r); err != nil {
+			return err
+		}
+	}
+}
+
+// extract unpacks a gzip compressed tar archive in root, stripping the
+// leading path of the directory containing the marker file (e.g.
+// "src/make.bash").
+func extract(name, root, marker string) error {
+	prefix := ""
+	found := false
+
+	err := walkTarball(name, func(hdr *tar.Header, _ io.Reader) error {
+		p := path.Clean(hdr.Name)
+
+		if !found && (p == marker || strings.HasSuffix(p, "/"+marker)) {
+			prefix = strings.TrimSuffix(p, marker)
+			found = true
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		return fmt.Errorf("%s: %s not found", name, marker)
+	}
+
+	return walkTarball(name, func(hdr *tar.Header, r io.Reader) error {
+		p := path.Clean(hdr.Name)
+
+		if !strings.HasPrefix(p, prefix) || p == path.Clean(prefix) {
+			return nil
+		}
+
+		rel := strings.TrimPrefix(p, prefix)
+
+		if !filepath.IsLocal(rel) {
+			return fmt.Errorf("%s: invalid path %s", name, hdr.Name)
+		}
+
+		dst := filepath.Join(root, filepath.FromSlash(rel))
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(dst, 0755)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+
+			f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, hdr.FileInfo().Mode().Perm())
+			if err != nil {
+				return err
+			}
+
+			if _, err = io.Copy(f, r); err != nil {
+				f.Close()
+				return err
+			}
+
+			return f.Close()
+		case tar.TypeSymlink:
+			// links must resolve within root
+			target := filepath.FromSlash(hdr.Linkname)
+
+			if filepath.IsAbs(target) || !filepath.IsLocal(filepath.Join(filepath.Dir(filepath.FromSlash(rel)), target)) {
+				return fmt.Errorf("%s: invalid link %s -> %s", name, hdr.Name, hdr.Linkname)
+			}
+
+			if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+				return err
+			}
+
+			return os.Symlink(hdr.Linkname, dst)
+		}
+
+		return nil
+	})
+}
+
+func install(root, tag string) (err error) {
+	p, err := readPins(tag)
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(root, 0755); err != nil {
+		return fmt.Errorf("failed to create repository: %v", err)
+	}
+
+	defer func() {
+		if err != nil {
+			os.RemoveAll(root)
+		}
+	}()
+
+	if archive := archivePath(root); archive != "" {
+		fmt.Printf("tamago: using prebuilt toolchain %s\n", archive)
+
+		if err = p.verifyChecksum(archive); err != nil {
+			return
+		}
+
+		return extract(archive, root, path.Join("bin", "go"+exe()))
+	}
+
+	source := os.Getenv(envSource)
+	if source == "" {
+		source = defaultSource
+	}
+
+	if isTarball(source) {
+		if err = p.verifyChecksum(source); err != nil {
+			return
+		}
+
+		if err = extract(source, root, path.Join("src", makeScript())); err != nil {
+			return
+		}
+	} else {
+		if err = clone(source, root, tag); err != nil {
+			return
+		}
+
+		if source == defaultSource && len(p.commit) == 0 {
+			// releases without a built-in pin rely on the default
+			// source HTTPS authentication
+			fmt.Printf("tamago: WARNING: no commit pin for %s, trusting %s\n", tag, defaultSource)
+		} else if err = p.verifyCommit(root); err != nil {
+			return
+		}
+	}
+
+	return build(root)
+}
+
+func clone(source, root, tag string) error {
+	cmd := exec.Command("git", "clone", "--depth=1", "--branch="+tag, source, root)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = root
+	cmd.Env = append(os.Environ(), "PWD="+cmd.Dir)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to clone git repository: %v", err)
+	}
+
+	return nil
+}
+
+func build(root string) error {
+	// If invoked from GOOS=tamago compilation GOOS must be unset while
+	// building the toolchain.
+	key := "GOOS"
+	val := os.Getenv(key)
+	os.Unsetenv(key)
+	defer os.Setenv(key, val)
+
+	cmd := exec.Command(filepath.Join(root, "src", makeScript()))
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Dir = filepath.Join(root, "src")
+	// Add new GOROOT/bin to PATH to silence path warning at end of make.bash.
+	// Add PWD to environment to fix future calls to os.Getwd.
+	newPath := filepath.Join(root, "bin")
+	if p := os.Getenv("PATH"); p != "" {
+		newPath += string(filepath.ListSeparator) + p
+	}
+	cmd.Env = append(os.Environ(), "PATH="+newPath, "PWD="+cmd.Dir)
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to build go: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "bin", "go"+exe())); err != nil {
+		return errors.New("go binary not found after build")
+	}
+
+	return nil
+}
@@ -18,6 +18,38 @@
 //	tool github.com/usbarmory/tamago/cmd/tamago
 //
 // to go.mod and use "go tool tamago" as the go command.
+//
+// When GOOS=tamago, "go tool tamago test" builds test binaries with the
+// semihosting build tag and runs them under QEMU, selecting the machine
+// matching the imported board package (qemu/microvm, qemu/sifive_u,
+// raspberrypi/pi2, nxp/mx6ullevk or nxp/imx8mpevk). The guest console is
+// streamed and its exit status is reported as the test result. Test binary
+// flags (e.g. -test.run) are passed through the semihosting command line or,
+// on qemu/microvm, through a fw_cfg file. On qemu/microvm KVM acceleration is
+// used when available.
+//
+// Additional QEMU flags (e.g. "-bios" for qemu/sifive_u) can be passed with the
+// TAMAGO_QEMUFLAGS environment variable. A single executable can be run with
+// "go tool tamago qemu <executable>".
+//
+// NXP i.MX bootable images, with IVT, Boot Data and DCD headers parsed from an
+// imximage.cfg file, can be created with "go tool tamago imximage -c
+// imximage.cfg <executable>", replacing U-Boot mkimage.
+//
+// The toolchain is installed, in the user cache directory, as follows:
+//
+//   - from the prebuilt archive specified with TAMAGO_GO_ARCHIVE or, if
+//     present, from <version>.<GOOS>-<GOARCH>.tar.gz in the cache directory;
+//   - otherwise built from the source tarball or git repository specified with
+//     TAMAGO_GO_SOURCE, defaulting to the tamago-go GitHub repository.
+//
+// The commit hash of cloned repositories, or the SHA-256 checksum of archives,
+// must match a pin for the toolchain version in the pins.txt file shipped with
+// this command, or in the file specified with TAMAGO_GO_PINS which replaces
+// it. Sources and archives without a pin are rejected unless TAMAGO_GO_INSECURE
+// is set to 1, except for the default repository which, when not pinned, is
+// trusted through its HTTPS authentication. "go tool tamago version" reports
+// the toolchain version and GOROOT in use.
 package main
 
 import (
@@ -52,10 +84,20 @@ func moduleVersion() (string, error) {
 func main() {
 	log.SetFlags(0)
 
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "qemu":
+			os.Exit(runQEMU(os.Args[2:]))
+		case "imximage":
+			os.Exit(runIMXImage(os.Args[2:]))
+		}
+	}
+
 	version, err := moduleVersion()
 	if err != nil {
 		log.Fatalf("tamago: %v", err)
 	}
+	moduleVer := version
 	if !strings.HasPrefix(version, "v1.") {
 		log.Fatalf("tamago: unsupported tamago module version %q", version)
 	}
@@ -90,47 +132,20 @@ func main() {
 		}
 	}
 
-	runGo(root)
-}
-
-func install(root, tag string) error {
-	if err := os.MkdirAll(root, 0755); err != nil {
-		return fmt.Errorf("failed to create repository: %v", err)
-	}
-
-	// If invoked from GOOS=tamago compilation GOOS must be unset while
-	// building the toolchain.
-	key := "GOOS"
-	val := os.Getenv(key)
-	os.Unsetenv(key)
-	defer os.Setenv(key, val)
-
-	cmd := exec.Command("git", "clone", "--depth=1", "--branch="+tag, "https://github.com/usbarmory/tamago-go", root)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Dir = root
-	cmd.Env = append(os.Environ(), "PWD="+cmd.Dir)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to clone git repository: %v", err)
+	args := os.Args[1:]
+	if len(args) == 1 && args[0] == "version" {
+		fmt.Printf("tamago: module %s, %s\n", moduleVer, version)
+		fmt.Printf("tamago: GOROOT=%s\n", root)
 	}
-
-	cmd = exec.Command(filepath.Join(root, "src", makeScript()))
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Dir = filepath.Join(root, "src")
-	// Add new GOROOT/bin to PATH to silence path warning at end of make.bash.
-	// Add PWD to environment to fix future calls to os.Getwd.
-	newPath := filepath.Join(root, "bin")
-	if p := os.Getenv("PATH"); p != "" {
-		newPath += string(filepath.ListSeparator) + p
-	}
-	cmd.Env = append(os.Environ(), "PATH="+newPath, "PWD="+cmd.Dir)
-
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to build go: %v", err)
+	if len(args) > 0 && args[0] == "test" && os.Getenv("GOOS") == "tamago" {
+		rest, err := testArgs(args[1:])
+		if err != nil {
+			log.Fatalf("tamago: %v", err)
+		}
+		args = append([]string{"test"}, rest...)
 	}
 
-	return nil
+	runGo(root, args)
 }
 
 func makeScript() string {
@@ -144,9 +159,9 @@ func makeScript() string {
 	}
 }
 
-func runGo(root string) {
+func runGo(root string, args []string) {
 	gobin := filepath.Join(root, "bin", "go"+exe())
-	cmd := exec.Command(gobin, os.Args[1:]...)
+	cmd := exec.Command(gobin, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -0,0 +1,279 @@
+// tamago-go installer and runner (QEMU test runner)
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+)
+
+const modulePath = "github.com/usbarmory/tamago"
+
+// fw_cfg file for command line passing (see microvm.CmdlineFile)
+const fwcfgCmdline = "opt/tamago/cmdline"
+
+// machine represents a QEMU machine emulating a supported board.
+type machine struct {
+	// board package path, relative to the tamago module
+	pkg string
+	// QEMU system emulator
+	qemu string
+	// QEMU arguments
+	args []string
+	// QEMU arguments with KVM acceleration, or TCG when unavailable
+	kvm []string
+	tcg []string
+	// exit status reporting through isa-debug-exit device, rather than
+	// semihosting
+	debugExit bool
+	// command line passing through fw_cfg, rather than semihosting
+	fwcfg bool
+}
+
+var machines = []machine{
+	{
+		pkg:  "board/qemu/microvm",
+		qemu: "qemu-system-x86_64",
+		args: []string{
+			"-machine", "microvm,x-option-roms=on,pit=off,pic=off,rtc=on",
+			"-global", "virtio-mmio.force-legacy=false", "-no-reboot",
+			"-m", "4G", "-nographic", "-monitor", "none", "-serial", "stdio",
+			"-device", "isa-debug-exit,iobase=0xf4,iosize=0x04",
+		},
+		kvm:       []string{"-enable-kvm", "-cpu", "host,invtsc=on,kvmclock=on"},
+		tcg:       []string{"-accel", "tcg", "-cpu", "max"},
+		debugExit: true,
+		fwcfg:     true,
+	},
+	{
+		pkg:  "board/qemu/sifive_u",
+		qemu: "qemu-system-riscv64",
+		args: []string{
+			"-machine", "sifive_u", "-m", "512M",
+			"-nographic", "-monitor", "none", "-serial", "stdio", "-net", "none",
+			"-semihosting",
+		},
+	},
+	{
+		pkg:  "board/raspberrypi/pi2",
+		qemu: "qemu-system-arm",
+		args: []string{
+			"-machine", "raspi2b", "-m", "1G",
+			"-nographic", "-monitor", "none", "-serial", "null", "-serial", "stdio",
+			"-semihosting",
+		},
+	},
+	{
+		pkg:  "board/nxp/mx6ullevk",
+		qemu: "qemu-system-arm",
+		args: []string{
+			"-machine", "mcimx6ul-evk", "-cpu", "cortex-a7", "-m", "512M",
+			"-nographic", "-monitor", "none", "-serial", "null", "-serial", "stdio",
+			"-semihosting",
+		},
+	},
+	{
+		pkg:  "board/nxp/imx8mpevk",
+		qemu: "qemu-system-aarch64",
+		args: []string{
+			"-machine", "imx8mp-evk", "-m", "512M",
+			"-nographic", "-monitor", "none", "-serial", "stdio", "-serial", "null",
+			"-semihosting",
+		},
+	},
+}
+
+// findMachine returns the QEMU machine matching the board package linked in
+// the argument executable.
+func findMachine(path string) (*machine, error) {
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	syms, err := f.Symbols()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read symbols: %v", err)
+	}
+
+	for i, m := range machines {
+		prefix := modulePath + "/" + m.pkg + "."
+		for _, sym := range syms {
+			if strings.HasPrefix(sym.Name, prefix) {
+				return &machines[i], nil
+			}
+		}
+	}
+
+	return nil, errors.New("no supported board package found")
+}
+
+// kvmAvailable returns whether KVM acceleration can be used.
+func kvmAvailable() bool {
+	f, err := os.OpenFile("/dev/kvm", os.O_RDWR, 0)
+	if err != nil {
+		return false
+	}
+	f.Close()
+
+	return true
+}
+
+// guestArgs returns the QEMU arguments to pass the command line arguments of
+// an executable to the guest, through semihosting or, on boards without it,
+// through a fw_cfg file (see microvm.CmdlineFile).
+func guestArgs(m *machine, args []string) ([]string, error) {
+	var cmdline []string
+
+	if len(args) <= 1 {
+		return nil, nil
+	}
+
+	for _, arg := range args {
+		// guest arguments are separated by spaces
+		if strings.ContainsAny(arg, " \t\n") {
+			return nil, fmt.Errorf("unsupported argument with spaces (%q)", arg)
+		}
+
+		cmdline = append(cmdline, strings.ReplaceAll(arg, ",", ",,"))
+	}
+
+	if m.fwcfg {
+		return []string{"-fw_cfg", "name=" + fwcfgCmdline + ",string=" + strings.Join(cmdline, " ")}, nil
+	}
+
+	for i, arg := range cmdline {
+		cmdline[i] = "arg=" + arg
+	}
+
+	cmdline = append([]string{"enable=on"}, cmdline...)
+
+	return []string{"-semihosting-config", strings.Join(cmdline, ",")}, nil
+}
+
+// testArgs returns the arguments for a `go test` invocation which runs test
+// binaries with runQEMU.
+func testArgs(args []string) ([]string, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.ContainsAny(self, " \t") {
+		self = "'" + self + "'"
+	}
+
+	tags := -1
+	for i, arg := range args {
+		switch {
+		case arg == "-exec" || strings.HasPrefix(arg, "-exec="):
+			// honor user provided runner
+			return args, nil
+		case arg == "-tags" && i+1 < len(args):
+			tags = i + 1
+		case strings.HasPrefix(arg, "-tags="):
+			tags = i
+		}
+	}
+
+	// exit status and console are redirected to semihosting on boards
+	// supporting it
+	if tags < 0 {
+		args = append([]string{"-tags=semihosting"}, args...)
+	} else if !strings.Contains(args[tags], "linkprintk") {
+		args[tags] += ",semihosting"
+	}
+
+	return append([]string{"-exec", self + " qemu"}, args...), nil
+}
+
+// runQEMU boots an executable on the QEMU machine matching its board package,
+// streams its console and returns the guest exit status.
+func runQEMU(args []string) int {
+	if len(args) < 1 {
+		log.Printf("usage: tamago qemu <executable> [args]")
+		return 2
+	}
+
+	path := args[0]
+
+	m, err := findMachine(path)
+	if err != nil {
+		log.Printf("tamago: %s: %v", path, err)
+		return 1
+	}
+
+	// test binary arguments (e.g. -test.run) are forwarded to the guest
+	// through semihosting or fw_cfg
+	cmdline, err := guestArgs(m, args)
+	if err != nil {
+		log.Printf("tamago: %v", err)
+		return 2
+	}
+
+	qemuArgs := append([]string{}, m.args...)
+
+	if kvmAvailable() {
+		qemuArgs = append(qemuArgs, m.kvm...)
+	} else {
+		qemuArgs = append(qemuArgs, m.tcg...)
+	}
+
+	qemuArgs = append(qemuArgs, cmdline...)
+	qemuArgs = append(qemuArgs, strings.Fields(os.Getenv("TAMAGO_QEMUFLAGS"))...)
+	qemuArgs = append(qemuArgs, "-kernel", path)
+
+	cmd := exec.Command(m.qemu, qemuArgs...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Start(); err != nil {
+		log.Printf("tamago: %v", err)
+		return 1
+	}
+
+	// terminate the emulator on interruption (e.g. go test timeout)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, signalsToIgnore...)
+	go func() {
+		<-sig
+		cmd.Process.Kill()
+	}()
+
+	err = cmd.Wait()
+	signal.Stop(sig)
+
+	var eerr *exec.ExitError
+	if err != nil && !errors.As(err, &eerr) {
+		log.Printf("tamago: %v", err)
+		return 1
+	}
+
+	code := cmd.ProcessState.ExitCode()
+
+	if !m.debugExit {
+		return code
+	}
+
+	// isa-debug-exit reports (status << 1) | 1, while a zero code indicates
+	// that the guest terminated without reporting its status.
+	if code&1 == 0 {
+		log.Printf("tamago: %s: exited without status", path)
+		return 1
+	}
+
+	return code >> 1
+}
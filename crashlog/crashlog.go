@@ -0,0 +1,254 @@
+// Persistent crash record
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package crashlog implements a persistent crash record, stored in a memory
+// area which retains its content across warm resets, to allow retrieval of
+// panic and exception information on the next boot.
+//
+// A single compact record (message, program counter and goroutine trace
+// excerpt) is kept, protected by a CRC32 checksum. The record is truncated to
+// the storage capacity, which allows its use with very small stores such as
+// the i.MX SNVS LP General Purpose Registers (see [Registers]).
+//
+// Example:
+//
+//	log := &crashlog.Log{
+//		// OCRAM area excluded from the DMA region
+//		Store: &crashlog.Memory{
+//			Start: imx6ul.OCRAM_START + imx6ul.OCRAM_SIZE - 4096,
+//			Size:  4096,
+//		},
+//		ResetSource: func() uint32 {
+//			return uint32(imx6ul.WDOG1.ResetSource())
+//		},
+//	}
+//
+//	if err := log.Init(); err != nil {
+//		panic(err)
+//	}
+//
+//	if r, err := log.Read(); err == nil {
+//		fmt.Printf("previous crash: %s (pc:%#x reset:%#x)\n%s", r.Message, r.PC, r.ResetSource, r.Trace)
+//		log.Clear()
+//	}
+//
+//	fault.SetHandler(fault.DataFault, log.Fault)
+//
+//	go func() {
+//		defer log.Capture()
+//		// ...
+//	}()
+//
+// This package is only meant to be used with `GOOS=tamago` as supported by the
+// TamaGo framework for bare metal Go, see https://github.com/usbarmory/tamago.
+package crashlog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"runtime"
+	"strings"
+
+	"github.com/usbarmory/tamago/fault"
+)
+
+// Record represents a crash record.
+type Record struct {
+	// Message is the panic message or exception class.
+	Message string
+	// PC is the program counter at which the crash occurred.
+	PC uint64
+	// Trace is the excerpt of the crashing goroutine stack trace.
+	Trace string
+
+	// ResetSource is the reset reason reported on retrieval (see
+	// Log.ResetSource), it is not stored within the record.
+	ResetSource uint32
+}
+
+// Log represents a persistent crash log instance.
+type Log struct {
+	// Store is the memory area holding the crash record.
+	Store Store
+
+	// ResetSource is an optional function which returns the last reset
+	// reason, reported on retrieval (e.g. wdog.WDOG.ResetSource()).
+	ResetSource func() uint32
+
+	// record buffer
+	buf []byte
+	// stack trace buffer
+	trace []byte
+}
+
+// Init initializes the crash log, the memory area must be reserved for its
+// exclusive use (e.g. excluded from runtime and DMA regions).
+func (l *Log) Init() (err error) {
+	if l.Store == nil {
+		return errors.New("missing store")
+	}
+
+	size := min(l.Store.Len(), headerSize+maxPayload)
+
+	if size <= headerSize {
+		return errors.New("insufficient store size")
+	}
+
+	l.buf = make([]byte, size)
+	l.trace = make([]byte, size)
+
+	// initialize checksum tables ahead of any exception
+	crc32.ChecksumIEEE(nil)
+
+	return
+}
+
+// Write stores the argument crash record, replacing any previous one. The
+// record is truncated to fit the store capacity.
+//
+// Write does not allocate memory and can therefore be used within exception
+// handlers.
+func (l *Log) Write(r *Record) (err error) {
+	if l.buf == nil {
+		return errors.New("crash log not initialized")
+	}
+
+	payload := r.marshal(l.buf[headerSize:headerSize])
+	n := len(payload)
+
+	binary.LittleEndian.PutUint16(l.buf[0:], magic)
+	binary.LittleEndian.PutUint16(l.buf[2:], uint16(n))
+	binary.LittleEndian.PutUint32(l.buf[4:], crc32.ChecksumIEEE(payload))
+
+	_, err = l.Store.WriteAt(l.buf[:headerSize+n], 0)
+
+	return
+}
+
+// Read returns the stored crash record, an error is returned if no valid
+// record is present.
+func (l *Log) Read() (r *Record, err error) {
+	if l.buf == nil {
+		return nil, errors.New("crash log not initialized")
+	}
+
+	if _, err = l.Store.ReadAt(l.buf[:headerSize], 0); err != nil {
+		return
+	}
+
+	if binary.LittleEndian.Uint16(l.buf[0:]) != magic {
+		return nil, errors.New("no crash record")
+	}
+
+	n := int(binary.LittleEndian.Uint16(l.buf[2:]))
+	sum := binary.LittleEndian.Uint32(l.buf[4:])
+
+	if headerSize+n > len(l.buf) {
+		return nil, errors.New("invalid crash record length")
+	}
+
+	payload := l.buf[headerSize : headerSize+n]
+
+	if _, err = l.Store.ReadAt(payload, headerSize); err != nil {
+		return
+	}
+
+	if crc32.ChecksumIEEE(payload) != sum {
+		return nil, errors.New("invalid crash record checksum")
+	}
+
+	r = &Record{}
+
+	if err = r.unmarshal(payload); err != nil {
+		return nil, err
+	}
+
+	if l.ResetSource != nil {
+		r.ResetSource = l.ResetSource()
+	}
+
+	return
+}
+
+// Clear erases the stored crash record.
+func (l *Log) Clear() (err error) {
+	if l.buf == nil {
+		return errors.New("crash log not initialized")
+	}
+
+	clear(l.buf)
+	_, err = l.Store.WriteAt(l.buf, 0)
+
+	return
+}
+
+// Capture records the panic in progress, if any, and then resumes panicking.
+// It must be invoked directly by a deferred call within the goroutine to
+// monitor.
+func (l *Log) Capture() {
+	v := recover()
+
+	if v == nil {
+		return
+	}
+
+	r := &Record{
+		Message: fmt.Sprint(v),
+		PC:      panicPC(),
+	}
+
+	n := runtime.Stack(l.trace, false)
+	r.Trace = string(l.trace[:n])
+
+	l.Write(r)
+
+	panic(v)
+}
+
+// Fault records the exception context class and program counter, it can be
+// registered as exception handler (see fault.SetHandler) and always returns
+// false to let the default exception handling take place.
+func (l *Log) Fault(ctx fault.Context) bool {
+	r := Record{
+		Message: ctx.Class().String(),
+		PC:      uint64(ctx.ProgramCounter()),
+	}
+
+	l.Write(&r)
+
+	return false
+}
+
+// panicPC returns the program counter of the function which invoked panic.
+func panicPC() uint64 {
+	pc := make([]uintptr, 16)
+	n := runtime.Callers(2, pc)
+
+	frames := runtime.CallersFrames(pc[:n])
+	panicking := false
+
+	for {
+		frame, more := frames.Next()
+
+		if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return uint64(frame.PC)
+		}
+
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	return 0
+}
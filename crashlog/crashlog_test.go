@@ -0,0 +1,98 @@
+// Persistent crash record
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package crashlog
+
+import (
+	"testing"
+)
+
+func newRegisters(count int) *Registers {
+	regs := make([]uint32, count)
+
+	return &Registers{
+		Read:  func(n int) uint32 { return regs[n] },
+		Write: func(n int, val uint32) { regs[n] = val },
+		Count: count,
+	}
+}
+
+func TestRecord(t *testing.T) {
+	l := &Log{Store: newRegisters(64)}
+
+	if err := l.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Read(); err == nil {
+		t.Fatal("unexpected record")
+	}
+
+	r := &Record{
+		Message: "index out of range",
+		PC:      0x80012345,
+		Trace:   "goroutine 1 [running]:",
+	}
+
+	if err := l.Write(r); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := l.Read()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *got != *r {
+		t.Errorf("record mismatch, got %+v, want %+v", got, r)
+	}
+
+	if err := l.Clear(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Read(); err == nil {
+		t.Fatal("unexpected record after clear")
+	}
+}
+
+func TestRecordTruncation(t *testing.T) {
+	regs := newRegisters(4)
+	l := &Log{Store: regs}
+
+	if err := l.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &Record{
+		Message: "data fault",
+		PC:      0x80012345,
+	}
+
+	if err := l.Write(r); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := l.Read()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got.PC != r.PC || got.Message != "da" || got.Trace != "" {
+		t.Errorf("unexpected truncated record %+v", got)
+	}
+
+	// corrupt payload
+	regs.Write(3, regs.Read(3)^1)
+
+	if _, err := l.Read(); err == nil {
+		t.Fatal("corrupted record not detected")
+	}
+}
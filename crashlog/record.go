@@ -0,0 +1,119 @@
+// Persistent crash record
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package crashlog
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// Crash record header, all fields are little-endian:
+//
+//	magic  uint16
+//	length uint16 // payload length
+//	crc    uint32 // payload CRC32 (IEEE)
+//
+// The payload is composed, in order of retention on truncation, of the
+// uvarint encoded program counter followed by the message and trace strings,
+// each prefixed by its uvarint encoded length.
+const (
+	magic      = 0x4c43 // "CL"
+	headerSize = 8
+	maxPayload = 0xffff
+)
+
+func uvarintLen(v uint64) (n int) {
+	for n = 1; v >= 0x80; n++ {
+		v >>= 7
+	}
+
+	return
+}
+
+// appendUvarint appends the argument value, within the buffer capacity, and
+// returns whether it fits.
+func appendUvarint(buf []byte, v uint64) ([]byte, bool) {
+	if len(buf)+uvarintLen(v) > cap(buf) {
+		return buf, false
+	}
+
+	return binary.AppendUvarint(buf, v), true
+}
+
+// appendString appends the argument string, truncated within the buffer
+// capacity, and returns whether it has been appended in full.
+func appendString(buf []byte, s string) ([]byte, bool) {
+	free := cap(buf) - len(buf)
+	n := min(len(s), free)
+	n = min(n, free-uvarintLen(uint64(n)))
+
+	if n < 0 {
+		return buf, false
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(n))
+	buf = append(buf, s[:n]...)
+
+	return buf, n == len(s)
+}
+
+// marshal encodes the record payload within the argument buffer capacity.
+func (r *Record) marshal(buf []byte) []byte {
+	var ok bool
+
+	if buf, ok = appendUvarint(buf, r.PC); !ok {
+		return buf
+	}
+
+	if buf, ok = appendString(buf, r.Message); !ok {
+		return buf
+	}
+
+	buf, _ = appendString(buf, r.Trace)
+
+	return buf
+}
+
+func readString(buf []byte) (string, []byte, error) {
+	n, i := binary.Uvarint(buf)
+
+	if i <= 0 || uint64(len(buf)-i) < n {
+		return "", nil, errors.New("invalid string")
+	}
+
+	return string(buf[i : i+int(n)]), buf[i+int(n):], nil
+}
+
+// unmarshal decodes the record payload, truncated fields are left empty.
+func (r *Record) unmarshal(buf []byte) (err error) {
+	if len(buf) == 0 {
+		return
+	}
+
+	pc, n := binary.Uvarint(buf)
+
+	if n <= 0 {
+		return errors.New("invalid program counter")
+	}
+
+	r.PC = pc
+	buf = buf[n:]
+
+	if len(buf) == 0 {
+		return
+	}
+
+	if r.Message, buf, err = readString(buf); err != nil || len(buf) == 0 {
+		return
+	}
+
+	r.Trace, _, err = readString(buf)
+
+	return
+}
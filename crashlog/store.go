@@ -0,0 +1,136 @@
+// Persistent crash record
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package crashlog
+
+import (
+	"io"
+	"unsafe"
+)
+
+// Store represents a memory area retaining its content across warm resets.
+type Store interface {
+	io.ReaderAt
+	io.WriterAt
+
+	// Len returns the store capacity in bytes.
+	Len() int
+}
+
+// Memory represents a fixed memory window (e.g. OCRAM or a reserved DRAM
+// area), the window must be mapped as uncached or be otherwise cleaned from
+// data caches before reset.
+type Memory struct {
+	// Start address
+	Start uint
+	// Size in bytes
+	Size int
+}
+
+// Len returns the memory window size.
+func (m *Memory) Len() int {
+	return m.Size
+}
+
+func (m *Memory) mem() []byte {
+	var ptr unsafe.Pointer
+
+	ptr = unsafe.Add(ptr, m.Start)
+	return unsafe.Slice((*byte)(ptr), m.Size)
+}
+
+// ReadAt reads len(p) bytes from the memory window at the argument offset.
+func (m *Memory) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off >= int64(m.Size) {
+		return 0, io.EOF
+	}
+
+	if n = copy(p, m.mem()[off:]); n < len(p) {
+		err = io.EOF
+	}
+
+	return
+}
+
+// WriteAt writes len(p) bytes to the memory window at the argument offset.
+func (m *Memory) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 || off >= int64(m.Size) {
+		return 0, io.ErrShortWrite
+	}
+
+	if n = copy(m.mem()[off:], p); n < len(p) {
+		err = io.ErrShortWrite
+	}
+
+	return
+}
+
+// Registers represents a set of 32-bit registers retaining their content
+// across resets (e.g. SNVS LP General Purpose Registers).
+//
+// Example:
+//
+//	store := &crashlog.Registers{
+//		Read:  imx6ul.SNVS.ReadGPR,
+//		Write: imx6ul.SNVS.WriteGPR,
+//		Count: snvs.LPGPR_NUM,
+//	}
+type Registers struct {
+	// Read returns the value of the argument register index.
+	Read func(n int) uint32
+	// Write sets the value of the argument register index.
+	Write func(n int, val uint32)
+	// Count is the number of available registers.
+	Count int
+}
+
+// Len returns the registers capacity in bytes.
+func (r *Registers) Len() int {
+	return r.Count * 4
+}
+
+// ReadAt reads len(p) bytes from the registers at the argument offset, in
+// little-endian order.
+func (r *Registers) ReadAt(p []byte, off int64) (n int, err error) {
+	for ; n < len(p); n++ {
+		i := off + int64(n)
+
+		if i < 0 || i >= int64(r.Len()) {
+			return n, io.EOF
+		}
+
+		p[n] = byte(r.Read(int(i/4)) >> (8 * (i % 4)))
+	}
+
+	return
+}
+
+// WriteAt writes len(p) bytes to the registers at the argument offset, in
+// little-endian order.
+func (r *Registers) WriteAt(p []byte, off int64) (n int, err error) {
+	for n < len(p) {
+		i := off + int64(n)
+
+		if i < 0 || i >= int64(r.Len()) {
+			return n, io.ErrShortWrite
+		}
+
+		idx := int(i / 4)
+		val := r.Read(idx)
+
+		for shift := 8 * (i % 4); shift < 32 && n < len(p); shift += 8 {
+			val &^= 0xff << shift
+			val |= uint32(p[n]) << shift
+			n++
+		}
+
+		r.Write(idx, val)
+	}
+
+	return
+}
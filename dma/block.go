@@ -18,6 +18,10 @@ type block struct {
 	// distinguish regular (`Alloc`/`Free`) and reserved
 	// (`Reserve`/`Release`) blocks.
 	res bool
+
+	// allocation tracking
+	pc    uintptr
+	owner string
 }
 
 func (b *block) read(off uint, buf []byte) {
@@ -0,0 +1,127 @@
+// First-fit memory allocator for DMA buffers
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package dma
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// Coherency policies
+const (
+	// Uncached indicates that the region is mapped as non-cacheable, or
+	// is hardware coherent, no cache maintenance is performed (default).
+	Uncached = iota
+	// Cached indicates that the region is mapped as cacheable and not
+	// hardware coherent, explicit cache maintenance is performed.
+	Cached
+)
+
+// CacheMaintenance represents the by-address data cache maintenance
+// operations required for [Cached] regions, as implemented by arm.CPU and
+// arm64.CPU.
+type CacheMaintenance interface {
+	// DataCacheLineSize returns the smallest data cache line size.
+	DataCacheLineSize() int
+	// CleanDataCacheRange writes back the data cache lines for the given
+	// memory range.
+	CleanDataCacheRange(addr uint, size int)
+	// InvalidateDataCacheRange invalidates the data cache lines for the
+	// given memory range.
+	InvalidateDataCacheRange(addr uint, size int)
+}
+
+// SetCoherency sets the region coherency policy, it must be invoked before any
+// allocation.
+//
+// With the [Cached] policy allocations are aligned and sized to the cache line
+// size, [Region.Alloc] and [Region.Write] clean written data, [Region.Read]
+// invalidates read data. Buffers accessed directly, such as the ones allocated
+// with [Region.Reserve], require ownership hand-off with
+// [Region.SyncForDevice] and [Region.SyncForCPU].
+func (r *Region) SetCoherency(policy int, cache CacheMaintenance) error {
+	r.Lock()
+	defer r.Unlock()
+
+	switch policy {
+	case Uncached:
+		r.cache = nil
+		r.line = 0
+	case Cached:
+		if cache == nil {
+			return errors.New("missing cache maintenance instance")
+		}
+
+		line := cache.DataCacheLineSize()
+
+		if line <= 0 || line&(line-1) != 0 {
+			return errors.New("invalid cache line size")
+		}
+
+		r.cache = cache
+		r.line = uint(line)
+	default:
+		return errors.New("invalid policy")
+	}
+
+	r.policy = policy
+
+	return nil
+}
+
+// Coherency returns the region coherency policy.
+func (r *Region) Coherency() int {
+	return r.policy
+}
+
+func (r *Region) clean(addr uint, size int) {
+	if r.cache != nil {
+		r.cache.CleanDataCacheRange(addr, size)
+	}
+}
+
+func (r *Region) invalidate(addr uint, size int) {
+	if r.cache != nil {
+		r.cache.InvalidateDataCacheRange(addr, size)
+	}
+}
+
+// SyncForDevice hands off ownership of a buffer, within the region, to the
+// device by cleaning its data cache lines, it must be invoked after CPU writes
+// and before DMA transfers. The function has no effect on [Uncached] regions.
+func (r *Region) SyncForDevice(buf []byte) {
+	if r.cache == nil || len(buf) == 0 {
+		return
+	}
+
+	r.clean(uint(uintptr(unsafe.Pointer(&buf[0]))), len(buf))
+}
+
+// SyncForCPU hands off ownership of a buffer, within the region, to the CPU by
+// invalidating its data cache lines, it must be invoked after DMA transfers
+// and before CPU reads. The function has no effect on [Uncached] regions.
+func (r *Region) SyncForCPU(buf []byte) {
+	if r.cache == nil || len(buf) == 0 {
+		return
+	}
+
+	r.invalidate(uint(uintptr(unsafe.Pointer(&buf[0]))), len(buf))
+}
+
+// SyncForDevice is the equivalent of Region.SyncForDevice() on the global DMA
+// region.
+func SyncForDevice(buf []byte) {
+	dma.SyncForDevice(buf)
+}
+
+// SyncForCPU is the equivalent of Region.SyncForCPU() on the global DMA
+// region.
+func SyncForCPU(buf []byte) {
+	dma.SyncForCPU(buf)
+}
@@ -0,0 +1,111 @@
+// First-fit memory allocator for DMA buffers
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package dma
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PageState represents the memory page state conversion operations required
+// by confidential computing guests to share DMA buffers with the hypervisor,
+// as implemented by sev.SharedMemory for AMD SEV-SNP.
+type PageState interface {
+	// PageSize returns the page state conversion granularity.
+	PageSize() int
+	// SetShared converts a page aligned memory range to shared
+	// (unencrypted) or private (encrypted and validated) state.
+	SetShared(addr uint, size int, shared bool) error
+}
+
+// SetPageState enables page state conversion for the region, it must be
+// invoked before any allocation and with all region pages in private state.
+//
+// Once enabled the pages covering each allocated block are converted to shared
+// state, when the first block within them is allocated, and back to private
+// state, when the last block within them is freed.
+//
+// The use of [Region.Alloc], [Region.Read] and [Region.Write] with private Go
+// memory results in the region blocks acting as bounce buffers.
+func (r *Region) SetPageState(ps PageState) error {
+	r.Lock()
+	defer r.Unlock()
+
+	if len(r.usedBlocks) != 0 {
+		return errors.New("region in use")
+	}
+
+	if ps == nil {
+		r.ps = nil
+		r.pages = nil
+		return nil
+	}
+
+	size := ps.PageSize()
+
+	if size <= 0 || size&(size-1) != 0 {
+		return errors.New("invalid page size")
+	}
+
+	r.ps = ps
+	r.pageSize = uint(size)
+	r.pages = make(map[uint]int)
+
+	return nil
+}
+
+func (r *Region) setShared(start uint, end uint, shared bool) {
+	if err := r.ps.SetShared(start, int(end-start), shared); err != nil {
+		panic(fmt.Sprintf("dma: page state change failed, %v", err))
+	}
+}
+
+// share updates the page state reference count of all pages covering a block,
+// converting pages as required.
+func (r *Region) share(b *block, shared bool) {
+	var run uint
+	var pending bool
+
+	if r.ps == nil || b.size == 0 {
+		return
+	}
+
+	start := b.addr &^ (r.pageSize - 1)
+	end := (b.addr + b.size + r.pageSize - 1) &^ (r.pageSize - 1)
+
+	for page := start; page < end; page += r.pageSize {
+		var convert bool
+
+		n := r.pages[page]
+
+		if shared {
+			r.pages[page] = n + 1
+			convert = n == 0
+		} else if n <= 1 {
+			delete(r.pages, page)
+			convert = n == 1
+		} else {
+			r.pages[page] = n - 1
+		}
+
+		switch {
+		case convert && !pending:
+			// start a range of contiguous pages to convert
+			run = page
+			pending = true
+		case !convert && pending:
+			r.setShared(run, page, shared)
+			pending = false
+		}
+	}
+
+	if pending {
+		r.setShared(run, end, shared)
+	}
+}
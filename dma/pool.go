@@ -0,0 +1,304 @@
+// First-fit memory allocator for DMA buffers
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package dma
+
+import (
+	"errors"
+	"runtime"
+	"runtime/goos"
+	"sync"
+	"sync/atomic"
+)
+
+// maximum number of buffers held by each per-CPU cache
+const poolCacheSize = 32
+
+// PoolStats represents DMA buffer pool statistics.
+type PoolStats struct {
+	// Buffers is the total number of pool buffers.
+	Buffers int
+	// InUse is the number of buffers currently allocated.
+	InUse int
+	// HighWater is the maximum number of buffers concurrently allocated.
+	HighWater int
+	// Gets is the number of successful buffer allocations.
+	Gets uint64
+	// Puts is the number of buffer releases.
+	Puts uint64
+	// Exhausted is the number of allocations failed due to pool
+	// exhaustion.
+	Exhausted uint64
+}
+
+type poolCache struct {
+	sync.Mutex
+	free []uint32
+}
+
+// Pool represents a pool of fixed size DMA buffers, pre-reserved from a
+// [Region], which are allocated and freed in constant time without walking the
+// region block lists.
+//
+// On SMP systems each processor is assigned a cache of free buffers to reduce
+// lock contention.
+type Pool struct {
+	sync.Mutex
+
+	region *Region
+
+	addr   uint
+	buf    []byte
+	size   int
+	stride int
+	n      int
+
+	// free buffer indices
+	free   []uint32
+	caches []*poolCache
+	batch  int
+
+	// allocation state, by buffer index
+	used []atomic.Bool
+
+	inUse     atomic.Int64
+	highWater atomic.Int64
+	gets      atomic.Uint64
+	puts      atomic.Uint64
+	exhausted atomic.Uint64
+}
+
+// NewPool reserves n buffers of the given size, with optional alignment, for
+// fixed size DMA allocation through the returned pool.
+//
+// The optional alignment must be a power of 2 and word alignment is always
+// enforced, 0 means 4 on 32-bit platforms and 8 on 64-bit ones.
+func (r *Region) NewPool(n int, size int, align int) (p *Pool, err error) {
+	if n <= 0 || size <= 0 {
+		return nil, errors.New("invalid pool size")
+	}
+
+	if align == 0 || align&(align-1) != 0 {
+		align = DefaultAlignment
+	}
+
+	align = max(align, int(r.line))
+
+	// each buffer start is aligned
+	stride := (size + align - 1) &^ (align - 1)
+
+	r.Lock()
+	b := r.allocBlock(uint(n*stride), uint(align))
+
+	if b == nil {
+		r.Unlock()
+		return nil, errors.New("out of memory")
+	}
+
+	b.res = true
+	r.usedBlocks[b.addr] = b
+	r.Unlock()
+
+	p = &Pool{
+		region: r,
+		addr:   b.addr,
+		buf:    b.slice(),
+		size:   size,
+		stride: stride,
+		n:      n,
+		free:   make([]uint32, 0, n),
+		used:   make([]atomic.Bool, n),
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		p.free = append(p.free, uint32(i))
+	}
+
+	if cpus := runtime.NumCPU(); cpus > 1 && goos.ProcID != nil {
+		p.batch = min(poolCacheSize, n/(2*cpus)) / 2
+
+		for range cpus {
+			p.caches = append(p.caches, &poolCache{
+				free: make([]uint32, 0, 2*p.batch+1),
+			})
+		}
+	}
+
+	return
+}
+
+// NewPool is the equivalent of Region.NewPool() on the global DMA region.
+func NewPool(n int, size int, align int) (p *Pool, err error) {
+	return dma.NewPool(n, size, align)
+}
+
+// Size returns the pool buffer size.
+func (p *Pool) Size() int {
+	return p.size
+}
+
+func (p *Pool) cache() *poolCache {
+	if p.batch == 0 {
+		return nil
+	}
+
+	return p.caches[goos.ProcID()%uint64(len(p.caches))]
+}
+
+// pop takes up to n buffers from the shared free list.
+func (p *Pool) pop(dst []uint32, n int) []uint32 {
+	p.Lock()
+	defer p.Unlock()
+
+	n = min(n, len(p.free))
+	off := len(p.free) - n
+
+	dst = append(dst, p.free[off:]...)
+	p.free = p.free[:off]
+
+	return dst
+}
+
+// push returns buffers to the shared free list.
+func (p *Pool) push(src []uint32) {
+	p.Lock()
+	defer p.Unlock()
+
+	p.free = append(p.free, src...)
+}
+
+// drain returns all per-CPU cached buffers to the shared free list.
+func (p *Pool) drain() {
+	for _, c := range p.caches {
+		c.Lock()
+		p.push(c.free)
+		c.free = c.free[:0]
+		c.Unlock()
+	}
+}
+
+func (p *Pool) get() (i uint32, ok bool) {
+	if c := p.cache(); c != nil {
+		c.Lock()
+		defer c.Unlock()
+
+		if len(c.free) == 0 {
+			c.free = p.pop(c.free, p.batch)
+		}
+
+		if n := len(c.free); n > 0 {
+			i = c.free[n-1]
+			c.free = c.free[:n-1]
+			return i, true
+		}
+
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if n := len(p.free); n > 0 {
+		i = p.free[n-1]
+		p.free = p.free[:n-1]
+		return i, true
+	}
+
+	return
+}
+
+// Get allocates a buffer from the pool, returning its address and a slice of
+// its DMA memory, the buffer can be freed up with [Pool.Put].
+//
+// As with [Region.Reserve] the buffer contents are uninitialized, a nil buffer
+// is returned if the pool is exhausted.
+func (p *Pool) Get() (addr uint, buf []byte) {
+	i, ok := p.get()
+
+	if !ok && p.batch > 0 {
+		// reclaim buffers held by other processors
+		p.drain()
+		i, ok = p.get()
+	}
+
+	if !ok {
+		p.exhausted.Add(1)
+		return
+	}
+
+	p.used[i].Store(true)
+	p.gets.Add(1)
+
+	for n := p.inUse.Add(1); ; {
+		if prev := p.highWater.Load(); n <= prev || p.highWater.CompareAndSwap(prev, n) {
+			break
+		}
+	}
+
+	off := int(i) * p.stride
+
+	return p.addr + uint(off), p.buf[off : off+p.size : off+p.size]
+}
+
+// Put frees a buffer previously allocated with [Pool.Get], it panics if the
+// buffer does not belong to the pool or is not allocated.
+func (p *Pool) Put(addr uint) {
+	if addr < p.addr || addr >= p.addr+uint(p.n*p.stride) || (addr-p.addr)%uint(p.stride) != 0 {
+		panic("invalid pool buffer")
+	}
+
+	i := uint32((addr - p.addr) / uint(p.stride))
+
+	if !p.used[i].CompareAndSwap(true, false) {
+		panic("pool buffer not allocated")
+	}
+
+	p.puts.Add(1)
+	p.inUse.Add(-1)
+
+	if c := p.cache(); c != nil {
+		c.Lock()
+		defer c.Unlock()
+
+		c.free = append(c.free, i)
+
+		if len(c.free) > 2*p.batch {
+			// spill excess buffers to the shared free list
+			off := len(c.free) - p.batch
+			p.push(c.free[off:])
+			c.free = c.free[:off]
+		}
+
+		return
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.free = append(p.free, i)
+}
+
+// Stats returns the pool statistics.
+func (p *Pool) Stats() PoolStats {
+	return PoolStats{
+		Buffers:   p.n,
+		InUse:     int(p.inUse.Load()),
+		HighWater: int(p.highWater.Load()),
+		Gets:      p.gets.Load(),
+		Puts:      p.puts.Load(),
+		Exhausted: p.exhausted.Load(),
+	}
+}
+
+// Destroy releases all pool buffers, which must no longer be in use.
+func (p *Pool) Destroy() {
+	p.region.Release(p.addr)
+	p.buf = nil
+	p.free = nil
+	p.caches = nil
+}
@@ -25,6 +25,23 @@ type Region struct {
 
 	freeBlocks *list.List
 	usedBlocks map[uint]*block
+
+	// coherency policy
+	policy int
+	cache  CacheMaintenance
+	line   uint
+
+	// allocation statistics and debugging
+	used      uint
+	highWater uint
+	tracking  bool
+	debug     bool
+	freed     map[uint]bool
+
+	// page state conversion
+	ps       PageState
+	pageSize uint
+	pages    map[uint]int
 }
 
 // global DMA region instance
@@ -118,7 +135,7 @@ func (r *Region) Reserve(size int, align int) (addr uint, buf []byte) {
 
 	r.usedBlocks[b.addr] = b
 
-	return b.addr, b.slice()
+	return b.addr, b.slice()[:size]
 }
 
 // Reserved returns whether a slice of bytes data is allocated within the DMA
@@ -156,6 +173,7 @@ func (r *Region) Alloc(buf []byte, align int) (addr uint) {
 
 	b := r.alloc(uint(size), uint(align))
 	b.write(0, buf)
+	r.clean(b.addr, size)
 
 	r.usedBlocks[b.addr] = b
 
@@ -196,6 +214,7 @@ func (r *Region) Read(addr uint, off int, buf []byte) {
 		panic("invalid read parameters")
 	}
 
+	r.invalidate(b.addr+uint(off), size)
 	b.read(uint(off), buf)
 }
 
@@ -226,6 +245,7 @@ func (r *Region) Write(addr uint, off int, buf []byte) {
 	}
 
 	b.write(uint(off), buf)
+	r.clean(b.addr+uint(off), size)
 }
 
 // Free frees the memory region stored at the passed address, the region must
@@ -260,6 +280,18 @@ func (r *Region) defrag() {
 }
 
 func (r *Region) alloc(size uint, align uint) *block {
+	b := r.allocBlock(size, align)
+
+	if b == nil {
+		panic("out of memory")
+	}
+
+	return b
+}
+
+// allocBlock allocates a block of the given size and alignment, nil is
+// returned if no suitable free block is available.
+func (r *Region) allocBlock(size uint, align uint) *block {
 	var e *list.Element
 	var freeBlock *block
 	var pad uint
@@ -268,6 +300,12 @@ func (r *Region) alloc(size uint, align uint) *block {
 		align = DefaultAlignment
 	}
 
+	if r.line != 0 {
+		// prevent cache line sharing among allocations
+		align = max(align, r.line)
+		size = (size + r.line - 1) &^ (r.line - 1)
+	}
+
 	// find suitable block
 	for e = r.freeBlocks.Front(); e != nil; e = e.Next() {
 		b := e.Value.(*block)
@@ -283,7 +321,7 @@ func (r *Region) alloc(size uint, align uint) *block {
 	}
 
 	if freeBlock == nil {
-		panic("out of memory")
+		return nil
 	}
 
 	// allocate block from free linked list
@@ -312,10 +350,14 @@ func (r *Region) alloc(size uint, align uint) *block {
 		r.freeBlocks.InsertBefore(newBlockBefore, e)
 	}
 
+	r.track(freeBlock)
+
 	return freeBlock
 }
 
 func (r *Region) free(usedBlock *block) {
+	r.untrack(usedBlock)
+
 	for e := r.freeBlocks.Front(); e != nil; e = e.Next() {
 		b := e.Value.(*block)
 
@@ -340,10 +382,12 @@ func (r *Region) freeBlock(addr uint, res bool) {
 	b, ok := r.usedBlocks[addr]
 
 	if !ok {
+		r.checkFree(addr, nil, res)
 		return
 	}
 
 	if b.res != res {
+		r.checkFree(addr, b, res)
 		return
 	}
 
@@ -0,0 +1,250 @@
+// First-fit memory allocator for DMA buffers
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package dma
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// PoisonByte is the value used to fill freed blocks in debug mode.
+const PoisonByte = 0x6b
+
+// OwnerStats represents the DMA allocations of a single owner.
+type OwnerStats struct {
+	// Owner is the allocation tag, or the allocating function name.
+	Owner string
+	// Blocks is the number of allocated blocks.
+	Blocks int
+	// Size is the total size of allocated blocks.
+	Size uint
+}
+
+// Report represents DMA region usage statistics.
+type Report struct {
+	// Size is the region size.
+	Size uint
+	// Used is the total size of allocated blocks.
+	Used uint
+	// Free is the total size of free blocks.
+	Free uint
+	// HighWater is the maximum total size of allocated blocks.
+	HighWater uint
+
+	// UsedBlocks is the number of allocated blocks.
+	UsedBlocks int
+	// FreeBlocks is the number of free blocks.
+	FreeBlocks int
+	// LargestFree is the size of the largest free block.
+	LargestFree uint
+	// Fragmentation is the fraction of free space not available for
+	// allocation in the largest free block (0 when not fragmented).
+	Fragmentation float64
+
+	// Owners lists allocation totals by owner, in decreasing size order,
+	// it is populated only when tracking is enabled.
+	Owners []OwnerStats
+}
+
+// String returns the report in textual format.
+func (rep *Report) String() string {
+	var s strings.Builder
+
+	fmt.Fprintf(&s, "size:%d used:%d free:%d high-water:%d\n", rep.Size, rep.Used, rep.Free, rep.HighWater)
+	fmt.Fprintf(&s, "blocks used:%d free:%d largest free:%d fragmentation:%.2f\n", rep.UsedBlocks, rep.FreeBlocks, rep.LargestFree, rep.Fragmentation)
+
+	for _, o := range rep.Owners {
+		fmt.Fprintf(&s, "%8d %6d %s\n", o.Size, o.Blocks, o.Owner)
+	}
+
+	return s.String()
+}
+
+// SetTracking enables or disables allocation tracking, when enabled each
+// allocated block records its allocating function, or an owner set with
+// [Region.Tag], for reporting purposes.
+func (r *Region) SetTracking(enable bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.tracking = enable
+}
+
+// SetDebug enables or disables debug mode, when enabled freed blocks are
+// filled with [PoisonByte] and invalid or repeated Free()/Release() calls
+// cause a panic.
+func (r *Region) SetDebug(enable bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.debug = enable
+	r.freed = nil
+
+	if enable {
+		r.freed = make(map[uint]bool)
+	}
+}
+
+// Tag sets the owner label of an allocated block, it has no effect when
+// tracking is disabled.
+func (r *Region) Tag(addr uint, owner string) {
+	r.Lock()
+	defer r.Unlock()
+
+	if b, ok := r.usedBlocks[addr]; ok && r.tracking {
+		b.owner = owner
+	}
+}
+
+// Report returns the region usage statistics.
+func (r *Region) Report() (rep *Report) {
+	r.Lock()
+	defer r.Unlock()
+
+	rep = &Report{
+		Size:       r.size,
+		Used:       r.used,
+		HighWater:  r.highWater,
+		UsedBlocks: len(r.usedBlocks),
+	}
+
+	for e := r.freeBlocks.Front(); e != nil; e = e.Next() {
+		b := e.Value.(*block)
+
+		rep.Free += b.size
+		rep.FreeBlocks += 1
+		rep.LargestFree = max(rep.LargestFree, b.size)
+	}
+
+	if rep.Free > 0 {
+		rep.Fragmentation = 1 - float64(rep.LargestFree)/float64(rep.Free)
+	}
+
+	if !r.tracking {
+		return
+	}
+
+	owners := make(map[string]*OwnerStats)
+
+	for _, b := range r.usedBlocks {
+		owner := b.owner
+
+		if owner == "" {
+			owner = "unknown"
+
+			if f := runtime.FuncForPC(b.pc); f != nil {
+				owner = f.Name()
+			}
+		}
+
+		o, ok := owners[owner]
+
+		if !ok {
+			o = &OwnerStats{Owner: owner}
+			owners[owner] = o
+		}
+
+		o.Blocks += 1
+		o.Size += b.size
+	}
+
+	for _, o := range owners {
+		rep.Owners = append(rep.Owners, *o)
+	}
+
+	sort.Slice(rep.Owners, func(i, j int) bool {
+		return rep.Owners[i].Size > rep.Owners[j].Size
+	})
+
+	return
+}
+
+// caller returns the program counter of the first caller outside this
+// package.
+func caller() uintptr {
+	var pcs [16]uintptr
+
+	n := runtime.Callers(3, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		f, more := frames.Next()
+
+		if !strings.HasPrefix(f.Function, "github.com/usbarmory/tamago/dma.") {
+			return f.PC
+		}
+
+		if !more {
+			return 0
+		}
+	}
+}
+
+// track updates allocation statistics and tracking information of an
+// allocated block.
+func (r *Region) track(b *block) {
+	b.pc = 0
+	b.owner = ""
+
+	if r.used += b.size; r.used > r.highWater {
+		r.highWater = r.used
+	}
+
+	if r.tracking {
+		b.pc = caller()
+	}
+
+	r.share(b, true)
+
+	if r.debug {
+		for addr := range r.freed {
+			if addr >= b.addr && addr < b.addr+b.size {
+				delete(r.freed, addr)
+			}
+		}
+	}
+}
+
+// untrack updates allocation statistics and debugging information of a freed
+// block.
+func (r *Region) untrack(b *block) {
+	r.used -= b.size
+
+	if r.debug {
+		buf := b.slice()
+
+		for i := range buf {
+			buf[i] = PoisonByte
+		}
+
+		r.freed[b.addr] = true
+	}
+
+	r.share(b, false)
+}
+
+// checkFree validates a Free()/Release() request in debug mode.
+func (r *Region) checkFree(addr uint, b *block, res bool) {
+	if !r.debug {
+		return
+	}
+
+	switch {
+	case b == nil && r.freed[addr]:
+		panic(fmt.Sprintf("dma: double free of %#x", addr))
+	case b == nil:
+		panic(fmt.Sprintf("dma: free of unallocated pointer %#x", addr))
+	case b.res && !res:
+		panic(fmt.Sprintf("dma: Free() of reserved pointer %#x", addr))
+	case !b.res && res:
+		panic(fmt.Sprintf("dma: Release() of allocated pointer %#x", addr))
+	}
+}
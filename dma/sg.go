@@ -0,0 +1,232 @@
+// First-fit memory allocator for DMA buffers
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package dma
+
+import (
+	"errors"
+	"io"
+)
+
+// Segment represents a scatter-gather list entry.
+type Segment struct {
+	// Addr is the segment physical address.
+	Addr uint
+	// Size is the segment length.
+	Size int
+}
+
+// ScatterGather represents a scatter-gather list of DMA buffers, allocated
+// from a [Region] with [Region.ReserveSG].
+type ScatterGather struct {
+	// Segments is the list of allocated DMA buffers.
+	Segments []Segment
+
+	region *Region
+	blocks []*block
+	size   int
+}
+
+// largest returns the largest allocation, up to size, which can be currently
+// satisfied by a single free block with the given alignment.
+func (r *Region) largest(size uint, align uint) (n uint) {
+	for e := r.freeBlocks.Front(); e != nil; e = e.Next() {
+		b := e.Value.(*block)
+		pad := -b.addr & (align - 1)
+
+		if b.size > pad && b.size-pad > n {
+			n = b.size - pad
+		}
+
+		if n >= size {
+			return size
+		}
+	}
+
+	return
+}
+
+// ReserveSG allocates a scatter-gather list of DMA buffers, with optional
+// alignment, for a total of size bytes. The list can be freed up with
+// [ScatterGather.Release].
+//
+// A single contiguous buffer is allocated when possible, otherwise, when the
+// region is fragmented, multiple smaller buffers are allocated. The maximum
+// size of each segment can be limited with maxSegment (0 for no limit), all
+// segments but the last one are sized as a multiple of the alignment.
+//
+// As with [Region.Reserve] the buffers contents are uninitialized.
+//
+// The optional alignment must be a power of 2 and word alignment is always
+// enforced, 0 means 4 on 32-bit platforms and 8 on 64-bit ones.
+func (r *Region) ReserveSG(size int, align int, maxSegment int) (sg *ScatterGather, err error) {
+	if size <= 0 {
+		return nil, errors.New("invalid size")
+	}
+
+	if align == 0 || align&(align-1) != 0 {
+		align = DefaultAlignment
+	}
+
+	align = max(align, int(r.line))
+
+	if maxSegment <= 0 || maxSegment > size {
+		maxSegment = size
+	}
+
+	if maxSegment < size {
+		// round segments to alignment
+		if maxSegment -= maxSegment % align; maxSegment == 0 {
+			return nil, errors.New("invalid segment size")
+		}
+	}
+
+	sg = &ScatterGather{
+		region: r,
+		size:   size,
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	for left := uint(size); left > 0; {
+		n := r.largest(min(left, uint(maxSegment)), uint(align))
+
+		if n < left {
+			n -= n % uint(align)
+		}
+
+		if n == 0 {
+			sg.release()
+			return nil, errors.New("out of memory")
+		}
+
+		b := r.allocBlock(n, uint(align))
+
+		if b == nil {
+			sg.release()
+			return nil, errors.New("out of memory")
+		}
+
+		b.res = true
+
+		r.usedBlocks[b.addr] = b
+
+		sg.blocks = append(sg.blocks, b)
+		sg.Segments = append(sg.Segments, Segment{Addr: b.addr, Size: int(n)})
+
+		left -= n
+	}
+
+	return
+}
+
+// ReserveSG is the equivalent of Region.ReserveSG() on the global DMA region.
+func ReserveSG(size int, align int, maxSegment int) (sg *ScatterGather, err error) {
+	return dma.ReserveSG(size, align, maxSegment)
+}
+
+// Len returns the scatter-gather list total size.
+func (sg *ScatterGather) Len() int {
+	return sg.size
+}
+
+// Slices returns the scatter-gather list buffers, as slices of the DMA region
+// bounded to each segment size, for direct access.
+func (sg *ScatterGather) Slices() (bufs [][]byte) {
+	for i, b := range sg.blocks {
+		size := sg.Segments[i].Size
+		bufs = append(bufs, b.slice()[:size:size])
+	}
+
+	return
+}
+
+// ReadAt copies the scatter-gather list contents, at offset off, to p. It
+// implements the [io.ReaderAt] interface.
+func (sg *ScatterGather) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("invalid offset")
+	}
+
+	for i, b := range sg.blocks {
+		if n == len(p) {
+			break
+		}
+
+		segSize := int64(sg.Segments[i].Size)
+
+		if off >= segSize {
+			off -= segSize
+			continue
+		}
+
+		size := uint(min(int64(len(p)-n), segSize-off))
+		b.read(uint(off), p[n:n+int(size)])
+
+		n += int(size)
+		off = 0
+	}
+
+	if n < len(p) {
+		err = io.EOF
+	}
+
+	return
+}
+
+// WriteAt copies p to the scatter-gather list, at offset off. It implements
+// the [io.WriterAt] interface.
+func (sg *ScatterGather) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("invalid offset")
+	}
+
+	for i, b := range sg.blocks {
+		if n == len(p) {
+			break
+		}
+
+		segSize := int64(sg.Segments[i].Size)
+
+		if off >= segSize {
+			off -= segSize
+			continue
+		}
+
+		size := uint(min(int64(len(p)-n), segSize-off))
+		b.write(uint(off), p[n:n+int(size)])
+
+		n += int(size)
+		off = 0
+	}
+
+	if n < len(p) {
+		err = io.ErrShortWrite
+	}
+
+	return
+}
+
+func (sg *ScatterGather) release() {
+	for _, b := range sg.blocks {
+		sg.region.free(b)
+		delete(sg.region.usedBlocks, b.addr)
+	}
+
+	sg.blocks = nil
+	sg.Segments = nil
+}
+
+// Release frees all scatter-gather list buffers.
+func (sg *ScatterGather) Release() {
+	sg.region.Lock()
+	defer sg.region.Unlock()
+
+	sg.release()
+}
@@ -0,0 +1,138 @@
+// Processor exception handling
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package fault provides a portable interface to register handlers for
+// processor exceptions, across all supported architectures, to inspect the
+// exception context and either recover from it or handle it (e.g. log,
+// zeroize secrets, reset) before the default handling takes place.
+//
+// Processor packages capture the exception register frame in a typed
+// structure (e.g. arm.ExceptionContext, arm64.ExceptionContext,
+// riscv64.ExceptionContext, amd64.ExceptionContext) and pass it to Handle
+// before invoking their SystemExceptionHandler.
+//
+// Handlers are invoked on the system stack (g0) with the faulting goroutine
+// suspended, therefore they must not block, allocate memory or rely on the Go
+// scheduler.
+//
+// Example:
+//
+//	fault.SetHandler(fault.DataFault, func(ctx fault.Context) bool {
+//		print("data fault at ", ctx.Address(), "\n")
+//		ctx.Print()
+//
+//		zeroize()
+//		reset()
+//
+//		return false
+//	})
+//
+// This package is only meant to be used with `GOOS=tamago` as supported by the
+// TamaGo framework for bare metal Go, see
+// https://github.com/usbarmory/tamago.
+package fault
+
+// Class represents a portable processor exception class.
+type Class int
+
+// Exception classes
+const (
+	// Unknown represents exceptions not mapped to any other class.
+	Unknown Class = iota
+	// UndefinedInstruction represents undefined or illegal instructions.
+	UndefinedInstruction
+	// Breakpoint represents breakpoint instructions and debug events.
+	Breakpoint
+	// Syscall represents supervisor or environment call instructions.
+	Syscall
+	// InstructionFault represents instruction fetch aborts or faults.
+	InstructionFault
+	// DataFault represents data access aborts or faults.
+	DataFault
+	// Alignment represents unaligned instruction, data or stack access.
+	Alignment
+	// Arithmetic represents division and floating point exceptions.
+	Arithmetic
+	// SystemError represents asynchronous aborts, machine checks and
+	// double faults.
+	SystemError
+
+	numClasses
+)
+
+// String returns the exception class name.
+func (c Class) String() string {
+	switch c {
+	case UndefinedInstruction:
+		return "undefined instruction"
+	case Breakpoint:
+		return "breakpoint"
+	case Syscall:
+		return "syscall"
+	case InstructionFault:
+		return "instruction fault"
+	case DataFault:
+		return "data fault"
+	case Alignment:
+		return "alignment"
+	case Arithmetic:
+		return "arithmetic"
+	case SystemError:
+		return "system error"
+	}
+
+	return "unknown"
+}
+
+// Context represents the processor state captured at exception, the
+// architecture specific structure can be accessed with a type assertion for
+// full register access.
+type Context interface {
+	// Class returns the exception class.
+	Class() Class
+	// ProgramCounter returns the exception program counter.
+	ProgramCounter() uintptr
+	// SetProgramCounter updates the program counter at which execution
+	// is resumed.
+	SetProgramCounter(pc uintptr)
+	// Address returns the faulting memory address, when available.
+	Address() uintptr
+	// Print prints the exception context registers.
+	Print()
+}
+
+// Handler represents an exception handler, execution is resumed with the
+// (possibly modified) exception context when it returns true, otherwise the
+// default exception handling takes place.
+type Handler func(ctx Context) bool
+
+var handlers [numClasses]Handler
+
+// SetHandler registers the exception handler for the argument class, a nil
+// handler restores the default exception handling.
+func SetHandler(class Class, fn Handler) {
+	if class < 0 || class >= numClasses {
+		return
+	}
+
+	handlers[class] = fn
+}
+
+// Handle invokes the exception handler registered for the context class, it
+// returns whether execution should be resumed.
+//
+// Handle is meant to be invoked by processor packages exception handlers.
+func Handle(ctx Context) bool {
+	class := ctx.Class()
+
+	if class < 0 || class >= numClasses || handlers[class] == nil {
+		return false
+	}
+
+	return handlers[class](ctx)
+}
@@ -0,0 +1,485 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build amd64 || arm || arm64 || riscv64
+
+// Package gdbstub implements a GDB Remote Serial Protocol (RSP) stub, allowing
+// source level debugging of TamaGo unikernels through any [io.ReadWriter]
+// (e.g. a serial port), adopting the following reference specifications:
+//   - Debugging with GDB - Appendix E GDB Remote Serial Protocol
+//
+// The stub hooks the processor exception vectors used for breakpoints and
+// single-stepping, when an exception is taken the world is stopped and the
+// debugger is served, on the g0 stack, until execution is resumed.
+//
+// Register and memory read/write, software breakpoints and single-stepping
+// are supported. Single-stepping is performed in hardware on amd64 and arm64,
+// and by the debugger, through temporary breakpoints, on arm and riscv64.
+//
+// The stub is meant for single-core operation and it does not allocate while
+// serving the debugger, its connection must therefore not yield to the
+// scheduler: connections implementing a non-blocking `Rx` method (e.g.
+// soc/nxp/uart, soc/intel/uart, soc/sifive/uart) are polled through it rather
+// than through `Read`.
+//
+// Example, with `qemu -serial pty` or a physical serial port:
+//
+//	stub := &gdbstub.Stub{Conn: uart}
+//	stub.Init(cpu)
+//	stub.Break()
+//
+//	$ gdb -ex 'target remote /dev/pts/N' example.elf
+//
+// This package is only meant to be used with `GOOS=tamago` as supported by the
+// TamaGo framework for bare metal Go, see https://github.com/usbarmory/tamago.
+package gdbstub
+
+import (
+	"bytes"
+	"io"
+	"runtime/goos"
+	"unsafe"
+)
+
+// Signals reported to the debugger
+const (
+	SIGILL  = 4
+	SIGTRAP = 5
+	SIGBUS  = 7
+	SIGSEGV = 11
+)
+
+// MaxBreakpoints is the maximum number of software breakpoints.
+const MaxBreakpoints = 64
+
+// packetSize is the maximum packet size
+const packetSize = 4096
+
+// target description transfer request prefix
+const xferTarget = "qXfer:features:read:target.xml:"
+
+// Region represents a memory range accessible by the debugger.
+type Region struct {
+	// Start address
+	Start uint
+	// Size in bytes
+	Size uint
+}
+
+type swbreak struct {
+	addr uint
+	size int
+	orig [4]byte
+}
+
+// Stub represents a GDB remote serial protocol stub instance.
+type Stub struct {
+	// Conn is the debugger connection.
+	Conn io.ReadWriter
+
+	// Memory holds the memory ranges, besides the runtime RAM (see
+	// `goos.RamStart`), accessible by the debugger (e.g. MMIO). Requests
+	// outside such ranges are rejected, as faults cannot be taken while
+	// serving the debugger.
+	Memory []Region
+
+	cpu *processor
+	rx  func() (byte, bool)
+	rb  [1]byte
+
+	breakpoints [MaxBreakpoints]swbreak
+	active      int
+
+	noAck bool
+	in    [packetSize]byte
+	out   [packetSize + 4]byte
+	reply []byte
+}
+
+var (
+	// trap frame, saved and restored by the exception handlers
+	frame Frame
+	// instance serving exceptions
+	stub *Stub
+)
+
+func (s *Stub) init(cpu *processor) {
+	switch conn := s.Conn.(type) {
+	case interface{ Rx() (byte, bool) }:
+		s.rx = conn.Rx
+	case interface{ Rx(bool) (byte, bool) }:
+		s.rx = func() (byte, bool) { return conn.Rx(false) }
+	default:
+		s.rx = func() (byte, bool) {
+			n, _ := s.Conn.Read(s.rb[:])
+			return s.rb[0], n == 1
+		}
+	}
+
+	s.cpu = cpu
+	stub = s
+}
+
+// Break stops execution and waits for the debugger, it is typically invoked
+// once the stub is initialized, to allow the debugger to attach.
+func (s *Stub) Break() {
+	breakpoint()
+}
+
+// trap serves the debugger on exceptions raised with the argument signal.
+func (s *Stub) trap(sig int) {
+	pc := frame.pc()
+
+	// step over compiled-in breakpoints (see Break())
+	if sig == SIGTRAP && s.lookup(pc) < 0 && s.isBreakpoint(pc) {
+		frame.setPC(pc + breakSkip)
+	}
+
+	frame.step(false)
+	s.serve(sig)
+}
+
+func (s *Stub) lookup(addr uint) int {
+	for i := 0; i < s.active; i++ {
+		if s.breakpoints[i].addr == addr {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (s *Stub) isBreakpoint(addr uint) bool {
+	return s.accessible(addr, len(breakInstr)) && bytes.Equal(mem(addr, len(breakInstr)), breakInstr)
+}
+
+// accessible returns whether the argument memory range lies within the
+// runtime RAM or any of the debugger accessible regions.
+func (s *Stub) accessible(addr uint, size int) bool {
+	end := addr + uint(size)
+
+	if size < 0 || end < addr {
+		return false
+	}
+
+	if addr >= goos.RamStart && end <= goos.RamStart+goos.RamSize {
+		return true
+	}
+
+	for _, r := range s.Memory {
+		if addr >= r.Start && end <= r.Start+r.Size {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mem returns a slice for direct access to the argument memory range.
+func mem(addr uint, size int) []byte {
+	var ptr unsafe.Pointer
+
+	ptr = unsafe.Add(ptr, addr)
+	return unsafe.Slice((*byte)(ptr), size)
+}
+
+func (s *Stub) insertBreakpoint(addr uint, kind int) bool {
+	if s.lookup(addr) >= 0 {
+		return true
+	}
+
+	if s.active == MaxBreakpoints {
+		return false
+	}
+
+	instr := breakInstruction(kind)
+
+	bp := &s.breakpoints[s.active]
+	bp.addr = addr
+	bp.size = copy(bp.orig[:], mem(addr, len(instr)))
+
+	s.write(addr, instr)
+	s.active++
+
+	return true
+}
+
+func (s *Stub) removeBreakpoint(addr uint) bool {
+	i := s.lookup(addr)
+
+	if i < 0 {
+		return false
+	}
+
+	s.write(addr, s.breakpoints[i].orig[:s.breakpoints[i].size])
+
+	s.active--
+	s.breakpoints[i] = s.breakpoints[s.active]
+
+	return true
+}
+
+// removeBreakpoints removes all breakpoints, it is invoked when the debugger
+// detaches.
+func (s *Stub) removeBreakpoints() {
+	for s.active > 0 {
+		s.removeBreakpoint(s.breakpoints[0].addr)
+	}
+}
+
+// write updates memory, ensuring instruction fetches observe the change.
+func (s *Stub) write(addr uint, buf []byte) {
+	copy(mem(addr, len(buf)), buf)
+	flushCache(s.cpu, addr, len(buf))
+}
+
+// serve handles debugger commands until execution is resumed.
+func (s *Stub) serve(sig int) {
+	s.stopReply(sig)
+
+	for {
+		pkt := s.receive()
+		s.reply = s.out[:1]
+
+		if len(pkt) == 0 {
+			s.send()
+			continue
+		}
+
+		if bytes.Equal(pkt, []byte("QStartNoAckMode")) {
+			s.putString("OK")
+			s.send()
+			s.noAck = true
+			continue
+		}
+
+		cmd, args := pkt[0], pkt[1:]
+
+		switch cmd {
+		case '?':
+			s.stopReply(sig)
+			continue
+		case 'g':
+			for n := 0; n < numRegisters; n++ {
+				s.putHex(frame.register(n))
+			}
+		case 'G':
+			for n := 0; n < numRegisters && len(args) > 0; n++ {
+				args = decodeHex(frame.register(n), args)
+			}
+
+			s.putString("OK")
+		case 'p':
+			if n, _, ok := parseHex(args); ok && frame.register(int(n)) != nil {
+				s.putHex(frame.register(int(n)))
+			} else {
+				s.putString("E01")
+			}
+		case 'P':
+			n, args, ok := parseHex(args)
+
+			if r := frame.register(int(n)); ok && r != nil && len(args) > 0 && args[0] == '=' {
+				decodeHex(r, args[1:])
+				s.putString("OK")
+			} else {
+				s.putString("E01")
+			}
+		case 'm':
+			addr, size, _, ok := parseRange(args)
+
+			if !ok {
+				s.putString("E01")
+				break
+			}
+
+			size = min(size, (packetSize-1)/2)
+
+			if !s.accessible(addr, size) {
+				s.putString("E14")
+				break
+			}
+
+			s.putHex(mem(addr, size))
+		case 'M':
+			addr, size, args, ok := parseRange(args)
+
+			if !ok || len(args) != 1+size*2 || args[0] != ':' {
+				s.putString("E01")
+				break
+			}
+
+			if !s.accessible(addr, size) {
+				s.putString("E14")
+				break
+			}
+
+			decodeHex(mem(addr, size), args[1:])
+			flushCache(s.cpu, addr, size)
+			s.putString("OK")
+		case 'Z', 'z':
+			s.handleBreakpoint(cmd == 'Z', args)
+		case 'c', 's':
+			if s.resume(cmd == 's', args) {
+				return
+			}
+		case 'C', 'S':
+			// ignore signal
+			if i := bytes.IndexByte(args, ';'); i >= 0 {
+				args = args[i+1:]
+			} else {
+				args = nil
+			}
+
+			if s.resume(cmd == 'S', args) {
+				return
+			}
+		case 'v':
+			if s.handleV(args) {
+				return
+			}
+		case 'q', 'Q':
+			s.handleQuery(pkt)
+		case 'H', 'T':
+			// single thread
+			s.putString("OK")
+		case 'D', 'k':
+			s.putString("OK")
+			s.send()
+			s.removeBreakpoints()
+			return
+		}
+
+		s.send()
+	}
+}
+
+// stopReply sends a stop reply packet for the argument signal.
+func (s *Stub) stopReply(sig int) {
+	s.reply = s.out[:1]
+	s.putString("S")
+	s.putHex([]byte{byte(sig)})
+	s.send()
+}
+
+// resume prepares the trap frame for resuming execution, it returns false
+// when the request cannot be honored.
+func (s *Stub) resume(step bool, args []byte) bool {
+	if len(args) > 0 {
+		addr, _, ok := parseHex(args)
+
+		if !ok {
+			s.putString("E01")
+			return false
+		}
+
+		frame.setPC(uint(addr))
+	}
+
+	if step && !hardwareStep {
+		s.putString("E01")
+		return false
+	}
+
+	frame.step(step)
+
+	return true
+}
+
+func (s *Stub) handleBreakpoint(insert bool, args []byte) {
+	// only software breakpoints are supported
+	if len(args) < 2 || args[0] != '0' || args[1] != ',' {
+		return
+	}
+
+	addr, kind, _, ok := parseRange(args[2:])
+
+	if !ok {
+		s.putString("E01")
+		return
+	}
+
+	if insert && !s.accessible(addr, len(breakInstruction(kind))) {
+		s.putString("E14")
+		return
+	}
+
+	if insert {
+		ok = s.insertBreakpoint(addr, kind)
+	} else {
+		ok = s.removeBreakpoint(addr)
+	}
+
+	if ok {
+		s.putString("OK")
+	} else {
+		s.putString("E01")
+	}
+}
+
+// handleV handles `v` packets, it returns true when execution is resumed.
+func (s *Stub) handleV(args []byte) bool {
+	switch {
+	case bytes.Equal(args, []byte("Cont?")):
+		if hardwareStep {
+			s.putString("vCont;c;C;s;S")
+		} else {
+			s.putString("vCont;c;C")
+		}
+	case bytes.HasPrefix(args, []byte("Cont;")):
+		// single thread, only the first action is relevant
+		action := args[5:]
+
+		if i := bytes.IndexAny(action, ":;"); i >= 0 {
+			action = action[:i]
+		}
+
+		if len(action) == 0 {
+			break
+		}
+
+		return s.resume(action[0] == 's' || action[0] == 'S', nil)
+	}
+
+	return false
+}
+
+func (s *Stub) handleQuery(pkt []byte) {
+	switch {
+	case bytes.HasPrefix(pkt, []byte("qSupported")):
+		s.putString("PacketSize=")
+		s.putHex([]byte{packetSize >> 8, packetSize & 0xff})
+		s.putString(";QStartNoAckMode+")
+
+		if len(targetXML) > 0 {
+			s.putString(";qXfer:features:read+")
+		}
+	case bytes.Equal(pkt, []byte("qAttached")):
+		s.putString("1")
+	case bytes.Equal(pkt, []byte("qC")):
+		s.putString("QC1")
+	case bytes.Equal(pkt, []byte("qfThreadInfo")):
+		s.putString("m1")
+	case bytes.Equal(pkt, []byte("qsThreadInfo")):
+		s.putString("l")
+	case bytes.HasPrefix(pkt, []byte(xferTarget)):
+		off, size, _, ok := parseRange(pkt[len(xferTarget):])
+
+		switch {
+		case !ok || len(targetXML) == 0:
+			s.putString("E01")
+		case off >= uint(len(targetXML)):
+			s.putString("l")
+		case off+uint(size) >= uint(len(targetXML)):
+			s.putString("l")
+			s.putString(targetXML[off:])
+		default:
+			s.putString("m")
+			s.putString(targetXML[off : off+uint(size)])
+		}
+	}
+}
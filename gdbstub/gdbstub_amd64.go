@@ -0,0 +1,129 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package gdbstub
+
+import (
+	"unsafe"
+
+	"github.com/usbarmory/tamago/amd64"
+)
+
+// Frame represents the processor state saved on exceptions, in GDB register
+// order (org.gnu.gdb.i386.core).
+type Frame struct {
+	// R holds general purpose registers (RAX, RBX, RCX, RDX, RSI, RDI,
+	// RBP, RSP, R8-R15).
+	R     [16]uint64
+	IP    uint64
+	Flags uint64
+	CS    uint64
+	SS    uint64
+
+	// Vector is the exception vector number.
+	Vector uint64
+}
+
+// Exception vectors
+// (Intel® 64 and IA-32 Architectures Software Developer’s Manual
+// Volume 3A - 6.3.1 External Interrupts).
+const (
+	DEBUG      = 1
+	BREAKPOINT = 3
+)
+
+// RFLAGS Trap Flag
+const RFLAGS_TF = 1 << 8
+
+type processor = amd64.CPU
+
+// int3
+var breakInstr = []byte{0xcc}
+
+const (
+	// the instruction pointer already follows int3
+	breakSkip    = 0
+	numRegisters = 20
+	hardwareStep = true
+	targetXML    = ""
+)
+
+// defined in gdbstub_amd64.s
+func breakpoint()
+func debugHandler()
+func breakpointHandler()
+func handlers() (debug uintptr, breakpoint uintptr)
+
+var trapFn = trap
+
+// Init initializes the stub and installs its handlers for the processor debug
+// and breakpoint exceptions, it must be invoked after
+// [amd64.CPU.EnableExceptions].
+func (s *Stub) Init(cpu *amd64.CPU) {
+	s.init(cpu)
+
+	debug, breakpoint := handlers()
+
+	cpu.SetExceptionHandler(DEBUG, debug)
+	cpu.SetExceptionHandler(BREAKPOINT, breakpoint)
+}
+
+func trap() {
+	stub.trap(SIGTRAP)
+}
+
+func breakInstruction(_ int) []byte {
+	return breakInstr
+}
+
+func (f *Frame) pc() uint {
+	return uint(f.IP)
+}
+
+func (f *Frame) setPC(pc uint) {
+	f.IP = uint64(pc)
+}
+
+func (f *Frame) step(enable bool) {
+	if enable {
+		f.Flags |= RFLAGS_TF
+	} else {
+		f.Flags &^= RFLAGS_TF
+	}
+}
+
+func (f *Frame) register(n int) []byte {
+	var r *uint64
+	size := 8
+
+	switch {
+	case n < 0:
+		return nil
+	case n < 16:
+		r = &f.R[n]
+	case n == 16:
+		r = &f.IP
+	case n == 17:
+		r = &f.Flags
+		size = 4
+	case n == 18:
+		r = &f.CS
+		size = 4
+	case n == 19:
+		r = &f.SS
+		size = 4
+	default:
+		return nil
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(r)), size)
+}
+
+func flushCache(_ *processor, _ uint, _ int) {
+	// instruction fetches are coherent with stores
+}
@@ -0,0 +1,94 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "go_asm.h"
+#include "textflag.h"
+
+// func breakpoint()
+TEXT ·breakpoint(SB),NOSPLIT|NOFRAME,$0
+	BYTE	$0xcc	// int3
+	RET
+
+// func handlers() (debug uintptr, breakpoint uintptr)
+TEXT ·handlers(SB),NOSPLIT|NOFRAME,$0-16
+	// return ABI0 handler pointers
+	MOVQ	$·debugHandler(SB), AX
+	MOVQ	AX, debug+0(FP)
+	MOVQ	$·breakpointHandler(SB), AX
+	MOVQ	AX, breakpoint+8(FP)
+	RET
+
+TEXT ·debugHandler(SB),NOSPLIT|NOFRAME,$0
+	MOVQ	$const_DEBUG, ·frame+Frame_Vector(SB)
+	JMP	·handleTrap(SB)
+
+TEXT ·breakpointHandler(SB),NOSPLIT|NOFRAME,$0
+	MOVQ	$const_BREAKPOINT, ·frame+Frame_Vector(SB)
+	JMP	·handleTrap(SB)
+
+TEXT ·handleTrap(SB),NOSPLIT|NOFRAME,$0
+	// save trap frame
+	MOVQ	AX, ·frame+(Frame_R+0*8)(SB)
+	MOVQ	BX, ·frame+(Frame_R+1*8)(SB)
+	MOVQ	CX, ·frame+(Frame_R+2*8)(SB)
+	MOVQ	DX, ·frame+(Frame_R+3*8)(SB)
+	MOVQ	SI, ·frame+(Frame_R+4*8)(SB)
+	MOVQ	DI, ·frame+(Frame_R+5*8)(SB)
+	MOVQ	BP, ·frame+(Frame_R+6*8)(SB)
+	MOVQ	R8, ·frame+(Frame_R+8*8)(SB)
+	MOVQ	R9, ·frame+(Frame_R+9*8)(SB)
+	MOVQ	R10, ·frame+(Frame_R+10*8)(SB)
+	MOVQ	R11, ·frame+(Frame_R+11*8)(SB)
+	MOVQ	R12, ·frame+(Frame_R+12*8)(SB)
+	MOVQ	R13, ·frame+(Frame_R+13*8)(SB)
+	MOVQ	R14, ·frame+(Frame_R+14*8)(SB)
+	MOVQ	R15, ·frame+(Frame_R+15*8)(SB)
+
+	// AMD64 Architecture Programmer’s Manual
+	// Volume 2 - 8.9.3 Interrupt Stack Frame
+	MOVQ	(8*0)(SP), AX
+	MOVQ	AX, ·frame+Frame_IP(SB)
+	MOVQ	(8*1)(SP), AX
+	MOVQ	AX, ·frame+Frame_CS(SB)
+	MOVQ	(8*2)(SP), AX
+	MOVQ	AX, ·frame+Frame_Flags(SB)
+	MOVQ	(8*3)(SP), AX
+	MOVQ	AX, ·frame+(Frame_R+7*8)(SB)
+	MOVQ	(8*4)(SP), AX
+	MOVQ	AX, ·frame+Frame_SS(SB)
+
+	// call trap handler on system stack (g0)
+	MOVQ	$·trapFn(SB), AX
+	MOVQ	(AX), AX
+	PUSHQ	AX
+	CALL	runtime·systemstack(SB)
+	ADDQ	$8, SP
+
+	// restore trap frame, stack pointer changes are not supported
+	MOVQ	·frame+Frame_IP(SB), AX
+	MOVQ	AX, (8*0)(SP)
+	MOVQ	·frame+Frame_Flags(SB), AX
+	MOVQ	AX, (8*2)(SP)
+	MOVQ	·frame+(Frame_R+0*8)(SB), AX
+	MOVQ	·frame+(Frame_R+1*8)(SB), BX
+	MOVQ	·frame+(Frame_R+2*8)(SB), CX
+	MOVQ	·frame+(Frame_R+3*8)(SB), DX
+	MOVQ	·frame+(Frame_R+4*8)(SB), SI
+	MOVQ	·frame+(Frame_R+5*8)(SB), DI
+	MOVQ	·frame+(Frame_R+6*8)(SB), BP
+	MOVQ	·frame+(Frame_R+8*8)(SB), R8
+	MOVQ	·frame+(Frame_R+9*8)(SB), R9
+	MOVQ	·frame+(Frame_R+10*8)(SB), R10
+	MOVQ	·frame+(Frame_R+11*8)(SB), R11
+	MOVQ	·frame+(Frame_R+12*8)(SB), R12
+	MOVQ	·frame+(Frame_R+13*8)(SB), R13
+	MOVQ	·frame+(Frame_R+14*8)(SB), R14
+	MOVQ	·frame+(Frame_R+15*8)(SB), R15
+
+	// return to caller
+	IRETQ
@@ -0,0 +1,130 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package gdbstub
+
+import (
+	"unsafe"
+
+	"github.com/usbarmory/tamago/arm"
+)
+
+// Frame represents the processor state saved on exceptions, in GDB register
+// order (org.gnu.gdb.arm.core).
+type Frame struct {
+	R    [13]uint32
+	SP   uint32
+	LR   uint32
+	PC   uint32
+	CPSR uint32
+}
+
+type processor = arm.CPU
+
+// permanently undefined instruction (udf #16)
+var breakInstr = []byte{0xf0, 0x01, 0xf0, 0xe7}
+
+const (
+	breakSkip    = 4
+	numRegisters = 17
+	hardwareStep = false
+)
+
+const targetXML = `<?xml version="1.0"?>
+<!DOCTYPE target SYSTEM "gdb-target.dtd">
+<target>
+<architecture>arm</architecture>
+<feature name="org.gnu.gdb.arm.core">
+<reg name="r0" bitsize="32"/>
+<reg name="r1" bitsize="32"/>
+<reg name="r2" bitsize="32"/>
+<reg name="r3" bitsize="32"/>
+<reg name="r4" bitsize="32"/>
+<reg name="r5" bitsize="32"/>
+<reg name="r6" bitsize="32"/>
+<reg name="r7" bitsize="32"/>
+<reg name="r8" bitsize="32"/>
+<reg name="r9" bitsize="32"/>
+<reg name="r10" bitsize="32"/>
+<reg name="r11" bitsize="32"/>
+<reg name="r12" bitsize="32"/>
+<reg name="sp" bitsize="32" type="data_ptr"/>
+<reg name="lr" bitsize="32"/>
+<reg name="pc" bitsize="32" type="code_ptr"/>
+<reg name="cpsr" bitsize="32"/>
+</feature>
+</target>
+`
+
+// defined in gdbstub_arm.s
+func breakpoint()
+func undefinedHandler()
+
+// Init initializes the stub and installs its handler for the processor
+// undefined instruction exception, used for breakpoints. Any undefined
+// instruction is reported to the debugger.
+//
+// Single-stepping is performed by the debugger with temporary breakpoints.
+func (s *Stub) Init(cpu *arm.CPU) {
+	s.init(cpu)
+
+	t := arm.SystemVectorTable()
+	t.Undefined = undefinedHandler
+
+	cpu.SetVectorTable(t)
+}
+
+func trap(off int) {
+	if stub.isBreakpoint(frame.pc()) {
+		stub.trap(SIGTRAP)
+	} else {
+		stub.trap(SIGILL)
+	}
+}
+
+func breakInstruction(_ int) []byte {
+	return breakInstr
+}
+
+func (f *Frame) pc() uint {
+	return uint(f.PC)
+}
+
+func (f *Frame) setPC(pc uint) {
+	f.PC = uint32(pc)
+}
+
+func (f *Frame) step(_ bool) {}
+
+func (f *Frame) register(n int) []byte {
+	var r *uint32
+
+	switch {
+	case n < 0:
+		return nil
+	case n < 13:
+		r = &f.R[n]
+	case n == 13:
+		r = &f.SP
+	case n == 14:
+		r = &f.LR
+	case n == 15:
+		r = &f.PC
+	case n == 16:
+		r = &f.CPSR
+	default:
+		return nil
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(r)), 4)
+}
+
+func flushCache(cpu *processor, addr uint, size int) {
+	cpu.CleanDataCacheRange(addr, size)
+	cpu.FlushInstructionCache()
+}
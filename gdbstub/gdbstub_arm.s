@@ -0,0 +1,79 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "go_asm.h"
+#include "textflag.h"
+
+#define RESTORE(N) MOVW (Frame_R+N*4)(R0), R1; MOVW R1, (N*4)(R13)
+
+// func breakpoint()
+TEXT ·breakpoint(SB),NOSPLIT|NOFRAME,$0
+	WORD	$0xe7f001f0	// udf #16
+	RET
+
+TEXT ·undefinedHandler(SB),NOSPLIT|NOFRAME,$0
+	// restore stack pointer
+	WORD	$0xe105d200		// mrs sp, SP_usr
+
+	// remove exception specific LR offset
+	SUB	$4, R14, R14
+
+	// save caller registers
+	MOVM.DB.W	[R0-R12, R14], (R13)	// push {r0-r12, r14}
+
+	// save trap frame
+	MOVW	$·frame(SB), R0
+	ADD	$4, R0, R0
+	MOVM.IA	[R1-R12], (R0)
+	SUB	$4, R0, R0
+	MOVW	0(R13), R1
+	MOVW	R1, Frame_R(R0)
+
+	ADD	$56, R13, R1
+	MOVW	R1, Frame_SP(R0)
+	WORD	$0xe1061200		// mrs r1, LR_usr
+	MOVW	R1, Frame_LR(R0)
+	MOVW	R14, Frame_PC(R0)
+	WORD	$0xe14f1000		// mrs r1, SPSR
+	MOVW	R1, Frame_CPSR(R0)
+
+	// call trap handler on g0
+	MOVW	$0, R0
+	MOVW	$·trap(SB), R1
+	MOVW	$56, R2
+	MOVW	R14, R3
+	CALL	runtime·CallOnG0(SB)
+
+	// restore trap frame, stack pointer changes are not supported
+	MOVW	$·frame(SB), R0
+	RESTORE(0)
+	RESTORE(1)
+	RESTORE(2)
+	RESTORE(3)
+	RESTORE(4)
+	RESTORE(5)
+	RESTORE(6)
+	RESTORE(7)
+	RESTORE(8)
+	RESTORE(9)
+	RESTORE(10)
+	RESTORE(11)
+	RESTORE(12)
+
+	MOVW	Frame_PC(R0), R1
+	MOVW	R1, 52(R13)
+	MOVW	Frame_LR(R0), R1
+	WORD	$0xe126f201		// msr LR_usr, r1
+	MOVW	Frame_CPSR(R0), R1
+	WORD	$0xe16ff001		// msr SPSR_fsxc, r1
+
+	// restore caller registers
+	MOVM.IA.W	(R13), [R0-R12, R14]	// pop {r0-r12, r14}
+
+	// restore PC from LR and mode
+	MOVW.S	R14, R15
@@ -0,0 +1,150 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package gdbstub
+
+import (
+	"unsafe"
+
+	"github.com/usbarmory/tamago/arm64"
+)
+
+// Frame represents the processor state saved on exceptions, in GDB register
+// order (org.gnu.gdb.aarch64.core).
+type Frame struct {
+	R      [31]uint64
+	SP     uint64
+	PC     uint64
+	PSTATE uint64
+
+	// Exception Syndrome Register
+	ESR uint64
+}
+
+// Exception classes
+// (D17.2.37 ESR_EL1, Exception Syndrome Register (EL1), ARM DDI 0487).
+const (
+	EC_INSTR_ABORT   = 0x21
+	EC_PC_ALIGNMENT  = 0x22
+	EC_DATA_ABORT    = 0x25
+	EC_SP_ALIGNMENT  = 0x26
+	EC_SOFTWARE_STEP = 0x33
+	EC_BRK           = 0x3c
+)
+
+const (
+	PSTATE_SS = 1 << 21
+	PSTATE_D  = 1 << 9
+	PSTATE_I  = 1 << 7
+)
+
+type processor = arm64.CPU
+
+// brk #0
+var breakInstr = []byte{0x00, 0x00, 0x20, 0xd4}
+
+const (
+	breakSkip    = 4
+	numRegisters = 34
+	hardwareStep = true
+	targetXML    = ""
+)
+
+var (
+	stepping bool
+	// PSTATE masks saved while stepping
+	stepMask uint64
+)
+
+// defined in gdbstub_arm64.s
+func breakpoint()
+func exceptionHandler()
+func set_step(enable bool)
+func invalidate_icache()
+
+var trapFn = trap
+
+// Init initializes the stub and installs its handler for the processor
+// synchronous exceptions, used for breakpoints and single-stepping, taken from
+// the current exception level (EL1). Any synchronous exception is reported to
+// the debugger.
+func (s *Stub) Init(cpu *arm64.CPU) {
+	s.init(cpu)
+	cpu.SetExceptionHandler(exceptionHandler)
+}
+
+func trap() {
+	switch frame.ESR >> 26 {
+	case EC_BRK, EC_SOFTWARE_STEP:
+		stub.trap(SIGTRAP)
+	case EC_INSTR_ABORT, EC_DATA_ABORT:
+		stub.trap(SIGSEGV)
+	case EC_PC_ALIGNMENT, EC_SP_ALIGNMENT:
+		stub.trap(SIGBUS)
+	default:
+		stub.trap(SIGILL)
+	}
+}
+
+func breakInstruction(_ int) []byte {
+	return breakInstr
+}
+
+func (f *Frame) pc() uint {
+	return uint(f.PC)
+}
+
+func (f *Frame) setPC(pc uint) {
+	f.PC = uint64(pc)
+}
+
+func (f *Frame) step(enable bool) {
+	if stepping {
+		f.PSTATE &^= PSTATE_SS | PSTATE_D | PSTATE_I
+		f.PSTATE |= stepMask
+		stepping = false
+	}
+
+	if enable {
+		// mask interrupts and unmask debug exceptions while stepping
+		stepMask = f.PSTATE & (PSTATE_D | PSTATE_I)
+		f.PSTATE &^= PSTATE_D
+		f.PSTATE |= PSTATE_SS | PSTATE_I
+		stepping = true
+	}
+
+	set_step(enable)
+}
+
+func (f *Frame) register(n int) []byte {
+	var r *uint64
+	size := 8
+
+	switch {
+	case n < 0:
+		return nil
+	case n < 31:
+		r = &f.R[n]
+	case n == 31:
+		r = &f.SP
+	case n == 32:
+		r = &f.PC
+	case n == 33:
+		r = &f.PSTATE
+		size = 4
+	default:
+		return nil
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(r)), size)
+}
+
+func flushCache(cpu *processor, addr uint, size int) {
+	cpu.CleanDataCacheRange(addr, size)
+	invalidate_icache()
+}
@@ -0,0 +1,112 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "go_asm.h"
+#include "textflag.h"
+
+// func breakpoint()
+TEXT ·breakpoint(SB),NOSPLIT|NOFRAME,$0
+	WORD	$0xd4200000	// brk #0
+	RET
+
+// func set_step(enable bool)
+TEXT ·set_step(SB),NOSPLIT,$0-1
+	MOVB	enable+0(FP), R1
+
+	// clear OS Lock
+	MSR	ZR, OSLAR_EL1
+
+	// enable debug exceptions and set/clear software step
+	MRS	MDSCR_EL1, R0
+	ORR	$(1<<13), R0	// set MDSCR_EL1.KDE
+	BIC	$1, R0		// clear MDSCR_EL1.SS
+	ORR	R1, R0		// set MDSCR_EL1.SS if enabled
+	MSR	R0, MDSCR_EL1
+	ISB	$15
+
+	RET
+
+// func invalidate_icache()
+TEXT ·invalidate_icache(SB),NOSPLIT,$0
+	DSB	$11		// dsb ish
+	WORD	$0xd508751f	// ic iallu
+	DSB	$11		// dsb ish
+	ISB	$15
+	RET
+
+TEXT ·exceptionHandler(SB),NOSPLIT|NOFRAME,$0
+	// save caller registers
+	SUB	$16, RSP
+	STP	(R0, R1), (RSP)
+
+	// save trap frame
+	MOVD	$·frame(SB), R0
+	STP	(R2, R3), (Frame_R+2*8)(R0)
+	STP	(R4, R5), (Frame_R+4*8)(R0)
+	STP	(R6, R7), (Frame_R+6*8)(R0)
+	STP	(R8, R9), (Frame_R+8*8)(R0)
+	STP	(R10, R11), (Frame_R+10*8)(R0)
+	STP	(R12, R13), (Frame_R+12*8)(R0)
+	STP	(R14, R15), (Frame_R+14*8)(R0)
+	STP	(R16, R17), (Frame_R+16*8)(R0)
+	STP	(R18_PLATFORM, R19), (Frame_R+18*8)(R0)
+	STP	(R20, R21), (Frame_R+20*8)(R0)
+	STP	(R22, R23), (Frame_R+22*8)(R0)
+	STP	(R24, R25), (Frame_R+24*8)(R0)
+	STP	(R26, R27), (Frame_R+26*8)(R0)
+	STP	(g, R29), (Frame_R+28*8)(R0)
+	MOVD	R30, (Frame_R+30*8)(R0)
+
+	LDP	(RSP), (R1, R2)
+	STP	(R1, R2), (Frame_R)(R0)
+
+	ADD	$16, RSP, R1
+	MOVD	R1, Frame_SP(R0)
+	MRS	ELR_EL1, R1
+	MOVD	R1, Frame_PC(R0)
+	MRS	SPSR_EL1, R1
+	MOVD	R1, Frame_PSTATE(R0)
+	MRS	ESR_EL1, R1
+	MOVD	R1, Frame_ESR(R0)
+
+	// call trap handler on system stack (g0)
+	MOVD	$·trapFn(SB), R1
+	MOVD	(R1), R1
+	MOVD	R1, 8(RSP)
+	CALL	runtime·systemstack(SB)
+
+	// restore trap frame, stack pointer changes are not supported
+	MOVD	$·frame(SB), R0
+	MOVD	Frame_PC(R0), R1
+	MSR	R1, ELR_EL1
+	MOVD	Frame_PSTATE(R0), R1
+	MSR	R1, SPSR_EL1
+
+	LDP	(Frame_R+2*8)(R0), (R2, R3)
+	LDP	(Frame_R+4*8)(R0), (R4, R5)
+	LDP	(Frame_R+6*8)(R0), (R6, R7)
+	LDP	(Frame_R+8*8)(R0), (R8, R9)
+	LDP	(Frame_R+10*8)(R0), (R10, R11)
+	LDP	(Frame_R+12*8)(R0), (R12, R13)
+	LDP	(Frame_R+14*8)(R0), (R14, R15)
+	LDP	(Frame_R+16*8)(R0), (R16, R17)
+	LDP	(Frame_R+18*8)(R0), (R18_PLATFORM, R19)
+	LDP	(Frame_R+20*8)(R0), (R20, R21)
+	LDP	(Frame_R+22*8)(R0), (R22, R23)
+	LDP	(Frame_R+24*8)(R0), (R24, R25)
+	LDP	(Frame_R+26*8)(R0), (R26, R27)
+	LDP	(Frame_R+28*8)(R0), (g, R29)
+	MOVD	(Frame_R+30*8)(R0), R30
+	MOVD	(Frame_R+1*8)(R0), R1
+	MOVD	(Frame_R)(R0), R0
+
+	// restore stack pointer
+	ADD	$16, RSP
+
+	// exception return
+	ERET
@@ -0,0 +1,113 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package gdbstub
+
+import (
+	"unsafe"
+
+	"github.com/usbarmory/tamago/riscv64"
+)
+
+// Frame represents the processor state saved on exceptions, in GDB register
+// order (org.gnu.gdb.riscv.cpu).
+type Frame struct {
+	// X holds general purpose registers, X[0] is always zero.
+	X  [32]uint64
+	PC uint64
+
+	// Machine Cause Register
+	Cause uint64
+}
+
+type processor = riscv64.CPU
+
+var (
+	// ebreak
+	breakInstr = []byte{0x73, 0x00, 0x10, 0x00}
+	// c.ebreak
+	compressedBreakInstr = []byte{0x02, 0x90}
+)
+
+const (
+	breakSkip    = 4
+	numRegisters = 33
+	hardwareStep = false
+	targetXML    = ""
+)
+
+// defined in gdbstub_riscv64.s
+func breakpoint()
+func trapHandler()
+func fence_i()
+
+var trapFn = trap
+
+// Init initializes the stub and installs its handler for the processor
+// machine mode traps. Interrupts are forwarded to the riscv64 package trap
+// handler, while any exception is reported to the debugger.
+//
+// Single-stepping is performed by the debugger with temporary breakpoints.
+func (s *Stub) Init(cpu *riscv64.CPU) {
+	s.init(cpu)
+	cpu.SetExceptionHandler(trapHandler)
+}
+
+func trap() {
+	switch frame.Cause {
+	case riscv64.Breakpoint:
+		stub.trap(SIGTRAP)
+	case riscv64.IllegalInstruction:
+		stub.trap(SIGILL)
+	case riscv64.InstructionAddressMisaligned, riscv64.LoadAddressMisaligned, riscv64.StoreAddressMisaligned:
+		stub.trap(SIGBUS)
+	default:
+		stub.trap(SIGSEGV)
+	}
+}
+
+// breakInstruction returns the breakpoint instruction for the argument GDB
+// breakpoint kind (instruction size).
+func breakInstruction(kind int) []byte {
+	if kind == 2 {
+		return compressedBreakInstr
+	}
+
+	return breakInstr
+}
+
+func (f *Frame) pc() uint {
+	return uint(f.PC)
+}
+
+func (f *Frame) setPC(pc uint) {
+	f.PC = uint64(pc)
+}
+
+func (f *Frame) step(_ bool) {}
+
+func (f *Frame) register(n int) []byte {
+	var r *uint64
+
+	switch {
+	case n < 0:
+		return nil
+	case n < 32:
+		r = &f.X[n]
+	case n == 32:
+		r = &f.PC
+	default:
+		return nil
+	}
+
+	return unsafe.Slice((*byte)(unsafe.Pointer(r)), 8)
+}
+
+func flushCache(_ *processor, _ uint, _ int) {
+	fence_i()
+}
@@ -0,0 +1,117 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+#include "go_asm.h"
+#include "textflag.h"
+
+// func breakpoint()
+TEXT ·breakpoint(SB),NOSPLIT|NOFRAME,$0
+	WORD	$0x00100073	// ebreak
+	RET
+
+// func fence_i()
+TEXT ·fence_i(SB),NOSPLIT|NOFRAME,$0
+	WORD	$0x0000100f	// fence.i
+	RET
+
+TEXT ·trapHandler(SB),NOSPLIT|NOFRAME,$0
+	// obtain a scratch register
+	CSRRW	T6, MSCRATCH, T6
+
+	// forward interrupts to the default trap handler
+	CSRRS	ZERO, MCAUSE, T6
+	BGE	T6, ZERO, exception
+	CSRRW	T6, MSCRATCH, T6
+	JMP	github·com∕usbarmory∕tamago∕riscv64·trapHandler(SB)
+exception:
+	// save trap frame
+	MOV	$·frame(SB), T6
+	MOV	X1, (Frame_X+1*8)(T6)
+	MOV	X2, (Frame_X+2*8)(T6)
+	MOV	X3, (Frame_X+3*8)(T6)
+	MOV	TP, (Frame_X+4*8)(T6)
+	MOV	X5, (Frame_X+5*8)(T6)
+	MOV	X6, (Frame_X+6*8)(T6)
+	MOV	X7, (Frame_X+7*8)(T6)
+	MOV	X8, (Frame_X+8*8)(T6)
+	MOV	X9, (Frame_X+9*8)(T6)
+	MOV	X10, (Frame_X+10*8)(T6)
+	MOV	X11, (Frame_X+11*8)(T6)
+	MOV	X12, (Frame_X+12*8)(T6)
+	MOV	X13, (Frame_X+13*8)(T6)
+	MOV	X14, (Frame_X+14*8)(T6)
+	MOV	X15, (Frame_X+15*8)(T6)
+	MOV	X16, (Frame_X+16*8)(T6)
+	MOV	X17, (Frame_X+17*8)(T6)
+	MOV	X18, (Frame_X+18*8)(T6)
+	MOV	X19, (Frame_X+19*8)(T6)
+	MOV	X20, (Frame_X+20*8)(T6)
+	MOV	X21, (Frame_X+21*8)(T6)
+	MOV	X22, (Frame_X+22*8)(T6)
+	MOV	X23, (Frame_X+23*8)(T6)
+	MOV	X24, (Frame_X+24*8)(T6)
+	MOV	X25, (Frame_X+25*8)(T6)
+	MOV	X26, (Frame_X+26*8)(T6)
+	MOV	g, (Frame_X+27*8)(T6)
+	MOV	X28, (Frame_X+28*8)(T6)
+	MOV	X29, (Frame_X+29*8)(T6)
+	MOV	X30, (Frame_X+30*8)(T6)
+
+	CSRRS	ZERO, MSCRATCH, T0
+	MOV	T0, (Frame_X+31*8)(T6)
+	CSRRS	ZERO, MEPC, T0
+	MOV	T0, Frame_PC(T6)
+	CSRRS	ZERO, MCAUSE, T0
+	MOV	T0, Frame_Cause(T6)
+
+	// call trap handler on system stack (g0)
+	MOV	$·trapFn(SB), T0
+	MOV	(T0), T0
+	SUB	$16, SP
+	MOV	T0, 8(SP)
+	CALL	runtime·systemstack(SB)
+	ADD	$16, SP
+
+	// restore trap frame
+	MOV	$·frame(SB), T6
+	MOV	Frame_PC(T6), T0
+	CSRRW	T0, MEPC, ZERO
+	MOV	(Frame_X+1*8)(T6), X1
+	MOV	(Frame_X+2*8)(T6), X2
+	MOV	(Frame_X+3*8)(T6), X3
+	MOV	(Frame_X+4*8)(T6), TP
+	MOV	(Frame_X+5*8)(T6), X5
+	MOV	(Frame_X+6*8)(T6), X6
+	MOV	(Frame_X+7*8)(T6), X7
+	MOV	(Frame_X+8*8)(T6), X8
+	MOV	(Frame_X+9*8)(T6), X9
+	MOV	(Frame_X+10*8)(T6), X10
+	MOV	(Frame_X+11*8)(T6), X11
+	MOV	(Frame_X+12*8)(T6), X12
+	MOV	(Frame_X+13*8)(T6), X13
+	MOV	(Frame_X+14*8)(T6), X14
+	MOV	(Frame_X+15*8)(T6), X15
+	MOV	(Frame_X+16*8)(T6), X16
+	MOV	(Frame_X+17*8)(T6), X17
+	MOV	(Frame_X+18*8)(T6), X18
+	MOV	(Frame_X+19*8)(T6), X19
+	MOV	(Frame_X+20*8)(T6), X20
+	MOV	(Frame_X+21*8)(T6), X21
+	MOV	(Frame_X+22*8)(T6), X22
+	MOV	(Frame_X+23*8)(T6), X23
+	MOV	(Frame_X+24*8)(T6), X24
+	MOV	(Frame_X+25*8)(T6), X25
+	MOV	(Frame_X+26*8)(T6), X26
+	MOV	(Frame_X+27*8)(T6), g
+	MOV	(Frame_X+28*8)(T6), X28
+	MOV	(Frame_X+29*8)(T6), X29
+	MOV	(Frame_X+30*8)(T6), X30
+	MOV	(Frame_X+31*8)(T6), T6
+
+	// exception return
+	WORD	$0x30200073	// mret
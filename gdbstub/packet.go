@@ -0,0 +1,187 @@
+// GDB remote serial protocol stub
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build amd64 || arm || arm64 || riscv64
+
+package gdbstub
+
+const hexDigits = "0123456789abcdef"
+
+func (s *Stub) getc() byte {
+	for {
+		if c, ok := s.rx(); ok {
+			return c
+		}
+	}
+}
+
+func (s *Stub) putc(c byte) {
+	s.rb[0] = c
+	s.Conn.Write(s.rb[:])
+}
+
+// receive returns the payload of the next valid packet, acknowledging its
+// reception when required.
+func (s *Stub) receive() []byte {
+	for {
+		// wait for packet start, discarding anything else (e.g.
+		// acknowledgments and interrupt requests).
+		for s.getc() != '$' {
+		}
+
+		var sum byte
+		var n int
+
+		for c := s.getc(); c != '#'; c = s.getc() {
+			if c == '$' {
+				// restart on unterminated packet
+				sum, n = 0, 0
+				continue
+			}
+
+			if n < len(s.in) {
+				s.in[n] = c
+				n++
+			}
+
+			sum += c
+		}
+
+		hi, lo := unhex(s.getc()), unhex(s.getc())
+
+		if s.noAck {
+			return s.in[:n]
+		}
+
+		if hi < 0 || lo < 0 || byte(hi<<4|lo) != sum || n == len(s.in) {
+			s.putc('-')
+			continue
+		}
+
+		s.putc('+')
+
+		return s.in[:n]
+	}
+}
+
+// send transmits the pending reply packet, waiting for its acknowledgment
+// when required.
+func (s *Stub) send() {
+	var sum byte
+
+	for _, c := range s.reply[1:] {
+		sum += c
+	}
+
+	pkt := append(s.reply, '#', hexDigits[sum>>4], hexDigits[sum&0xf])
+	pkt[0] = '$'
+
+	for {
+		s.Conn.Write(pkt)
+
+		if s.noAck {
+			return
+		}
+
+		for c := s.getc(); c != '-'; c = s.getc() {
+			if c == '+' {
+				return
+			}
+		}
+	}
+}
+
+func (s *Stub) putString(str string) {
+	for i := 0; i < len(str) && len(s.reply) < len(s.out)-3; i++ {
+		switch c := str[i]; c {
+		case '#', '$', '}', '*':
+			s.reply = append(s.reply, '}', c^0x20)
+		default:
+			s.reply = append(s.reply, c)
+		}
+	}
+}
+
+func (s *Stub) putHex(buf []byte) {
+	for _, c := range buf {
+		if len(s.reply) >= len(s.out)-4 {
+			return
+		}
+
+		s.reply = append(s.reply, hexDigits[c>>4], hexDigits[c&0xf])
+	}
+}
+
+func unhex(c byte) int {
+	switch {
+	case c >= '0' && c <= '9':
+		return int(c - '0')
+	case c >= 'a' && c <= 'f':
+		return int(c - 'a' + 10)
+	case c >= 'A' && c <= 'F':
+		return int(c - 'A' + 10)
+	}
+
+	return -1
+}
+
+// parseHex parses a hexadecimal number, returning its value and the remaining
+// input.
+func parseHex(buf []byte) (val uint64, rest []byte, ok bool) {
+	var i int
+
+	for i = 0; i < len(buf) && i < 16; i++ {
+		d := unhex(buf[i])
+
+		if d < 0 {
+			break
+		}
+
+		val = val<<4 | uint64(d)
+	}
+
+	return val, buf[i:], i > 0
+}
+
+// parseRange parses `addr,length` arguments, returning their values and the
+// remaining input.
+func parseRange(buf []byte) (addr uint, size int, rest []byte, ok bool) {
+	a, buf, ok := parseHex(buf)
+
+	if !ok || len(buf) == 0 || buf[0] != ',' {
+		return 0, 0, nil, false
+	}
+
+	n, buf, ok := parseHex(buf[1:])
+
+	if !ok || n > packetSize {
+		return 0, 0, nil, false
+	}
+
+	return uint(a), int(n), buf, true
+}
+
+// decodeHex decodes hexadecimal input in dst, returning the remaining input.
+func decodeHex(dst []byte, buf []byte) []byte {
+	for i := range dst {
+		if len(buf) < 2 {
+			break
+		}
+
+		hi, lo := unhex(buf[0]), unhex(buf[1])
+
+		if hi < 0 || lo < 0 {
+			break
+		}
+
+		dst[i] = byte(hi<<4 | lo)
+		buf = buf[2:]
+	}
+
+	return buf
+}
@@ -0,0 +1,41 @@
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package exception
+
+import (
+	"unsafe"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// PrintRegisters prints register names and values, in hexadecimal format with
+// the argument number of digits, four per line without allocating memory.
+func PrintRegisters(names []string, vals []uint64, digits int) {
+	var buf [16]byte
+
+	if digits > len(buf) {
+		digits = len(buf)
+	}
+
+	for i, val := range vals {
+		for j := digits - 1; j >= 0; j-- {
+			buf[j] = hexDigits[val&0xf]
+			val >>= 4
+		}
+
+		if i < len(names) {
+			print(" ", names[i])
+		}
+
+		print("\t0x", unsafe.String(&buf[0], digits))
+
+		if i%4 == 3 || i == len(vals)-1 {
+			print("\n")
+		}
+	}
+}
@@ -0,0 +1,50 @@
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build !regsim
+
+package reg
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// defined in reg_*.s
+func Move(dst uint32, src uint32)
+func Write(addr uint32, val uint32)
+func Write64(addr uint64, val uint64)
+
+func read16(addr uint32) uint16 {
+	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
+	return *reg
+}
+
+func write16(addr uint32, val uint16) {
+	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
+	*reg = val
+}
+
+func read32(addr uint32) uint32 {
+	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
+	return atomic.LoadUint32(reg)
+}
+
+func write32(addr uint32, val uint32) {
+	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
+	atomic.StoreUint32(reg, val)
+}
+
+func read64(addr uint64) uint64 {
+	reg := (*uint64)(unsafe.Pointer(uintptr(addr)))
+	return atomic.LoadUint64(reg)
+}
+
+func write64(addr uint64, val uint64) {
+	reg := (*uint64)(unsafe.Pointer(uintptr(addr)))
+	atomic.StoreUint64(reg, val)
+}
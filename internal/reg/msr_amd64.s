@@ -5,6 +5,8 @@
 // Use of this source code is governed by the license
 // that can be found in the LICENSE file.
 
+//go:build !regsim
+
 // func ReadMSR(addr uint64) (val uint64)
 TEXT ·ReadMSR(SB),$0-16
 	MOVQ	addr+0(FP), CX
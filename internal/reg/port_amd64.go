@@ -5,6 +5,8 @@
 // Use of this source code is governed by the license
 // that can be found in the LICENSE file.
 
+//go:build !regsim
+
 package reg
 
 // defined in port_amd64.s
@@ -5,6 +5,8 @@
 // Use of this source code is governed by the license
 // that can be found in the LICENSE file.
 
+//go:build !regsim
+
 // func In8(port uint16) (val uint8)
 TEXT ·In8(SB),$0-9
 	MOVW	port+0(FP), DX
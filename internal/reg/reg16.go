@@ -10,20 +10,17 @@ package reg
 import (
 	"runtime"
 	"time"
-	"unsafe"
 )
 
 // As sync/atomic does not provide 16-bit support, note that these functions do
 // not necessarily enforce memory ordering.
 
 func Get16(addr uint32, pos int) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg |= (1 << pos)
+	write16(addr, read16(addr)|(1<<pos))
 }
 
 func Set16(addr uint32, pos int) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg |= (1 << pos)
+	write16(addr, read16(addr)|(1<<pos))
 }
 
 func SetTo16(addr uint32, pos int, val bool) {
@@ -35,43 +32,35 @@ func SetTo16(addr uint32, pos int, val bool) {
 }
 
 func Clear16(addr uint32, pos int) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg &= ^(1 << pos)
+	write16(addr, read16(addr)&^(1<<pos))
 }
 
 func GetN16(addr uint32, pos int, mask int) uint16 {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	return (*reg >> pos) & uint16(mask)
+	return (read16(addr) >> pos) & uint16(mask)
 }
 
 func SetN16(addr uint32, pos int, mask int, val uint16) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg = (*reg & (^(uint16(mask) << pos))) | (val << pos)
+	write16(addr, (read16(addr)&(^(uint16(mask) << pos)))|(val<<pos))
 }
 
 func ClearN16(addr uint32, pos int, mask int) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg &= ^(uint16(mask) << pos)
+	write16(addr, read16(addr)&^(uint16(mask)<<pos))
 }
 
 func Read16(addr uint32) uint16 {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	return *reg
+	return read16(addr)
 }
 
 func Write16(addr uint32, val uint16) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg = val
+	write16(addr, val)
 }
 
 func WriteBack16(addr uint32) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg |= *reg
+	write16(addr, read16(addr))
 }
 
 func Or16(addr uint32, val uint16) {
-	reg := (*uint16)(unsafe.Pointer(uintptr(addr)))
-	*reg |= val
+	write16(addr, read16(addr)|val)
 }
 
 // Wait16 waits for a specific register bit to match a value. This function
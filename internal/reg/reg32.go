@@ -10,29 +10,28 @@
 //
 // This package is only meant to be used with `GOOS=tamago` as supported by the
 // TamaGo framework for bare metal Go, see https://github.com/usbarmory/tamago.
+//
+// When compiled with the `regsim` build tag all register accesses are
+// redirected to simulated register files (see [Simulator]), allowing host-side
+// testing of drivers with scripted hardware behaviour.
 package reg
 
 import (
 	"runtime"
-	"sync/atomic"
 	"time"
-	"unsafe"
 )
 
 func Get(addr uint32, pos int) bool {
-	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
-	r := atomic.LoadUint32(reg)
+	r := read32(addr)
 
 	return (int(r)>>pos)&1 == 1
 }
 
 func Set(addr uint32, pos int) {
-	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
-
-	r := atomic.LoadUint32(reg)
+	r := read32(addr)
 	r |= (1 << pos)
 
-	atomic.StoreUint32(reg, r)
+	write32(addr, r)
 }
 
 func SetTo(addr uint32, pos int, val bool) {
@@ -44,70 +43,52 @@ func SetTo(addr uint32, pos int, val bool) {
 }
 
 func Clear(addr uint32, pos int) {
-	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
-
-	r := atomic.LoadUint32(reg)
+	r := read32(addr)
 	r &= ^(1 << pos)
 
-	atomic.StoreUint32(reg, r)
+	write32(addr, r)
 }
 
 func GetN(addr uint32, pos int, mask int) uint32 {
-	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
-	r := atomic.LoadUint32(reg)
+	r := read32(addr)
 
 	return uint32((int(r) >> pos) & mask)
 }
 
 func SetN(addr uint32, pos int, mask int, val uint32) {
-	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
-
-	r := atomic.LoadUint32(reg)
+	r := read32(addr)
 	r = (r & (^(uint32(mask) << pos))) | (val << pos)
 
-	atomic.StoreUint32(reg, r)
+	write32(addr, r)
 }
 
 func ClearN(addr uint32, pos int, mask int) {
-	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
-
-	r := atomic.LoadUint32(reg)
+	r := read32(addr)
 	r &= ^(uint32(mask) << pos)
 
-	atomic.StoreUint32(reg, r)
+	write32(addr, r)
 }
 
-// defined in reg_*.s
-func Move(dst uint32, src uint32)
-
 func Read(addr uint32) uint32 {
-	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
-	return atomic.LoadUint32(reg)
+	return read32(addr)
 }
 
-// defined in reg_*.s
-func Write(addr uint32, val uint32)
-
 func Write32(addr uint32, val uint32) {
 	Write(addr, val)
 }
 
 func WriteBack(addr uint32) {
-	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
-
-	r := atomic.LoadUint32(reg)
+	r := read32(addr)
 	r |= r
 
-	atomic.StoreUint32(reg, r)
+	write32(addr, r)
 }
 
 func Or(addr uint32, val uint32) {
-	reg := (*uint32)(unsafe.Pointer(uintptr(addr)))
-
-	r := atomic.LoadUint32(reg)
+	r := read32(addr)
 	r |= val
 
-	atomic.StoreUint32(reg, r)
+	write32(addr, r)
 }
 
 // Wait waits for a specific register bit to match a value. This function
@@ -7,25 +7,17 @@
 
 package reg
 
-import (
-	"sync/atomic"
-	"unsafe"
-)
-
 func Get64(addr uint64, pos int) bool {
-	reg := (*uint64)(unsafe.Pointer(uintptr(addr)))
-	r := atomic.LoadUint64(reg)
+	r := read64(addr)
 
 	return (int(r)>>pos)&1 == 1
 }
 
 func Set64(addr uint64, pos int) {
-	reg := (*uint64)(unsafe.Pointer(uintptr(addr)))
-
-	r := atomic.LoadUint64(reg)
+	r := read64(addr)
 	r |= (1 << pos)
 
-	atomic.StoreUint64(reg, r)
+	write64(addr, r)
 }
 
 func SetTo64(addr uint64, pos int, val bool) {
@@ -37,25 +29,18 @@ func SetTo64(addr uint64, pos int, val bool) {
 }
 
 func Clear64(addr uint64, pos int) {
-	reg := (*uint64)(unsafe.Pointer(uintptr(addr)))
-
-	r := atomic.LoadUint64(reg)
+	r := read64(addr)
 	r &= ^(1 << pos)
 
-	atomic.StoreUint64(reg, r)
+	write64(addr, r)
 }
 
 func GetN64(addr uint64, pos int, mask int) uint64 {
-	reg := (*uint64)(unsafe.Pointer(uintptr(addr)))
-	r := atomic.LoadUint64(reg)
+	r := read64(addr)
 
 	return uint64((int(r) >> pos) & mask)
 }
 
 func Read64(addr uint64) uint64 {
-	reg := (*uint64)(unsafe.Pointer(uintptr(addr)))
-	return atomic.LoadUint64(reg)
+	return read64(addr)
 }
-
-// defined in reg_*.s
-func Write64(addr uint64, val uint64)
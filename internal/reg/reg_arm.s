@@ -5,6 +5,8 @@
 // Use of this source code is governed by the license
 // that can be found in the LICENSE file.
 
+//go:build !regsim
+
 // func Move(dst uint32, src uint32)
 TEXT ·Move(SB),$0-8
 	MOVW	dst+0(FP), R0
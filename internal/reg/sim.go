@@ -0,0 +1,198 @@
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build regsim
+
+package reg
+
+import (
+	"sync"
+)
+
+// Access represents a logged register write.
+type Access struct {
+	// Addr is the register address
+	Addr uint64
+	// Size is the access width in bits
+	Size int
+	// Val is the written value
+	Val uint64
+}
+
+// Simulator represents a simulated register file, it replaces hardware
+// register access when the package is compiled with the `regsim` build tag.
+//
+// Registers are modeled by address, regardless of access width, and default
+// to zero. Read callbacks allow scripting of hardware behaviour (e.g. status
+// bits changing after a number of polls) while the write log allows
+// verification of the register sequences issued by a driver.
+type Simulator struct {
+	sync.Mutex
+
+	regs  map[uint64]uint64
+	read  map[uint64]func(val uint64) uint64
+	write map[uint64]func(old uint64, val uint64) uint64
+	log   []Access
+}
+
+// Simulated register files for memory mapped, port mapped (amd64) and Model
+// Specific Registers (amd64).
+var (
+	MMIO = &Simulator{}
+	IO   = &Simulator{}
+	MSR  = &Simulator{}
+)
+
+// Reset clears all register values, callbacks and the write log.
+func (s *Simulator) Reset() {
+	s.Lock()
+	defer s.Unlock()
+
+	s.regs = nil
+	s.read = nil
+	s.write = nil
+	s.log = nil
+}
+
+// Poke sets a register value, without invoking any callback or logging the
+// write.
+func (s *Simulator) Poke(addr uint64, val uint64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.regs == nil {
+		s.regs = make(map[uint64]uint64)
+	}
+
+	s.regs[addr] = val
+}
+
+// Peek returns a register value, without invoking any callback.
+func (s *Simulator) Peek(addr uint64) uint64 {
+	s.Lock()
+	defer s.Unlock()
+
+	return s.regs[addr]
+}
+
+// OnRead sets a callback invoked on each read access of a register, the
+// callback receives the current register value and returns the value to be
+// read, which also becomes the current register value. A nil function
+// removes the callback.
+func (s *Simulator) OnRead(addr uint64, fn func(val uint64) uint64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.read == nil {
+		s.read = make(map[uint64]func(uint64) uint64)
+	}
+
+	if fn == nil {
+		delete(s.read, addr)
+		return
+	}
+
+	s.read[addr] = fn
+}
+
+// OnWrite sets a callback invoked on each write access of a register, the
+// callback receives the current and written register values and returns the
+// resulting register value (e.g. to model write-1-to-clear bits). A nil
+// function removes the callback.
+func (s *Simulator) OnWrite(addr uint64, fn func(old uint64, val uint64) uint64) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.write == nil {
+		s.write = make(map[uint64]func(uint64, uint64) uint64)
+	}
+
+	if fn == nil {
+		delete(s.write, addr)
+		return
+	}
+
+	s.write[addr] = fn
+}
+
+// Writes returns the log of all write accesses since the last reset.
+func (s *Simulator) Writes() []Access {
+	s.Lock()
+	defer s.Unlock()
+
+	return append([]Access(nil), s.log...)
+}
+
+// Load simulates a read access, callbacks are invoked without holding the
+// simulator lock to allow them to poke other registers.
+func (s *Simulator) Load(addr uint64) uint64 {
+	s.Lock()
+	val := s.regs[addr]
+	fn := s.read[addr]
+	s.Unlock()
+
+	if fn == nil {
+		return val
+	}
+
+	val = fn(val)
+	s.Poke(addr, val)
+
+	return val
+}
+
+// Store simulates a write access of the argument width in bits.
+func (s *Simulator) Store(addr uint64, size int, val uint64) {
+	s.Lock()
+	old := s.regs[addr]
+	fn := s.write[addr]
+	s.log = append(s.log, Access{Addr: addr, Size: size, Val: val})
+	s.Unlock()
+
+	if fn != nil {
+		val = fn(old, val)
+	}
+
+	s.Poke(addr, val)
+}
+
+func Move(dst uint32, src uint32) {
+	Write(dst, Read(src))
+	Write(src, 0)
+}
+
+func Write(addr uint32, val uint32) {
+	MMIO.Store(uint64(addr), 32, uint64(val))
+}
+
+func Write64(addr uint64, val uint64) {
+	MMIO.Store(addr, 64, val)
+}
+
+func read16(addr uint32) uint16 {
+	return uint16(MMIO.Load(uint64(addr)))
+}
+
+func write16(addr uint32, val uint16) {
+	MMIO.Store(uint64(addr), 16, uint64(val))
+}
+
+func read32(addr uint32) uint32 {
+	return uint32(MMIO.Load(uint64(addr)))
+}
+
+func write32(addr uint32, val uint32) {
+	MMIO.Store(uint64(addr), 32, uint64(val))
+}
+
+func read64(addr uint64) uint64 {
+	return MMIO.Load(addr)
+}
+
+func write64(addr uint64, val uint64) {
+	MMIO.Store(addr, 64, val)
+}
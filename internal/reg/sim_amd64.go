@@ -0,0 +1,42 @@
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build regsim
+
+package reg
+
+func ReadMSR(addr uint64) (val uint64) {
+	return MSR.Load(addr)
+}
+
+func WriteMSR(addr uint64, val uint64) {
+	MSR.Store(addr, 64, val)
+}
+
+func In8(port uint16) (val uint8) {
+	return uint8(IO.Load(uint64(port)))
+}
+
+func Out8(port uint16, val uint8) {
+	IO.Store(uint64(port), 8, uint64(val))
+}
+
+func In16(port uint16) (val uint16) {
+	return uint16(IO.Load(uint64(port)))
+}
+
+func Out16(port uint16, val uint16) {
+	IO.Store(uint64(port), 16, uint64(val))
+}
+
+func In32(port uint16) (val uint32) {
+	return uint32(IO.Load(uint64(port)))
+}
+
+func Out32(port uint16, val uint32) {
+	IO.Store(uint64(port), 32, uint64(val))
+}
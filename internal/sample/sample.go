@@ -0,0 +1,130 @@
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package sample implements a buffer of interrupted call stacks, recorded by
+// processor packages interrupt handlers, for CPU profiling.
+package sample
+
+import (
+	"runtime/goos"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	// MaxDepth is the maximum number of program counters in a sample.
+	MaxDepth = 32
+
+	// sample buffer entries
+	bufferSize = 64
+	// maximum stack frame size
+	maxFrameSize = 1 << 20
+
+	ptrSize = unsafe.Sizeof(uintptr(0))
+)
+
+// Sample represents an interrupted call stack, the first program counter is
+// the interrupted instruction while any following one is a return address.
+type Sample struct {
+	N  int
+	PC [MaxDepth]uintptr
+}
+
+var (
+	armed uint32
+	lost  uint32
+
+	// producer and consumer indices
+	head uint32
+	tail uint32
+
+	buffer [bufferSize]Sample
+)
+
+// Arm enables recording of the next interrupted call stack.
+func Arm() {
+	atomic.StoreUint32(&armed, 1)
+}
+
+// Disarm disables recording of the next interrupted call stack.
+func Disarm() {
+	atomic.StoreUint32(&armed, 0)
+}
+
+// Lost returns the number of samples dropped due to a full buffer.
+func Lost() int {
+	return int(atomic.LoadUint32(&lost))
+}
+
+//go:nosplit
+func validFrame(fp uintptr) bool {
+	start := uintptr(goos.RamStart)
+	end := start + uintptr(goos.RamSize)
+
+	return fp != 0 && fp%ptrSize == 0 && fp >= start && fp+2*ptrSize <= end
+}
+
+//go:nosplit
+func load(addr uintptr) uintptr {
+	var ptr unsafe.Pointer
+
+	ptr = unsafe.Add(ptr, addr)
+	return *(*uintptr)(ptr)
+}
+
+// Record records, when armed, the interrupted program counter and, if the
+// frame pointer is not zero, the return addresses found by walking the frame
+// pointer chain.
+//
+// Record is meant to be invoked by processor packages interrupt handlers.
+//
+//go:nosplit
+func Record(pc uintptr, fp uintptr) {
+	if atomic.SwapUint32(&armed, 0) == 0 {
+		return
+	}
+
+	h := atomic.LoadUint32(&head)
+
+	if h-atomic.LoadUint32(&tail) >= bufferSize {
+		atomic.AddUint32(&lost, 1)
+		return
+	}
+
+	s := &buffer[h%bufferSize]
+	s.PC[0] = pc
+	s.N = 1
+
+	for s.N < MaxDepth && validFrame(fp) {
+		s.PC[s.N] = load(fp + ptrSize)
+		s.N++
+
+		next := load(fp)
+
+		if next <= fp || next-fp > maxFrameSize {
+			break
+		}
+
+		fp = next
+	}
+
+	atomic.StoreUint32(&head, h+1)
+}
+
+// Read copies the oldest recorded sample, if any, to the argument structure.
+func Read(s *Sample) bool {
+	t := atomic.LoadUint32(&tail)
+
+	if t == atomic.LoadUint32(&head) {
+		return false
+	}
+
+	*s = buffer[t%bufferSize]
+	atomic.StoreUint32(&tail, t+1)
+
+	return true
+}
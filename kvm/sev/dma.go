@@ -0,0 +1,106 @@
+// AMD Secure Encrypted Virtualization support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package sev
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SharedMemory implements [dma.PageState] for SEV-SNP guests, to convert DMA
+// region pages between private and shared state as blocks are reserved or
+// released (see [dma.Region.SetPageState]).
+//
+// Pages are converted to shared state through a page state change request,
+// which invalidates them, followed by C-bit clearing. Pages are returned to
+// private state through C-bit setting followed by a page state change request,
+// which re-validates them.
+//
+// The page size must match the translation level of the page tables mapping
+// the DMA region (see [amd64.CPU.SetEncryptedBit]).
+type SharedMemory struct {
+	// GHCB is the Guest-Hypervisor Communication Block instance used for
+	// page state change requests, its CPU field is used for C-bit
+	// configuration.
+	GHCB *GHCB
+
+	// EncryptedBit represents the C-bit position (see [Features]).
+	EncryptedBit int
+
+	// Size represents the conversion page size ([PAGE_SIZE_4K] or
+	// [PAGE_SIZE_2M]).
+	Size int
+}
+
+// PageSize returns the page state conversion granularity.
+func (m *SharedMemory) PageSize() int {
+	switch m.Size {
+	case PAGE_SIZE_2M:
+		return 2 << 20
+	default:
+		return 1 << 12
+	}
+}
+
+// SetShared converts a page aligned memory range to shared (unencrypted) or
+// private (encrypted and validated) state.
+func (m *SharedMemory) SetShared(addr uint, size int, shared bool) (err error) {
+	if m.GHCB == nil || m.GHCB.CPU == nil {
+		return errors.New("invalid instance, nil GHCB or CPU field")
+	}
+
+	pageSize := uint64(m.PageSize())
+	start := uint64(addr)
+	end := start + uint64(size)
+
+	if start&(pageSize-1) != 0 || end&(pageSize-1) != 0 {
+		return fmt.Errorf("range %#x-%#x is not page aligned", start, end)
+	}
+
+	// split the range according to page state change entries limit
+	for ; start < end; start += MaxPSCEntries * pageSize {
+		last := min(start+MaxPSCEntries*pageSize, end)
+
+		if shared {
+			err = m.share(start, last)
+		} else {
+			err = m.unshare(start, last)
+		}
+
+		if err != nil {
+			return fmt.Errorf("page state change error, %v", err)
+		}
+	}
+
+	return
+}
+
+func (m *SharedMemory) share(start uint64, end uint64) (err error) {
+	if err = m.GHCB.PageStateChange(start, end, m.Size, false); err != nil {
+		return
+	}
+
+	if err = m.GHCB.CPU.SetEncryptedBit(start, end, m.EncryptedBit, false); err != nil {
+		return
+	}
+
+	m.GHCB.CPU.FlushTLBs()
+
+	return
+}
+
+func (m *SharedMemory) unshare(start uint64, end uint64) (err error) {
+	if err = m.GHCB.CPU.SetEncryptedBit(start, end, m.EncryptedBit, true); err != nil {
+		return
+	}
+
+	m.GHCB.CPU.FlushTLBs()
+
+	return m.GHCB.PageStateChange(start, end, m.Size, true)
+}
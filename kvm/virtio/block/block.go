@@ -0,0 +1,469 @@
+// VirtIO Block Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package block implements a driver for VirtIO block devices following
+// reference specifications:
+//   - Virtual I/O Device (VIRTIO) - Version 1.2 - 5.2 Block Device
+//
+// The driver supports any [virtio.VirtIO] transport (MMIO, PCI, LegacyPCI).
+//
+// This package is only meant to be used with `GOOS=tamago` as
+// supported by the TamaGo framework for bare metal Go, see
+// https://github.com/usbarmory/tamago.
+package block
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/usbarmory/tamago/bits"
+	"github.com/usbarmory/tamago/kvm/virtio"
+)
+
+// Feature bits
+const (
+	SizeMax     = 1
+	SegMax      = 2
+	Geometry    = 4
+	ReadOnly    = 5
+	BlockSize   = 6
+	Flush       = 9
+	Topology    = 10
+	ConfigWCE   = 11
+	MultiQueue  = 12
+	Discard     = 13
+	WriteZeroes = 14
+)
+
+// Request types
+const (
+	TypeIn          = 0
+	TypeOut         = 1
+	TypeFlush       = 4
+	TypeGetID       = 8
+	TypeDiscard     = 11
+	TypeWriteZeroes = 13
+)
+
+// Request status
+const (
+	StatusOK     = 0
+	StatusIOErr  = 1
+	StatusUnsupp = 2
+)
+
+const (
+	// SectorSize represents the fixed sector size used for request
+	// addressing, regardless of the device block size.
+	SectorSize = 512
+
+	// IDLength represents the device identifier string maximum length.
+	IDLength = 20
+
+	defaultQueueSize = 64
+	segmentSize      = 4096
+	headerSize       = 16
+	discardSize      = 16
+	requestQueue     = 0
+)
+
+// DriverFeatures represents the device type features supported by the driver.
+const DriverFeatures = 1<<SizeMax | 1<<SegMax | 1<<Geometry | 1<<ReadOnly |
+	1<<BlockSize | 1<<Flush | 1<<Topology | 1<<Discard
+
+// RequestTimeout is the timeout for requests sent to the device.
+var RequestTimeout = 10 * time.Second
+
+// Config represents a VirtIO block device configuration layout.
+type Config struct {
+	Capacity uint64
+	SizeMax  uint32
+	SegMax   uint32
+
+	// Geometry
+	Cylinders uint16
+	Heads     uint8
+	Sectors   uint8
+
+	BlockSize uint32
+
+	// Topology
+	PhysicalBlockExp uint8
+	AlignmentOffset  uint8
+	MinIOSize        uint16
+	OptIOSize        uint32
+
+	Writeback uint8
+	_         uint8
+	NumQueues uint16
+
+	MaxDiscardSectors      uint32
+	MaxDiscardSeg          uint32
+	DiscardSectorAlignment uint32
+
+	MaxWriteZeroesSectors uint32
+	MaxWriteZeroesSeg     uint32
+	WriteZeroesMayUnmap   uint8
+	_                     [3]uint8
+}
+
+type header struct {
+	Type   uint32
+	_      uint32
+	Sector uint64
+}
+
+type discardSegment struct {
+	Sector     uint64
+	NumSectors uint32
+	Flags      uint32
+}
+
+// Block represents a VirtIO block device instance.
+type Block struct {
+	sync.Mutex
+
+	// Transport represents the VirtIO transport instance.
+	Transport virtio.VirtIO
+
+	// QueueSize represents the request queue size, it is set to the
+	// device maximum (up to 64) when zero.
+	QueueSize int
+
+	config   Config
+	features uint64
+	queue    *virtio.VirtualQueue
+
+	// maximum transfer size per request
+	maxTransfer int
+	// timed out requests still owned by the device
+	pending int
+}
+
+// Init initializes a VirtIO block device instance.
+func (hw *Block) Init() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.Transport == nil {
+		return errors.New("invalid VirtIO instance")
+	}
+
+	if err = hw.Transport.Init(DriverFeatures); err != nil {
+		return
+	}
+
+	if id := hw.Transport.DeviceID(); id != virtio.BlockDevice {
+		return fmt.Errorf("unexpected device ID %d", id)
+	}
+
+	hw.features = hw.Transport.NegotiatedFeatures()
+
+	if err = hw.readConfig(); err != nil {
+		return
+	}
+
+	size := hw.Transport.MaxQueueSize(requestQueue)
+
+	if size == 0 {
+		return errors.New("request queue unavailable")
+	}
+
+	if hw.QueueSize > 0 && hw.QueueSize < size {
+		size = hw.QueueSize
+	} else if size > defaultQueueSize {
+		size = defaultQueueSize
+	}
+
+	if size < 3 {
+		return errors.New("request queue too small")
+	}
+
+	length := segmentSize
+
+	if hw.Feature(SizeMax) && hw.config.SizeMax > 0 && int(hw.config.SizeMax) < length {
+		length = int(hw.config.SizeMax)
+	}
+
+	// header and status descriptors are always required
+	segments := size - 2
+
+	if hw.Feature(SegMax) && hw.config.SegMax > 0 && int(hw.config.SegMax) < segments {
+		segments = int(hw.config.SegMax)
+	}
+
+	// the per-request transfer size is rounded down to the block size
+	hw.maxTransfer = segments * length
+	hw.maxTransfer -= hw.maxTransfer % hw.BlockSize()
+
+	if hw.maxTransfer == 0 {
+		return errors.New("invalid segment configuration")
+	}
+
+	hw.queue = &virtio.VirtualQueue{}
+	hw.queue.Init(size, length, 0)
+
+	hw.Transport.SetQueueSize(requestQueue, size)
+	hw.Transport.SetQueue(requestQueue, hw.queue)
+	hw.Transport.SetReady()
+
+	return
+}
+
+func (hw *Block) readConfig() (err error) {
+	buf := hw.Transport.Config(binary.Size(hw.config))
+	_, err = binary.Decode(buf, binary.LittleEndian, &hw.config)
+	return
+}
+
+// Feature returns whether a device type feature bit has been negotiated.
+func (hw *Block) Feature(bit int) bool {
+	return bits.Get64(&hw.features, bit)
+}
+
+// Config returns the device configuration layout.
+func (hw *Block) Config() Config {
+	hw.Lock()
+	defer hw.Unlock()
+
+	hw.readConfig()
+
+	return hw.config
+}
+
+// Capacity returns the device capacity in bytes.
+func (hw *Block) Capacity() int64 {
+	return int64(hw.Config().Capacity) * SectorSize
+}
+
+// BlockSize returns the device block size.
+func (hw *Block) BlockSize() int {
+	if hw.Feature(BlockSize) && hw.config.BlockSize >= SectorSize {
+		return int(hw.config.BlockSize)
+	}
+
+	return SectorSize
+}
+
+// ReadOnly returns whether the device is read-only.
+func (hw *Block) ReadOnly() bool {
+	return hw.Feature(ReadOnly)
+}
+
+// request submits a request to the device and waits for its completion, in
+// is filled with device written data.
+func (hw *Block) request(t uint32, sector uint64, out []byte, in []byte) (err error) {
+	var buf []byte
+
+	hdr := &header{
+		Type:   t,
+		Sector: sector,
+	}
+
+	if buf, err = binary.Append(nil, binary.LittleEndian, hdr); err != nil {
+		return
+	}
+
+	status := []byte{0xff}
+
+	// reclaim descriptors of completed timed out requests
+	for hw.pending > 0 {
+		if _, _, ok := hw.queue.PopChain(nil); !ok {
+			break
+		}
+
+		hw.pending -= 1
+	}
+
+	head, err := hw.queue.PushChain([][]byte{buf, out}, []int{len(in), len(status)})
+
+	if err != nil {
+		return
+	}
+
+	hw.Transport.QueueNotify(requestQueue)
+
+	start := time.Now()
+
+	for {
+		h, _, ok := hw.queue.PopChain([][]byte{in, status})
+
+		if ok && h == head {
+			break
+		}
+
+		if ok {
+			// a timed out request completed, its descriptors are
+			// now released and its result discarded
+			hw.pending -= 1
+			status[0] = 0xff
+		}
+
+		if time.Since(start) >= RequestTimeout {
+			// the chain is released once returned by the device
+			hw.pending += 1
+			return errors.New("request timeout")
+		}
+
+		runtime.Gosched()
+	}
+
+	switch status[0] {
+	case StatusOK:
+		return
+	case StatusIOErr:
+		return errors.New("I/O error")
+	case StatusUnsupp:
+		return errors.New("unsupported request")
+	default:
+		return fmt.Errorf("invalid status %#x", status[0])
+	}
+}
+
+// transfer splits a block aligned transfer in requests fitting the queue.
+func (hw *Block) transfer(t uint32, lba int, buf []byte) (err error) {
+	blockSize := hw.BlockSize()
+
+	if len(buf)%blockSize != 0 {
+		return fmt.Errorf("transfer size must be %d bytes aligned", blockSize)
+	}
+
+	if lba < 0 {
+		return errors.New("invalid block address")
+	}
+
+	if t == TypeOut && hw.ReadOnly() {
+		return errors.New("read-only device")
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	sector := uint64(lba) * uint64(blockSize/SectorSize)
+
+	if end := sector + uint64(len(buf)/SectorSize); end > hw.config.Capacity {
+		return errors.New("transfer exceeds device capacity")
+	}
+
+	for off := 0; off < len(buf); off += hw.maxTransfer {
+		chunk := buf[off:min(off+hw.maxTransfer, len(buf))]
+
+		if t == TypeIn {
+			err = hw.request(t, sector, nil, chunk)
+		} else {
+			err = hw.request(t, sector, chunk, nil)
+		}
+
+		if err != nil {
+			return
+		}
+
+		sector += uint64(len(chunk) / SectorSize)
+	}
+
+	return
+}
+
+// ReadBlocks transfers full blocks of data from the device.
+func (hw *Block) ReadBlocks(lba int, buf []byte) (err error) {
+	return hw.transfer(TypeIn, lba, buf)
+}
+
+// WriteBlocks transfers full blocks of data to the device.
+func (hw *Block) WriteBlocks(lba int, buf []byte) (err error) {
+	return hw.transfer(TypeOut, lba, buf)
+}
+
+// Flush commits any volatile write cache content to persistent storage, it
+// is a no-op when the device does not offer the [Flush] feature.
+func (hw *Block) Flush() (err error) {
+	if !hw.Feature(Flush) {
+		return
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	return hw.request(TypeFlush, 0, nil, nil)
+}
+
+// Discard hints the device that a range of blocks is no longer in use.
+func (hw *Block) Discard(lba int, blocks int) (err error) {
+	if !hw.Feature(Discard) {
+		return errors.New("unsupported request")
+	}
+
+	if lba < 0 || blocks <= 0 {
+		return errors.New("invalid block range")
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	n := uint64(hw.BlockSize() / SectorSize)
+	sector := uint64(lba) * n
+	sectors := uint64(blocks) * n
+
+	if sector+sectors > hw.config.Capacity {
+		return errors.New("discard exceeds device capacity")
+	}
+
+	maxSectors := uint64(hw.config.MaxDiscardSectors)
+
+	if maxSectors == 0 {
+		maxSectors = 0xffffffff
+	}
+
+	for sectors > 0 {
+		seg := &discardSegment{
+			Sector:     sector,
+			NumSectors: uint32(min(sectors, maxSectors)),
+		}
+
+		buf, err := binary.Append(nil, binary.LittleEndian, seg)
+
+		if err != nil {
+			return err
+		}
+
+		if err = hw.request(TypeDiscard, 0, buf, nil); err != nil {
+			return err
+		}
+
+		sector += uint64(seg.NumSectors)
+		sectors -= uint64(seg.NumSectors)
+	}
+
+	return
+}
+
+// ID returns the device identifier string.
+func (hw *Block) ID() (id string, err error) {
+	buf := make([]byte, IDLength)
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	if err = hw.request(TypeGetID, 0, nil, buf); err != nil {
+		return
+	}
+
+	// the string is NUL terminated only if shorter than IDLength
+	for i, c := range buf {
+		if c == 0 {
+			buf = buf[:i]
+			break
+		}
+	}
+
+	return string(buf), nil
+}
@@ -0,0 +1,99 @@
+// VirtIO Block Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package block
+
+import (
+	"errors"
+	"io"
+)
+
+// ReadAt implements the [io.ReaderAt] interface, offset and length are not
+// required to be aligned to the device block size.
+func (hw *Block) ReadAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("invalid offset")
+	}
+
+	capacity := hw.Capacity()
+
+	if off >= capacity {
+		return 0, io.EOF
+	}
+
+	size := int64(len(p))
+
+	if off+size > capacity {
+		size = capacity - off
+		err = io.EOF
+	}
+
+	blockSize := int64(hw.BlockSize())
+	start := off - off%blockSize
+	end := off + size
+
+	if r := end % blockSize; r != 0 {
+		end += blockSize - r
+	}
+
+	buf := make([]byte, end-start)
+
+	if e := hw.ReadBlocks(int(start/blockSize), buf); e != nil {
+		return 0, e
+	}
+
+	n = copy(p[:size], buf[off-start:])
+
+	return
+}
+
+// WriteAt implements the [io.WriterAt] interface, offset and length are not
+// required to be aligned to the device block size (partial blocks are
+// subject to read-modify-write).
+func (hw *Block) WriteAt(p []byte, off int64) (n int, err error) {
+	if off < 0 {
+		return 0, errors.New("invalid offset")
+	}
+
+	if off+int64(len(p)) > hw.Capacity() {
+		return 0, errors.New("write exceeds device capacity")
+	}
+
+	blockSize := int64(hw.BlockSize())
+	start := off - off%blockSize
+	end := off + int64(len(p))
+
+	if r := end % blockSize; r != 0 {
+		end += blockSize - r
+	}
+
+	buf := make([]byte, end-start)
+	head := off != start
+	tail := end != off+int64(len(p))
+
+	// read partial head and tail blocks
+	if head {
+		if err = hw.ReadBlocks(int(start/blockSize), buf[:blockSize]); err != nil {
+			return
+		}
+	}
+
+	if last := end - blockSize; tail && !(head && last == start) {
+		if err = hw.ReadBlocks(int(last/blockSize), buf[last-start:]); err != nil {
+			return
+		}
+	}
+
+	copy(buf[off-start:], p)
+
+	if err = hw.WriteBlocks(int(start/blockSize), buf); err != nil {
+		return
+	}
+
+	return len(p), nil
+}
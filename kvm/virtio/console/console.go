@@ -0,0 +1,411 @@
+// VirtIO Console Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package console implements a driver for VirtIO console devices following
+// reference specifications:
+//   - Virtual I/O Device (VIRTIO) - Version 1.2 - 5.3 Console Device
+//
+// The driver supports multiport devices, exposing each port as an
+// [io.ReadWriter], over any [virtio.VirtIO] transport (MMIO, PCI, LegacyPCI).
+//
+// This package is only meant to be used with `GOOS=tamago` as
+// supported by the TamaGo framework for bare metal Go, see
+// https://github.com/usbarmory/tamago.
+package console
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/usbarmory/tamago/bits"
+	"github.com/usbarmory/tamago/kvm/virtio"
+)
+
+// Feature bits
+const (
+	Size       = 0
+	Multiport  = 1
+	EmergWrite = 2
+)
+
+// DriverFeatures represents the device type features supported by the driver.
+const DriverFeatures = 1<<Size | 1<<Multiport
+
+// Control events
+const (
+	DEVICE_READY  = 0
+	DEVICE_ADD    = 1
+	DEVICE_REMOVE = 2
+	PORT_READY    = 3
+	CONSOLE_PORT  = 4
+	RESIZE        = 5
+	PORT_OPEN     = 6
+	PORT_NAME     = 7
+)
+
+const (
+	controlRxQueue = 2
+	controlTxQueue = 3
+
+	// DefaultMaxPorts is the default maximum number of ports initialized
+	// on multiport devices.
+	DefaultMaxPorts = 8
+
+	queueSize         = 16
+	bufferSize        = 4096
+	controlBufferSize = 256
+	controlSize       = 8
+
+	// [Port.Tx] lock acquisition attempts
+	txSpin = 1000
+)
+
+// PollInterval is the device polling interval, when idle, for blocking reads
+// and [Console.Start].
+var PollInterval = 1 * time.Millisecond
+
+// TxTimeout is the maximum time [Port.Tx] waits for transmit queue
+// availability before discarding buffered output.
+var TxTimeout = 10 * time.Millisecond
+
+// Config represents a VirtIO console device configuration layout.
+type Config struct {
+	Cols       uint16
+	Rows       uint16
+	MaxNrPorts uint32
+	EmergWrite uint32
+}
+
+type control struct {
+	ID    uint32
+	Event uint16
+	Value uint16
+}
+
+// Console represents a VirtIO console device instance.
+type Console struct {
+	sync.Mutex
+
+	// Transport represents the VirtIO transport instance.
+	Transport virtio.VirtIO
+
+	// MaxPorts represents the maximum number of ports initialized on
+	// multiport devices, it defaults to [DefaultMaxPorts].
+	MaxPorts int
+
+	config   Config
+	features uint64
+
+	ports []*Port
+
+	ctrlRx     *virtio.VirtualQueue
+	ctrlTx     *virtio.VirtualQueue
+	ctrlBuf    []byte
+	ctrlTxLock sync.Mutex
+}
+
+// Init initializes a VirtIO console device instance.
+func (hw *Console) Init() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.Transport == nil {
+		return errors.New("invalid VirtIO instance")
+	}
+
+	if hw.MaxPorts <= 0 {
+		hw.MaxPorts = DefaultMaxPorts
+	}
+
+	if err = hw.Transport.Init(DriverFeatures); err != nil {
+		return
+	}
+
+	if id := hw.Transport.DeviceID(); id != virtio.Console {
+		return fmt.Errorf("unexpected device ID %d", id)
+	}
+
+	hw.features = hw.Transport.NegotiatedFeatures()
+
+	if err = hw.readConfig(); err != nil {
+		return
+	}
+
+	n := 1
+
+	if hw.Feature(Multiport) {
+		n = max(1, min(int(hw.config.MaxNrPorts), hw.MaxPorts))
+
+		hw.ctrlRx = &virtio.VirtualQueue{}
+		hw.ctrlTx = &virtio.VirtualQueue{}
+		hw.ctrlBuf = make([]byte, controlBufferSize)
+
+		if err = hw.initQueue(hw.ctrlRx, controlRxQueue, controlBufferSize, virtio.Write); err != nil {
+			return
+		}
+
+		if err = hw.initQueue(hw.ctrlTx, controlTxQueue, controlBufferSize, 0); err != nil {
+			return
+		}
+	}
+
+	hw.ports = nil
+
+	for id := range n {
+		p := &Port{
+			ID:    id,
+			hw:    hw,
+			rx:    &virtio.VirtualQueue{},
+			tx:    &virtio.VirtualQueue{},
+			rxBuf: make([]byte, bufferSize),
+			txBuf: make([]byte, 0, bufferSize),
+		}
+
+		p.rxIndex, p.txIndex = queueIndex(id)
+
+		if err = hw.initQueue(p.rx, p.rxIndex, bufferSize, virtio.Write); err != nil {
+			return
+		}
+
+		if err = hw.initQueue(p.tx, p.txIndex, bufferSize, 0); err != nil {
+			return
+		}
+
+		hw.ports = append(hw.ports, p)
+	}
+
+	hw.Transport.SetReady()
+
+	// notify receive buffers availability
+	for _, p := range hw.ports {
+		hw.Transport.QueueNotify(p.rxIndex)
+	}
+
+	if !hw.Feature(Multiport) {
+		// single port devices have an implicit console port
+		p := hw.ports[0]
+		p.added = true
+		p.Console = true
+		p.HostConnected = true
+
+		return
+	}
+
+	hw.Transport.QueueNotify(controlRxQueue)
+
+	return hw.send(0, DEVICE_READY, 1)
+}
+
+func queueIndex(id int) (rx int, tx int) {
+	if id == 0 {
+		return 0, 1
+	}
+
+	rx = 2 * (id + 1)
+	tx = rx + 1
+
+	return
+}
+
+func (hw *Console) initQueue(q *virtio.VirtualQueue, index int, length int, flags uint16) (err error) {
+	n := hw.Transport.MaxQueueSize(index)
+
+	if n == 0 {
+		return fmt.Errorf("queue %d unavailable", index)
+	}
+
+	n = min(n, queueSize)
+
+	q.Init(n, length, flags)
+
+	hw.Transport.SetQueueSize(index, n)
+	hw.Transport.SetQueue(index, q)
+
+	return
+}
+
+func (hw *Console) readConfig() (err error) {
+	buf := hw.Transport.Config(binary.Size(hw.config))
+	_, err = binary.Decode(buf, binary.LittleEndian, &hw.config)
+	return
+}
+
+// Feature returns whether a device type feature bit has been negotiated.
+func (hw *Console) Feature(bit int) bool {
+	return bits.Get64(&hw.features, bit)
+}
+
+// Config returns the device configuration layout.
+func (hw *Console) Config() Config {
+	hw.Lock()
+	defer hw.Unlock()
+
+	hw.readConfig()
+
+	return hw.config
+}
+
+// Port returns the indexed port, nil is returned if the port has not been
+// added by the device.
+func (hw *Console) Port(id int) *Port {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if id < 0 || id >= len(hw.ports) || !hw.ports[id].added {
+		return nil
+	}
+
+	return hw.ports[id]
+}
+
+// Ports returns all ports currently added by the device.
+func (hw *Console) Ports() (ports []*Port) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	for _, p := range hw.ports {
+		if p.added {
+			ports = append(ports, p)
+		}
+	}
+
+	return
+}
+
+func (hw *Console) send(id uint32, event uint16, value uint16) (err error) {
+	msg := &control{
+		ID:    id,
+		Event: event,
+		Value: value,
+	}
+
+	buf, err := binary.Append(nil, binary.LittleEndian, msg)
+
+	if err != nil {
+		return
+	}
+
+	hw.ctrlTxLock.Lock()
+	defer hw.ctrlTxLock.Unlock()
+
+	// reclaim completed transmissions
+	for {
+		if _, _, ok := hw.ctrlTx.PopChain(nil); !ok {
+			break
+		}
+	}
+
+	if _, err = hw.ctrlTx.PushChain([][]byte{buf}, nil); err != nil {
+		return
+	}
+
+	hw.Transport.QueueNotify(controlTxQueue)
+
+	return
+}
+
+func (hw *Console) handle(msg *control, data []byte) {
+	hw.Lock()
+
+	if int(msg.ID) >= len(hw.ports) {
+		hw.Unlock()
+		return
+	}
+
+	p := hw.ports[msg.ID]
+
+	hw.Unlock()
+
+	p.Lock()
+	defer p.Unlock()
+
+	switch msg.Event {
+	case DEVICE_ADD:
+		p.added = true
+		p.removed = false
+		hw.send(msg.ID, PORT_READY, 1)
+		hw.send(msg.ID, PORT_OPEN, 1)
+	case DEVICE_REMOVE:
+		p.added = false
+		p.removed = true
+		p.HostConnected = false
+	case CONSOLE_PORT:
+		p.Console = true
+		hw.send(msg.ID, PORT_OPEN, 1)
+	case RESIZE:
+		if len(data) >= 4 {
+			p.cols = binary.LittleEndian.Uint16(data[0:])
+			p.rows = binary.LittleEndian.Uint16(data[2:])
+		}
+	case PORT_OPEN:
+		p.HostConnected = msg.Value == 1
+	case PORT_NAME:
+		for i, c := range data {
+			if c == 0 {
+				data = data[:i]
+				break
+			}
+		}
+
+		p.Name = string(data)
+	}
+}
+
+// Poll processes all pending control messages (port addition, removal, resize
+// and naming), it returns whether any message has been processed.
+//
+// On multiport devices Poll must be invoked periodically, or on device
+// interrupts, unless [Console.Start] is used.
+func (hw *Console) Poll() (processed bool) {
+	if hw.ctrlRx == nil {
+		return
+	}
+
+	for {
+		n, err := hw.ctrlRx.Pop(hw.ctrlBuf)
+
+		if err != nil || n == 0 {
+			break
+		}
+
+		processed = true
+
+		if n < controlSize {
+			continue
+		}
+
+		msg := &control{}
+
+		if _, err = binary.Decode(hw.ctrlBuf, binary.LittleEndian, msg); err != nil {
+			continue
+		}
+
+		hw.handle(msg, hw.ctrlBuf[controlSize:n])
+	}
+
+	if processed && hw.ctrlRx.NeedsNotify() {
+		hw.Transport.QueueNotify(controlRxQueue)
+	}
+
+	return
+}
+
+// Start processes control messages in a background goroutine, using
+// [PollInterval] as idle interval.
+func (hw *Console) Start() {
+	go func() {
+		for {
+			if !hw.Poll() {
+				time.Sleep(PollInterval)
+			}
+		}
+	}()
+}
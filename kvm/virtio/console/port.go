@@ -0,0 +1,240 @@
+// VirtIO Console Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package console
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/usbarmory/tamago/kvm/virtio"
+)
+
+// Port represents a VirtIO console port, it implements the [io.ReadWriter]
+// interface.
+type Port struct {
+	sync.Mutex
+
+	// ID represents the port identifier.
+	ID int
+	// Name represents the port name, as reported by the device.
+	Name string
+	// Console indicates whether the port is a console port.
+	Console bool
+	// HostConnected indicates whether the host side is connected.
+	HostConnected bool
+
+	hw *Console
+
+	added   bool
+	removed bool
+
+	// console size as reported with resize control messages
+	cols uint16
+	rows uint16
+
+	rx      *virtio.VirtualQueue
+	tx      *virtio.VirtualQueue
+	rxIndex int
+	txIndex int
+
+	rxLock sync.Mutex
+	txLock sync.Mutex
+
+	// receive scratch buffer and pending data
+	rxBuf   []byte
+	pending []byte
+
+	// output buffer for Tx
+	txBuf []byte
+	txOut [1][]byte
+	// characters discarded by Tx
+	dropped atomic.Uint64
+}
+
+// Size returns the console size (columns and rows), if not reported by the
+// device zero values are returned.
+func (p *Port) Size() (cols int, rows int) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.cols != 0 || p.rows != 0 {
+		return int(p.cols), int(p.rows)
+	}
+
+	if p.ID != 0 || !p.hw.Feature(Size) {
+		return
+	}
+
+	config := p.hw.Config()
+
+	return int(config.Cols), int(config.Rows)
+}
+
+func (p *Port) isRemoved() bool {
+	p.Lock()
+	defer p.Unlock()
+
+	return p.removed
+}
+
+// Read implements the [io.Reader] interface, it blocks until data is
+// available, [io.EOF] is returned if the port is removed.
+func (p *Port) Read(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return
+	}
+
+	p.rxLock.Lock()
+	defer p.rxLock.Unlock()
+
+	for len(p.pending) == 0 {
+		if p.isRemoved() {
+			return 0, io.EOF
+		}
+
+		if n, err = p.rx.Pop(p.rxBuf); err != nil {
+			return 0, err
+		}
+
+		if n > 0 {
+			p.pending = p.rxBuf[:n]
+
+			if p.rx.NeedsNotify() {
+				p.hw.Transport.QueueNotify(p.rxIndex)
+			}
+
+			break
+		}
+
+		time.Sleep(PollInterval)
+	}
+
+	n = copy(b, p.pending)
+	p.pending = p.pending[n:]
+
+	return
+}
+
+func (p *Port) write(b []byte) (err error) {
+	// reclaim completed transmissions
+	for {
+		if _, _, ok := p.tx.PopChain(nil); !ok {
+			break
+		}
+	}
+
+	if _, err = p.tx.PushChain([][]byte{b}, nil); err != nil {
+		return
+	}
+
+	p.hw.Transport.QueueNotify(p.txIndex)
+
+	return
+}
+
+// Write implements the [io.Writer] interface.
+func (p *Port) Write(b []byte) (n int, err error) {
+	if p.isRemoved() {
+		return 0, errors.New("port removed")
+	}
+
+	p.txLock.Lock()
+	defer p.txLock.Unlock()
+
+	for n < len(b) {
+		end := min(n+bufferSize, len(b))
+
+		if err = p.write(b[n:end]); err != nil {
+			return
+		}
+
+		n = end
+	}
+
+	return
+}
+
+// Tx buffers a single character for transmission, the buffer is flushed on
+// line feed or when full. It is meant to be used as standard output (printk)
+// once the device is initialized.
+//
+// Tx does not block or allocate memory, characters are discarded (see
+// [Port.Dropped]) when the port is in use for more than a bounded number of
+// attempts or when the transmit queue is not available within [TxTimeout].
+func (p *Port) Tx(c byte) {
+	if !p.tryLock() {
+		p.dropped.Add(1)
+		return
+	}
+
+	defer p.txLock.Unlock()
+
+	p.txBuf = append(p.txBuf, c)
+
+	if c == 0x0a || len(p.txBuf) == cap(p.txBuf) {
+		p.flush()
+	}
+}
+
+func (p *Port) tryLock() bool {
+	for range txSpin {
+		if p.txLock.TryLock() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flush must be invoked with the transmit lock held.
+func (p *Port) flush() {
+	if len(p.txBuf) == 0 {
+		return
+	}
+
+	p.txOut[0] = p.txBuf
+	p.txBuf = p.txBuf[:0]
+	start := time.Now()
+
+	for {
+		// reclaim completed transmissions
+		for {
+			if _, _, ok := p.tx.PopChain(nil); !ok {
+				break
+			}
+		}
+
+		if _, err := p.tx.PushChain(p.txOut[:], nil); err == nil {
+			break
+		}
+
+		if time.Since(start) >= TxTimeout {
+			p.dropped.Add(uint64(len(p.txOut[0])))
+			return
+		}
+	}
+
+	p.hw.Transport.QueueNotify(p.txIndex)
+}
+
+// Flush transmits any character buffered with [Port.Tx].
+func (p *Port) Flush() {
+	p.txLock.Lock()
+	defer p.txLock.Unlock()
+
+	p.flush()
+}
+
+// Dropped returns the number of characters discarded by [Port.Tx].
+func (p *Port) Dropped() uint64 {
+	return p.dropped.Load()
+}
@@ -0,0 +1,248 @@
+// VirtIO Entropy Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package entropy implements a driver for VirtIO entropy devices following
+// reference specifications:
+//   - Virtual I/O Device (VIRTIO) - Version 1.2 - 5.4 Entropy Device
+//
+// The driver supports any [virtio.VirtIO] transport (MMIO, PCI, LegacyPCI)
+// and can be registered as, or seed, the runtime random number generator.
+//
+// This package is only meant to be used with `GOOS=tamago` as
+// supported by the TamaGo framework for bare metal Go, see
+// https://github.com/usbarmory/tamago.
+package entropy
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/usbarmory/tamago/internal/rng"
+	"github.com/usbarmory/tamago/kvm/virtio"
+)
+
+const (
+	requestQueue = 0
+	queueSize    = 8
+	bufferSize   = 256
+	poolSize     = 1024
+)
+
+// RequestTimeout is the timeout for entropy requests sent to the device.
+var RequestTimeout = 1 * time.Second
+
+// RNG represents a VirtIO entropy device instance.
+type RNG struct {
+	sync.Mutex
+
+	// Transport represents the VirtIO transport instance.
+	Transport virtio.VirtIO
+
+	queue *virtio.VirtualQueue
+
+	// buffered device output, served by GetRandomData
+	pool      [poolSize]byte
+	avail     int
+	poolMutex sync.Mutex
+	refill    chan struct{}
+	drbg      *rng.DRBG
+}
+
+// Init initializes a VirtIO entropy device instance.
+func (hw *RNG) Init() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.Transport == nil {
+		return errors.New("invalid VirtIO instance")
+	}
+
+	if err = hw.Transport.Init(0); err != nil {
+		return
+	}
+
+	if id := hw.Transport.DeviceID(); id != virtio.EntropySource {
+		return fmt.Errorf("unexpected device ID %d", id)
+	}
+
+	size := min(hw.Transport.MaxQueueSize(requestQueue), queueSize)
+
+	if size == 0 {
+		return errors.New("request queue unavailable")
+	}
+
+	hw.queue = &virtio.VirtualQueue{}
+	hw.queue.Init(size, bufferSize, 0)
+
+	hw.Transport.SetQueueSize(requestQueue, size)
+	hw.Transport.SetQueue(requestQueue, hw.queue)
+	hw.Transport.SetReady()
+
+	return
+}
+
+func (hw *RNG) read(b []byte) (n int, err error) {
+	head, err := hw.queue.PushChain(nil, []int{len(b)})
+
+	if err != nil {
+		return
+	}
+
+	hw.Transport.QueueNotify(requestQueue)
+
+	start := time.Now()
+
+	for {
+		h, n, ok := hw.queue.PopChain([][]byte{b})
+
+		if ok && h == head {
+			return n, nil
+		}
+
+		if time.Since(start) >= RequestTimeout {
+			return 0, errors.New("request timeout")
+		}
+
+		runtime.Gosched()
+	}
+}
+
+// Read fills b with random data gathered from the device, it implements the
+// [io.Reader] interface.
+func (hw *RNG) Read(b []byte) (n int, err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.queue == nil {
+		return 0, errors.New("device not initialized")
+	}
+
+	for n < len(b) {
+		var c int
+
+		end := min(n+bufferSize, len(b))
+
+		if c, err = hw.read(b[n:end]); err != nil {
+			return
+		}
+
+		if c == 0 {
+			return n, errors.New("no entropy available")
+		}
+
+		n += c
+	}
+
+	return
+}
+
+// Mix registers, as runtime random number generator, a DRBG seeded with both
+// the device output and the current one (e.g. RDRAND on AMD64). The device is
+// accessed only once for seeding, as the runtime generator must not block,
+// while the current generator is retained as an entropy contribution.
+func (hw *RNG) Mix() (err error) {
+	var dev [32]byte
+	var cur [32]byte
+
+	if _, err = hw.Read(dev[:]); err != nil {
+		return
+	}
+
+	if fn := rng.GetRandomDataFn; fn != nil {
+		fn(cur[:])
+	}
+
+	h := sha256.New()
+	h.Write(cur[:])
+	h.Write(dev[:])
+
+	drbg := &rng.DRBG{}
+	copy(drbg.Seed[:], h.Sum(nil))
+
+	rng.GetRandomDataFn = drbg.GetRandomData
+
+	return
+}
+
+func (hw *RNG) fill() {
+	var buf [poolSize]byte
+
+	for range hw.refill {
+		n, _ := hw.Read(buf[:])
+
+		if n < sha256.Size {
+			continue
+		}
+
+		// reseed the fallback generator with fresh device output
+		hw.drbg.Lock()
+		h := sha256.New()
+		h.Write(hw.drbg.Seed[:])
+		h.Write(buf[:sha256.Size])
+		copy(hw.drbg.Seed[:], h.Sum(nil))
+		hw.drbg.Unlock()
+
+		m := n - sha256.Size
+
+		hw.poolMutex.Lock()
+		hw.avail = copy(hw.pool[poolSize-m:], buf[sha256.Size:n])
+		hw.poolMutex.Unlock()
+	}
+}
+
+// GetRandomData returns len(b) random bytes, it never blocks as required for
+// the runtime random number generator. Data is served from device output
+// buffered by [RNG.SetRNG], when exhausted the remaining bytes are taken from
+// a DRBG reseeded with device output on every buffer refill.
+func (hw *RNG) GetRandomData(b []byte) {
+	hw.poolMutex.Lock()
+	n := copy(b, hw.pool[poolSize-hw.avail:poolSize])
+	clear(hw.pool[poolSize-hw.avail : poolSize-hw.avail+n])
+	hw.avail -= n
+
+	if hw.avail < poolSize/2 {
+		select {
+		case hw.refill <- struct{}{}:
+		default:
+		}
+	}
+	hw.poolMutex.Unlock()
+
+	if n < len(b) {
+		hw.drbg.GetRandomData(b[n:])
+	}
+}
+
+// SetRNG registers the device as the runtime random number generator
+// (`goos.GetRandomData`), replacing the current one (e.g. RDRAND on AMD64).
+//
+// As the runtime generator must not block, device output is buffered by a
+// goroutine which refills it in the background (see [RNG.GetRandomData]).
+func (hw *RNG) SetRNG() (err error) {
+	var seed [32]byte
+
+	if _, err = hw.Read(seed[:]); err != nil {
+		return
+	}
+
+	hw.drbg = &rng.DRBG{}
+	copy(hw.drbg.Seed[:], seed[:])
+
+	hw.refill = make(chan struct{}, 1)
+	hw.refill <- struct{}{}
+
+	go hw.fill()
+
+	rng.GetRandomDataFn = hw.GetRandomData
+
+	return
+}
@@ -13,6 +13,7 @@ import (
 	"fmt"
 
 	"github.com/usbarmory/tamago/amd64"
+	"github.com/usbarmory/tamago/bits"
 	"github.com/usbarmory/tamago/internal/reg"
 	"github.com/usbarmory/tamago/soc/intel/pci"
 )
@@ -54,6 +55,8 @@ type LegacyPCI struct {
 
 	msix        *pci.CapabilityMSIX
 	msixEnabled bool
+	// interrupt vector for queues sharing the first MSI-X entry
+	sharedVector int
 }
 
 func (io *LegacyPCI) addCapability(off uint32, hdr *pci.CapabilityHeader) error {
@@ -191,6 +194,8 @@ func (io *LegacyPCI) setStatus(s uint32) {
 
 // SetQueue registers the indexed virtual queue for device access.
 func (io *LegacyPCI) SetQueue(index int, queue *VirtualQueue) {
+	queue.setEventIndex(bits.Get64(&io.features, EventIndex))
+
 	desc, _, _ := queue.Address()
 	reg.Out16(io.config+legacyQueueSelect, uint16(index))
 	reg.Out32(io.config+legacyQueueAddress, uint32(desc/pageSize))
@@ -216,11 +221,18 @@ func (io *LegacyPCI) ConfigVersion() uint32 {
 
 // EnableInterrupt enables MSI-X interrupt vector routing to a LAPIC instance
 // for the indexed virtual queue.
+//
+// All virtual queues share the first MSI-X entry and therefore must use the
+// same interrupt vector.
 func (io *LegacyPCI) EnableInterrupt(id int, index int) (err error) {
 	if io.msix == nil {
 		return errors.New("missing required capabilities")
 	}
 
+	if io.msixEnabled && io.sharedVector != id {
+		return fmt.Errorf("queue %d requires shared vector %d", index, io.sharedVector)
+	}
+
 	entry := 0
 	addr := uint64(amd64.LAPIC_BASE)
 	data := uint32(id)
@@ -230,6 +242,7 @@ func (io *LegacyPCI) EnableInterrupt(id int, index int) (err error) {
 	}
 
 	io.msixEnabled = true
+	io.sharedVector = id
 	reg.Out16(io.config+legacyQueueSelect, uint16(index))
 	reg.Out16(io.config+legacyQueueMSIXVector, uint16(entry))
 
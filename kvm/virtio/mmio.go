@@ -179,6 +179,8 @@ func (io *MMIO) Status() uint32 {
 
 // SetQueue registers the indexed virtual queue for device access.
 func (io *MMIO) SetQueue(index int, queue *VirtualQueue) {
+	queue.setEventIndex(bits.Get64(&io.features, EventIndex))
+
 	desc, driver, device := queue.Address()
 
 	reg.Write(io.Base+QueueSel, uint32(index))
@@ -0,0 +1,106 @@
+// VirtIO Network Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// Control classes
+const (
+	ClassRx            = 0
+	ClassMAC           = 1
+	ClassVLAN          = 2
+	ClassAnnounce      = 3
+	ClassMultiQueue    = 4
+	ClassGuestOffloads = 5
+)
+
+// Control commands
+const (
+	CommandMACAddressSet    = 1
+	CommandAnnounceAck      = 0
+	CommandQueuePairsSet    = 0
+	CommandGuestOffloadsSet = 0
+)
+
+// Control acknowledgement
+const (
+	AckOK    = 0
+	AckError = 1
+)
+
+const ctrlBufferSize = 64
+
+// CommandTimeout is the timeout for commands sent to the control queue.
+var CommandTimeout = 1 * time.Second
+
+// Command sends a command to the device control queue.
+func (hw *Net) Command(class uint8, cmd uint8, data []byte) (err error) {
+	if hw.ctrl == nil {
+		return errors.New("control queue unavailable")
+	}
+
+	hw.ctrlLock.Lock()
+	defer hw.ctrlLock.Unlock()
+
+	ack := []byte{AckError}
+
+	head, err := hw.ctrl.PushChain([][]byte{{class, cmd}, data}, []int{len(ack)})
+
+	if err != nil {
+		return
+	}
+
+	hw.Transport.QueueNotify(hw.ctrlIndex)
+
+	start := time.Now()
+
+	for {
+		h, _, ok := hw.ctrl.PopChain([][]byte{ack})
+
+		if ok && h == head {
+			break
+		}
+
+		if time.Since(start) >= CommandTimeout {
+			return errors.New("control queue timeout")
+		}
+
+		runtime.Gosched()
+	}
+
+	if ack[0] != AckOK {
+		return fmt.Errorf("control command error, class:%d cmd:%d", class, cmd)
+	}
+
+	return
+}
+
+func (hw *Net) setQueuePairs(n int) error {
+	data := binary.LittleEndian.AppendUint16(nil, uint16(n))
+	return hw.Command(ClassMultiQueue, CommandQueuePairsSet, data)
+}
+
+// SetGuestOffloads configures the receive offload features (e.g. [GuestTSO4],
+// [GuestChecksum]) the device is allowed to use, it requires the
+// [CtrlGuestOffloads] feature.
+func (hw *Net) SetGuestOffloads(features uint64) (err error) {
+	if !hw.Feature(CtrlGuestOffloads) {
+		return errors.New("unsupported feature")
+	}
+
+	data := binary.LittleEndian.AppendUint64(nil, features)
+
+	return hw.Command(ClassGuestOffloads, CommandGuestOffloadsSet, data)
+}
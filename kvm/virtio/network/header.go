@@ -0,0 +1,62 @@
+// VirtIO Network Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package network
+
+import (
+	"encoding/binary"
+)
+
+// Header flags
+const (
+	NeedsChecksum = 0
+	DataValid     = 1
+	RSCInfo       = 2
+)
+
+// Header GSO types
+const (
+	GSONone  = 0
+	GSOTCPv4 = 1
+	GSOUDP   = 3
+	GSOTCPv6 = 4
+	GSOUDPL4 = 5
+	GSOECN   = 0x80
+)
+
+const headerSize = 12
+
+// Header represents the VirtIO network packet header (virtio_net_hdr), it
+// carries checksum and segmentation offload information.
+type Header struct {
+	Flags          uint8
+	GSOType        uint8
+	HeaderLength   uint16
+	GSOSize        uint16
+	ChecksumStart  uint16
+	ChecksumOffset uint16
+	NumBuffers     uint16
+}
+
+// Bytes converts the header structure to byte array format.
+func (h *Header) Bytes() []byte {
+	buf := make([]byte, headerSize)
+	binary.Encode(buf, binary.LittleEndian, h)
+	return buf
+}
+
+// Unmarshal decodes a header from byte array format, the header length can be
+// shorter than the structure size on legacy devices (without num_buffers).
+func (h *Header) Unmarshal(buf []byte) (err error) {
+	hdr := make([]byte, headerSize)
+	copy(hdr, buf)
+
+	_, err = binary.Decode(hdr, binary.LittleEndian, h)
+
+	return
+}
@@ -0,0 +1,347 @@
+// VirtIO Network Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package network implements a driver for VirtIO network devices following
+// reference specifications:
+//   - Virtual I/O Device (VIRTIO) - Version 1.2 - 5.1 Network Device
+//
+// The driver supports any [virtio.VirtIO] transport (MMIO, PCI, LegacyPCI).
+//
+// This package is only meant to be used with `GOOS=tamago` as
+// supported by the TamaGo framework for bare metal Go, see
+// https://github.com/usbarmory/tamago.
+package network
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/usbarmory/tamago/bits"
+	"github.com/usbarmory/tamago/kvm/virtio"
+)
+
+// Feature bits
+const (
+	Checksum          = 0
+	GuestChecksum     = 1
+	CtrlGuestOffloads = 2
+	MTU               = 3
+	MAC               = 5
+	GuestTSO4         = 7
+	GuestTSO6         = 8
+	GuestECN          = 9
+	GuestUFO          = 10
+	HostTSO4          = 11
+	HostTSO6          = 12
+	HostECN           = 13
+	HostUFO           = 14
+	MergeableRxBuffer = 15
+	Status            = 16
+	CtrlQueue         = 17
+	CtrlRx            = 18
+	CtrlVLAN          = 19
+	GuestAnnounce     = 21
+	MultiQueue        = 22
+	CtrlMACAddress    = 23
+)
+
+// Status bits
+const (
+	LinkUp   = 0
+	Announce = 1
+)
+
+// DriverFeatures represents the default device type features requested by
+// the driver.
+//
+// Receive offloads (e.g. [GuestChecksum], [GuestTSO4]) are not requested by
+// default as they require frames to be received with [Net.ReceiveOffload] to
+// complete checksums and segmentation.
+const DriverFeatures = 1<<Checksum | 1<<MTU | 1<<MAC | 1<<HostTSO4 |
+	1<<HostTSO6 | 1<<MergeableRxBuffer | 1<<Status | 1<<CtrlQueue |
+	1<<MultiQueue
+
+const (
+	defaultQueueSize = 256
+	// maximum queue size with unmerged large receive buffers
+	largeQueueSize = 32
+
+	defaultMTU = 1500
+	// Ethernet header and VLAN tag
+	frameOverhead = 14 + 4
+
+	// default receive buffer size (merged buffers, no TSO)
+	bufferSize = 2048
+	// receive buffer size with unmerged large receive buffers
+	largeBufferSize = 65562
+)
+
+// Config represents a VirtIO network device configuration layout.
+type Config struct {
+	MAC               [6]byte
+	Status            uint16
+	MaxVirtqueuePairs uint16
+	MTU               uint16
+	Speed             uint32
+	Duplex            uint8
+}
+
+type queuePair struct {
+	rxLock sync.Mutex
+	txLock sync.Mutex
+
+	rx *virtio.VirtualQueue
+	tx *virtio.VirtualQueue
+
+	// receive scratch buffer
+	buf []byte
+	// merged receive buffers to discard
+	drop int
+}
+
+// Net represents a VirtIO network device instance.
+type Net struct {
+	sync.Mutex
+
+	// Transport represents the VirtIO transport instance.
+	Transport virtio.VirtIO
+
+	// MAC address, when the device does not provide one and this field
+	// is unset a random locally administered address is used.
+	MAC net.HardwareAddr
+
+	// Features represents the device type feature bits requested by the
+	// driver, [DriverFeatures] is used when zero. The [virtio.Packed]
+	// feature bit can be set to request packed virtual queues.
+	Features uint64
+
+	// QueuePairs represents the number of receive/transmit queue pairs
+	// to enable, it is limited to the device maximum and defaults to 1.
+	QueuePairs int
+
+	// QueueSize represents the virtual queues size, it is limited to the
+	// device maximum and defaults to 256.
+	QueueSize int
+
+	config   Config
+	features uint64
+
+	// virtio_net_hdr length
+	hdrLen int
+	// receive buffer length
+	bufLen int
+
+	queues []*queuePair
+
+	ctrlLock sync.Mutex
+	ctrl     *virtio.VirtualQueue
+
+	// control queue index
+	ctrlIndex int
+	// next receive queue to poll
+	next int
+}
+
+// Init initializes a VirtIO network device instance.
+func (hw *Net) Init() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.Transport == nil {
+		return errors.New("invalid VirtIO instance")
+	}
+
+	if hw.Features == 0 {
+		hw.Features = DriverFeatures
+	}
+
+	if err = hw.Transport.Init(hw.Features); err != nil {
+		return
+	}
+
+	if id := hw.Transport.DeviceID(); id != virtio.NetworkCard {
+		return fmt.Errorf("unexpected device ID %d", id)
+	}
+
+	hw.features = hw.Transport.NegotiatedFeatures()
+
+	if err = hw.readConfig(); err != nil {
+		return
+	}
+
+	if err = hw.setMAC(); err != nil {
+		return
+	}
+
+	// the header always includes num_buffers on modern devices
+	if hw.Feature(MergeableRxBuffer) || bits.Get64(&hw.features, virtio.Version1) {
+		hw.hdrLen = headerSize
+	} else {
+		hw.hdrLen = headerSize - 2
+	}
+
+	size := defaultQueueSize
+
+	if hw.QueueSize > 0 {
+		size = hw.QueueSize
+	}
+
+	switch {
+	case hw.Feature(MergeableRxBuffer):
+		hw.bufLen = bufferSize
+	case hw.Feature(GuestTSO4) || hw.Feature(GuestTSO6) || hw.Feature(GuestUFO):
+		hw.bufLen = largeBufferSize
+		size = min(size, largeQueueSize)
+	default:
+		hw.bufLen = max(bufferSize, hw.MTU()+frameOverhead+hw.hdrLen)
+	}
+
+	pairs := 1
+	hw.ctrlIndex = 2
+
+	if hw.Feature(MultiQueue) {
+		pairs = max(1, min(hw.QueuePairs, int(hw.config.MaxVirtqueuePairs)))
+		hw.ctrlIndex = 2 * int(hw.config.MaxVirtqueuePairs)
+	}
+
+	hw.queues = nil
+
+	for i := range pairs {
+		if err = hw.initQueuePair(i, size); err != nil {
+			return
+		}
+	}
+
+	if hw.Feature(CtrlQueue) {
+		hw.ctrl = &virtio.VirtualQueue{}
+
+		if err = hw.initQueue(hw.ctrl, hw.ctrlIndex, size, ctrlBufferSize, 0); err != nil {
+			return
+		}
+	}
+
+	hw.Transport.SetReady()
+
+	// notify receive buffers availability
+	for i := range hw.queues {
+		hw.Transport.QueueNotify(2 * i)
+	}
+
+	if pairs > 1 {
+		if err = hw.setQueuePairs(pairs); err != nil {
+			return fmt.Errorf("could not set queue pairs, %v", err)
+		}
+	}
+
+	return
+}
+
+func (hw *Net) initQueue(q *virtio.VirtualQueue, index int, size int, length int, flags uint16) (err error) {
+	n := hw.Transport.MaxQueueSize(index)
+
+	if n == 0 {
+		return fmt.Errorf("queue %d unavailable", index)
+	}
+
+	n = min(n, size)
+
+	q.Packed = bits.Get64(&hw.features, virtio.Packed)
+	q.Init(n, length, flags)
+
+	hw.Transport.SetQueueSize(index, n)
+	hw.Transport.SetQueue(index, q)
+
+	return
+}
+
+func (hw *Net) initQueuePair(i int, size int) (err error) {
+	qp := &queuePair{
+		rx:  &virtio.VirtualQueue{},
+		tx:  &virtio.VirtualQueue{},
+		buf: make([]byte, hw.bufLen),
+	}
+
+	if err = hw.initQueue(qp.rx, 2*i, size, hw.bufLen, virtio.Write); err != nil {
+		return
+	}
+
+	if err = hw.initQueue(qp.tx, 2*i+1, size, bufferSize, 0); err != nil {
+		return
+	}
+
+	hw.queues = append(hw.queues, qp)
+
+	return
+}
+
+func (hw *Net) readConfig() (err error) {
+	buf := hw.Transport.Config(binary.Size(hw.config))
+	_, err = binary.Decode(buf, binary.LittleEndian, &hw.config)
+	return
+}
+
+func (hw *Net) setMAC() (err error) {
+	switch {
+	case hw.Feature(MAC):
+		hw.MAC = make([]byte, 6)
+		copy(hw.MAC, hw.config.MAC[:])
+	case hw.MAC == nil:
+		hw.MAC = make([]byte, 6)
+		rand.Read(hw.MAC)
+		// flag address as unicast and locally administered
+		hw.MAC[0] &= 0xfe
+		hw.MAC[0] |= 0x02
+	case len(hw.MAC) != 6:
+		return errors.New("invalid MAC")
+	}
+
+	return
+}
+
+// Feature returns whether a device type feature bit has been negotiated.
+func (hw *Net) Feature(bit int) bool {
+	return bits.Get64(&hw.features, bit)
+}
+
+// Config returns the device configuration layout.
+func (hw *Net) Config() Config {
+	hw.Lock()
+	defer hw.Unlock()
+
+	hw.readConfig()
+
+	return hw.config
+}
+
+// MTU returns the device Maximum Transmission Unit.
+func (hw *Net) MTU() int {
+	if hw.Feature(MTU) && hw.config.MTU > 0 {
+		return int(hw.config.MTU)
+	}
+
+	return defaultMTU
+}
+
+// LinkUp returns whether the device link is up, it always returns true when
+// the device does not offer the [Status] feature.
+func (hw *Net) LinkUp() bool {
+	if !hw.Feature(Status) {
+		return true
+	}
+
+	return hw.Config().Status&(1<<LinkUp) != 0
+}
+
+// EnabledQueuePairs returns the number of enabled receive/transmit queue pairs.
+func (hw *Net) EnabledQueuePairs() int {
+	return len(hw.queues)
+}
@@ -0,0 +1,192 @@
+// VirtIO Network Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package network
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/usbarmory/tamago/kvm/virtio"
+)
+
+func (hw *Net) receive(i int, buf []byte) (n int, hdr *Header, err error) {
+	var m int
+	var popped, truncated bool
+
+	qp := hw.queues[i]
+
+	qp.rxLock.Lock()
+	defer qp.rxLock.Unlock()
+
+	defer func() {
+		if popped && qp.rx.NeedsNotify() {
+			hw.Transport.QueueNotify(2 * i)
+		}
+	}()
+
+	// discard merged buffers left over by an incomplete frame
+	for qp.drop > 0 {
+		if m, err = qp.rx.Pop(qp.buf); err != nil || m == 0 {
+			return
+		}
+
+		qp.drop -= 1
+		popped = true
+	}
+
+	if m, err = qp.rx.Pop(qp.buf); err != nil || m == 0 {
+		return
+	}
+
+	popped = true
+
+	if m < hw.hdrLen {
+		return 0, nil, errors.New("invalid frame")
+	}
+
+	hdr = &Header{}
+
+	if err = hdr.Unmarshal(qp.buf[:hw.hdrLen]); err != nil {
+		return 0, nil, err
+	}
+
+	num := 1
+
+	if hw.Feature(MergeableRxBuffer) {
+		num = int(hdr.NumBuffers)
+	}
+
+	n = copy(buf, qp.buf[hw.hdrLen:m])
+	truncated = n < m-hw.hdrLen
+
+	// collect the remaining merged buffers
+	for j := 1; j < num; j++ {
+		if m, err = qp.rx.Pop(qp.buf); err != nil || m == 0 {
+			// discard the remaining buffers on the next receive
+			qp.drop = num - j
+
+			if err == nil {
+				err = errors.New("incomplete frame")
+			}
+
+			return 0, nil, err
+		}
+
+		c := copy(buf[n:], qp.buf[:m])
+		truncated = truncated || c < m
+		n += c
+	}
+
+	if truncated {
+		return 0, nil, fmt.Errorf("buffer too small (%d)", len(buf))
+	}
+
+	return
+}
+
+// ReceiveQueue receives a single Ethernet frame, along with its offload
+// header, from the indexed queue pair. A nil header is returned if no frame
+// is available.
+func (hw *Net) ReceiveQueue(index int, buf []byte) (n int, hdr *Header, err error) {
+	if index < 0 || index >= len(hw.queues) {
+		return 0, nil, errors.New("invalid queue index")
+	}
+
+	return hw.receive(index, buf)
+}
+
+// ReceiveOffload receives a single Ethernet frame, along with its offload
+// header, polling all enabled queue pairs. A nil header is returned if no
+// frame is available.
+func (hw *Net) ReceiveOffload(buf []byte) (n int, hdr *Header, err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	for range hw.queues {
+		i := hw.next
+		hw.next = (hw.next + 1) % len(hw.queues)
+
+		if n, hdr, err = hw.receive(i, buf); hdr != nil || err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Receive receives a single Ethernet frame from the device, the offload
+// header is discarded therefore receive offload features (e.g.
+// [GuestChecksum]) require [Net.ReceiveOffload] instead.
+func (hw *Net) Receive(buf []byte) (n int, err error) {
+	if len(buf) == 0 {
+		return
+	}
+
+	n, _, err = hw.ReceiveOffload(buf)
+
+	return
+}
+
+// TransmitQueue transmits a single Ethernet frame, with an optional offload
+// header, on the indexed queue pair.
+//
+// The header must be consistent with negotiated offload features, for
+// instance checksum offload ([NeedsChecksum]) requires [Checksum] while
+// segmentation offload ([GSOTCPv4]) requires [HostTSO4].
+func (hw *Net) TransmitQueue(index int, buf []byte, hdr *Header) (err error) {
+	if index < 0 || index >= len(hw.queues) {
+		return errors.New("invalid queue index")
+	}
+
+	if hdr == nil {
+		hdr = &Header{}
+	}
+
+	if hdr.GSOType == GSONone && len(buf) > hw.MTU()+frameOverhead {
+		return errors.New("frame too large")
+	}
+
+	qp := hw.queues[index]
+
+	qp.txLock.Lock()
+	defer qp.txLock.Unlock()
+
+	q := qp.tx
+
+	// reclaim completed transmissions
+	for {
+		if _, _, ok := q.PopChain(nil); !ok {
+			break
+		}
+	}
+
+	if _, err = q.PushChain([][]byte{hdr.Bytes()[:hw.hdrLen], buf}, nil); err != nil {
+		return
+	}
+
+	// honor device notification suppression, only available with event
+	// index or packed virtual queues
+	if !(q.Packed || hw.Feature(virtio.EventIndex)) || q.NeedsNotify() {
+		hw.Transport.QueueNotify(2*index + 1)
+	}
+
+	return
+}
+
+// TransmitOffload transmits a single Ethernet frame along with its offload
+// header, see [Net.TransmitQueue].
+func (hw *Net) TransmitOffload(buf []byte, hdr *Header) (err error) {
+	return hw.TransmitQueue(0, buf, hdr)
+}
+
+// Transmit transmits a single Ethernet frame, the checksum is appended by the
+// device and must not be included.
+func (hw *Net) Transmit(buf []byte) (err error) {
+	return hw.TransmitQueue(0, buf, nil)
+}
@@ -0,0 +1,301 @@
+// VirtIO Virtual Queue support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package virtio
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/usbarmory/tamago/dma"
+)
+
+// Packed Virtqueue Descriptor Flags
+const (
+	AvailableFlag = 1 << 7
+	UsedFlag      = 1 << 15
+)
+
+// Packed Virtqueue Event Suppression Flags
+const (
+	EventFlagsEnable  = 0x0
+	EventFlagsDisable = 0x1
+	EventFlagsDesc    = 0x2
+)
+
+const (
+	packedDescriptorSize = 16
+	eventSuppressionSize = 4
+)
+
+// packedRing represents the state of a VirtIO packed virtual queue.
+type packedRing struct {
+	// DMA buffers
+	ring   []byte // descriptor ring
+	driver []byte // driver event suppression
+	device []byte // device event suppression
+
+	size uint16
+
+	nextAvail uint16
+	availWrap bool
+
+	nextUsed uint16
+	usedWrap bool
+
+	// descriptors made available since last notification check
+	added uint16
+
+	// descriptor count, by buffer ID, for each outstanding chain
+	count []uint16
+	// next descriptor index within outstanding chains
+	next []uint16
+}
+
+func (p *packedRing) init(buf []byte, size uint16) {
+	n := int(size) * packedDescriptorSize
+
+	clear(buf)
+
+	p.ring = buf[0:n]
+	p.driver = buf[n : n+eventSuppressionSize]
+	p.device = buf[n+eventSuppressionSize:]
+
+	p.size = size
+	p.availWrap = true
+	p.usedWrap = true
+	p.count = make([]uint16, size)
+	p.next = make([]uint16, size)
+}
+
+// add writes a descriptor, except for its flags, to the next available ring
+// slot, the slot and flags to be written with setFlags are returned.
+func (p *packedRing) add(addr uint64, length uint32, id uint16, flags uint16) (slot uint16, f uint16) {
+	slot = p.nextAvail
+	off := int(slot) * packedDescriptorSize
+
+	binary.LittleEndian.PutUint64(p.ring[off:], addr)
+	binary.LittleEndian.PutUint32(p.ring[off+8:], length)
+	binary.LittleEndian.PutUint16(p.ring[off+12:], id)
+
+	if p.availWrap {
+		flags |= AvailableFlag
+	} else {
+		flags |= UsedFlag
+	}
+
+	if p.nextAvail += 1; p.nextAvail == p.size {
+		p.nextAvail = 0
+		p.availWrap = !p.availWrap
+	}
+
+	p.added += 1
+
+	return slot, flags
+}
+
+// setFlags writes the flags of a ring slot, making it available to the
+// device once its avail/used bits match the device wrap counter.
+func (p *packedRing) setFlags(slot uint16, flags uint16) {
+	off := int(slot)*packedDescriptorSize + 14
+	binary.LittleEndian.PutUint16(p.ring[off:], flags)
+}
+
+// used returns the buffer ID and written length of the next used descriptor,
+// if any.
+func (p *packedRing) used() (id uint16, length uint32, ok bool) {
+	off := int(p.nextUsed) * packedDescriptorSize
+	flags := binary.LittleEndian.Uint16(p.ring[off+14:])
+
+	avail := flags&AvailableFlag != 0
+	used := flags&UsedFlag != 0
+
+	if avail != used || used != p.usedWrap {
+		return
+	}
+
+	length = binary.LittleEndian.Uint32(p.ring[off+8:])
+	id = binary.LittleEndian.Uint16(p.ring[off+12:])
+
+	return id, length, true
+}
+
+// consume skips the ring slots used by a chain of n descriptors.
+func (p *packedRing) consume(n int) {
+	for range n {
+		if p.nextUsed += 1; p.nextUsed == p.size {
+			p.nextUsed = 0
+			p.usedWrap = !p.usedWrap
+		}
+	}
+}
+
+// setEvent configures the driver event suppression structure, with event
+// index a used buffer notification is requested only once delay descriptors
+// past the next expected one have been used.
+func (p *packedRing) setEvent(eventIndex bool, enable bool, delay uint16) {
+	var flags uint16
+
+	switch {
+	case !enable:
+		flags = EventFlagsDisable
+	case eventIndex && delay > 0:
+		off := p.nextUsed + delay
+		wrap := p.usedWrap
+
+		if off >= p.size {
+			off -= p.size
+			wrap = !wrap
+		}
+
+		if wrap {
+			off |= 1 << 15
+		}
+
+		binary.LittleEndian.PutUint16(p.driver[0:], off)
+		flags = EventFlagsDesc
+	default:
+		flags = EventFlagsEnable
+	}
+
+	binary.LittleEndian.PutUint16(p.driver[2:], flags)
+}
+
+// needsNotify evaluates the device event suppression structure against the
+// descriptors made available since its last invocation.
+func (p *packedRing) needsNotify() bool {
+	added := p.added
+	p.added = 0
+
+	switch binary.LittleEndian.Uint16(p.device[2:]) & 0x3 {
+	case EventFlagsDisable:
+		return false
+	case EventFlagsDesc:
+		offWrap := binary.LittleEndian.Uint16(p.device[0:])
+		event := offWrap &^ (1 << 15)
+
+		if (offWrap>>15 == 1) != p.availWrap {
+			event -= p.size
+		}
+
+		return needsEvent(event, p.nextAvail, p.nextAvail-added)
+	}
+
+	return true
+}
+
+func (d *VirtualQueue) initPacked(flags uint16) {
+	size := int(d.size)
+	n := size*packedDescriptorSize + 2*eventSuppressionSize
+
+	// allocate DMA buffer
+	d.desc, d.buf = dma.Reserve(n, pageSize)
+	d.packed.init(d.buf, d.size)
+
+	// calculate area pointers
+	d.driver = d.desc + uint(size*packedDescriptorSize)
+	d.device = d.driver + eventSuppressionSize
+
+	if flags == Write {
+		// make all buffers immediately available
+		for i := range d.size {
+			d.postPacked(i, len(d.Descriptors[i].buf))
+		}
+	}
+}
+
+// postPacked makes a single buffer available to the device.
+func (d *VirtualQueue) postPacked(index uint16, length int) {
+	desc := d.Descriptors[index]
+	d.packed.count[index] = 1
+
+	slot, flags := d.packed.add(desc.Address, uint32(length), index, desc.Flags&Write)
+	d.packed.setFlags(slot, flags)
+}
+
+func (d *VirtualQueue) popPacked(buf []byte) (n int, err error) {
+	id, length, ok := d.packed.used()
+
+	if !ok {
+		return
+	}
+
+	n = int(length)
+
+	if len(buf) < n {
+		return 0, fmt.Errorf("buffer too small (%d < %d)", len(buf), n)
+	}
+
+	d.packed.consume(int(d.packed.count[id]))
+	d.Descriptors[id].Read(buf)
+
+	// recycle buffer
+	d.postPacked(id, len(d.Descriptors[id].buf))
+	d.updateEvent()
+
+	return
+}
+
+func (d *VirtualQueue) pushPacked(buf []byte) {
+	index := d.next
+
+	if d.next += 1; d.next == d.size {
+		d.next = 0
+	}
+
+	d.Descriptors[index].Write(buf)
+	d.postPacked(index, len(buf))
+}
+
+func (d *VirtualQueue) pushChainPacked(chain []uint16, lengths []int, flags []uint16) {
+	var headSlot, headFlags uint16
+
+	head := chain[0]
+	d.packed.count[head] = uint16(len(chain))
+
+	for i, index := range chain {
+		if i < len(chain)-1 {
+			d.packed.next[index] = chain[i+1]
+		}
+
+		desc := d.Descriptors[index]
+		desc.length = uint32(lengths[i])
+		desc.Flags = flags[i]
+
+		slot, f := d.packed.add(desc.Address, desc.length, head, desc.Flags)
+
+		if i == 0 {
+			// the head descriptor is made available last
+			headSlot, headFlags = slot, f
+			continue
+		}
+
+		d.packed.setFlags(slot, f)
+	}
+
+	d.packed.setFlags(headSlot, headFlags)
+}
+
+func (d *VirtualQueue) popChainPacked() (head uint16, n int, chain []uint16, ok bool) {
+	id, length, ok := d.packed.used()
+
+	if !ok {
+		return
+	}
+
+	chain = d.chain[:0]
+
+	for i, index := 0, id; i < int(d.packed.count[id]); i++ {
+		chain = append(chain, index)
+		index = d.packed.next[index]
+	}
+
+	d.packed.consume(len(chain))
+
+	return id, int(length), chain, true
+}
@@ -11,8 +11,10 @@ package virtio
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
 
 	"github.com/usbarmory/tamago/amd64"
+	"github.com/usbarmory/tamago/bits"
 	"github.com/usbarmory/tamago/dma"
 	"github.com/usbarmory/tamago/internal/reg"
 	"github.com/usbarmory/tamago/soc/intel/pci"
@@ -110,6 +112,9 @@ type PCI struct {
 	config []byte
 
 	msix *pci.CapabilityMSIX
+	// interrupt vector for queues sharing the first MSI-X entry
+	sharedVector int
+	shared       bool
 }
 
 func (io *PCI) addCapability(off uint32, hdr *pci.CapabilityHeader) error {
@@ -262,6 +267,8 @@ func (io *PCI) Status() uint32 {
 
 // SetQueue registers the indexed virtual queue for device access.
 func (io *PCI) SetQueue(index int, queue *VirtualQueue) {
+	queue.setEventIndex(bits.Get64(&io.features, EventIndex))
+
 	desc, driver, device := queue.Address()
 
 	binary.LittleEndian.PutUint16(io.common[queueSel:], uint16(index))
@@ -292,6 +299,11 @@ func (io *PCI) ConfigVersion() uint32 {
 
 // EnableInterrupt enables MSI-X interrupt vector routing to a LAPIC instance
 // for the indexed virtual queue.
+//
+// Each virtual queue is assigned its own MSI-X table entry, allowing distinct
+// interrupt vectors for each queue, when the table size is insufficient the
+// remaining queues share the first entry and therefore must use the same
+// interrupt vector.
 func (io *PCI) EnableInterrupt(id int, index int) (err error) {
 	if io.msix == nil {
 		return errors.New("missing required capabilities")
@@ -301,12 +313,28 @@ func (io *PCI) EnableInterrupt(id int, index int) (err error) {
 	addr := uint64(amd64.LAPIC_BASE)
 	data := uint32(id)
 
+	if index+1 < io.msix.TableSize() {
+		// entry 0 is left for configuration changes
+		entry = index + 1
+	} else if io.shared && io.sharedVector != id {
+		return fmt.Errorf("queue %d requires shared vector %d", index, io.sharedVector)
+	}
+
 	if err = io.msix.EnableInterrupt(entry, addr, data); err != nil {
 		return
 	}
 
+	if entry == 0 {
+		io.sharedVector = id
+		io.shared = true
+	}
+
 	binary.LittleEndian.PutUint16(io.common[queueSel:], uint16(index))
 	binary.LittleEndian.PutUint16(io.common[queueMSIXVector:], uint16(entry))
 
+	if binary.LittleEndian.Uint16(io.common[queueMSIXVector:]) != uint16(entry) {
+		return errors.New("could not set queue vector")
+	}
+
 	return
 }
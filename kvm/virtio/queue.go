@@ -11,6 +11,7 @@ package virtio
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -23,6 +24,15 @@ const (
 	Write = 2
 )
 
+// Available Ring Flags
+const (
+	NoInterrupt = 1
+)
+
+// returned without allocation as descriptor chains can be pushed from
+// standard output sinks (e.g. printk)
+var errQueueFull = errors.New("queue full")
+
 // Descriptor represents a VirtIO virtual queue descriptor.
 //
 // All exported fields are used one-time at initialization, fields requiring
@@ -135,6 +145,15 @@ func (d *Available) SetRingIndex(n uint16, index uint16) {
 	d.ring[n] = index
 }
 
+// SetEventIndex updates the used buffer event index field (used_event), only
+// meaningful when the [EventIndex] feature is negotiated.
+func (d *Available) SetEventIndex(index uint16) {
+	off := 4 + len(d.ring)*2
+	binary.LittleEndian.PutUint16(d.buf[off:], index)
+
+	d.EventIndex = index
+}
+
 // Ring represents a VirtIO virtual queue buffer index
 type Ring struct {
 	Index  uint32
@@ -188,6 +207,15 @@ func (d *Used) Index() uint16 {
 	return d.index
 }
 
+// AvailableEventIndex returns the available buffer event index field
+// (avail_event), only meaningful when the [EventIndex] feature is negotiated.
+func (d *Used) AvailableEventIndex() uint16 {
+	off := 4 + len(d.ring)*8
+	d.AvailEvent = binary.LittleEndian.Uint16(d.buf[off:])
+
+	return d.AvailEvent
+}
+
 // Ring returns a ring buffer at the given position.
 func (d *Used) Ring(n uint16) Ring {
 	off := 4 + n*8
@@ -196,10 +224,16 @@ func (d *Used) Ring(n uint16) Ring {
 	return *d.ring[n]
 }
 
-// VirtualQueue represents a VirtIO split virtual queue Descriptor
+// VirtualQueue represents a VirtIO virtual queue Descriptor, either in split
+// (default) or packed layout.
 type VirtualQueue struct {
 	sync.Mutex
 
+	// Packed selects the packed virtual queue layout, it must be set
+	// before [VirtualQueue.Init] and only when the [Packed] feature has
+	// been negotiated with the device.
+	Packed bool
+
 	Descriptors []*Descriptor
 	Available   Available
 	Used        Used
@@ -211,6 +245,24 @@ type VirtualQueue struct {
 	device uint // physical address for QueueDevice
 
 	size uint16
+
+	// free descriptors for chained buffers
+	free []uint16
+	// descriptor chain scratch buffers
+	chain   []uint16
+	lengths []int
+	flags   []uint16
+
+	// notification suppression state
+	eventIndex  bool
+	noInterrupt bool
+	delay       uint16
+	notified    uint16
+
+	// packed layout state
+	packed packedRing
+	// next descriptor for packed layout single buffer transmission
+	next uint16
 }
 
 // Bytes converts the descriptor structure to byte array format, the device
@@ -237,7 +289,8 @@ func (d *VirtualQueue) Bytes() ([]byte, int, int) {
 	return buf.Bytes(), driver, device
 }
 
-// Init initializes a split virtual queue for the given size.
+// Init initializes a virtual queue for the given size, each descriptor is
+// assigned a DMA buffer of the given length.
 func (d *VirtualQueue) Init(size int, length int, flags uint16) {
 	d.Lock()
 	defer d.Unlock()
@@ -252,11 +305,26 @@ func (d *VirtualQueue) Init(size int, length int, flags uint16) {
 		desc := &Descriptor{}
 		desc.Init(buf[off:off+length], flags)
 
-		ring := &Ring{}
-
 		d.Descriptors = append(d.Descriptors, desc)
+		d.free = append(d.free, uint16(i))
+	}
+
+	d.size = uint16(size)
+
+	// preallocate chain scratch buffers, so that chain operations do not
+	// allocate memory
+	d.chain = make([]uint16, 0, size)
+	d.lengths = make([]int, 0, size)
+	d.flags = make([]uint16, 0, size)
+
+	if d.Packed {
+		d.initPacked(flags)
+		return
+	}
+
+	for i := range size {
 		d.Available.ring = append(d.Available.ring, uint16(i))
-		d.Used.ring = append(d.Used.ring, ring)
+		d.Used.ring = append(d.Used.ring, &Ring{})
 	}
 
 	if flags == Write {
@@ -272,14 +340,13 @@ func (d *VirtualQueue) Init(size int, length int, flags uint16) {
 	// calculate area pointers
 	d.driver = d.desc + uint(driver)
 	d.device = d.desc + uint(device)
-	d.size = uint16(size)
 
 	// assign DMA slices
 	d.Available.buf = d.buf[driver:device]
 	d.Used.buf = d.buf[device:]
 }
 
-// Destroy removes a split virtual queue from physical memory.
+// Destroy removes a virtual queue from physical memory.
 func (d *VirtualQueue) Destroy() {
 	for _, d := range d.Descriptors {
 		d.Destroy()
@@ -287,6 +354,7 @@ func (d *VirtualQueue) Destroy() {
 
 	d.Available.buf = nil
 	d.Used.buf = nil
+	d.packed = packedRing{}
 
 	dma.Release(d.desc)
 }
@@ -296,17 +364,120 @@ func (d *VirtualQueue) Address() (desc uint, driver uint, device uint) {
 	return d.desc, d.driver, d.device
 }
 
+// needsEvent reports whether an event index has been crossed by a ring index
+// update from prev to next.
+func needsEvent(event uint16, next uint16, prev uint16) bool {
+	return next-event-1 < next-prev
+}
+
+// setEventIndex enables or disables event index based notification
+// suppression, it is invoked by transports according to the [EventIndex]
+// feature negotiation.
+func (d *VirtualQueue) setEventIndex(enable bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.eventIndex = enable
+	d.notified = d.Available.index
+
+	if !d.Packed && enable {
+		// flags must be zero with event index
+		d.Available.Flags = 0
+		binary.LittleEndian.PutUint16(d.Available.buf[0:], d.Available.Flags)
+	}
+
+	d.updateEvent()
+}
+
 // NeedsNotify reports whether [VirtIO.QueueNotify] should be invoked to notify
 // the device that the queue can be processed.
+//
+// When the [EventIndex] feature is negotiated, or on packed virtual queues,
+// the device event suppression index is honored against all buffers made
+// available since the previous invocation.
 func (d *VirtualQueue) NeedsNotify() bool {
+	d.Lock()
+	defer d.Unlock()
+
+	switch {
+	case d.Packed:
+		return d.packed.needsNotify()
+	case d.eventIndex:
+		next := d.Available.index
+		prev := d.notified
+		d.notified = next
+
+		return needsEvent(d.Used.AvailableEventIndex(), next, prev)
+	}
+
 	return d.Available.index%d.size == d.Used.Index()%d.size
 }
 
+// EnableInterrupts requests the device to send used buffer notifications
+// (default).
+func (d *VirtualQueue) EnableInterrupts() {
+	d.setInterrupts(true, 0)
+}
+
+// DisableInterrupts requests the device to suppress used buffer
+// notifications, the device is not required to honor the request.
+func (d *VirtualQueue) DisableInterrupts() {
+	d.setInterrupts(false, 0)
+}
+
+// DelayInterrupts requests the device to send used buffer notifications only
+// once n buffers have been used since the last one received, allowing to batch
+// their processing.
+//
+// The request requires the [EventIndex] feature, otherwise it is equivalent to
+// [VirtualQueue.EnableInterrupts].
+func (d *VirtualQueue) DelayInterrupts(n int) {
+	d.setInterrupts(true, uint16(max(0, min(n-1, int(d.size)-1))))
+}
+
+func (d *VirtualQueue) setInterrupts(enable bool, delay uint16) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.noInterrupt = !enable
+	d.delay = delay
+
+	if !d.Packed && !d.eventIndex {
+		if enable {
+			d.Available.Flags &^= NoInterrupt
+		} else {
+			d.Available.Flags |= NoInterrupt
+		}
+
+		binary.LittleEndian.PutUint16(d.Available.buf[0:], d.Available.Flags)
+	}
+
+	d.updateEvent()
+}
+
+// updateEvent updates the used buffer event index, it is invoked on interrupt
+// configuration changes and whenever used buffers are received.
+func (d *VirtualQueue) updateEvent() {
+	switch {
+	case d.Packed:
+		d.packed.setEvent(d.eventIndex, !d.noInterrupt, d.delay)
+	case d.eventIndex && d.noInterrupt:
+		// farthest index from the next expected one
+		d.Available.SetEventIndex(d.Used.last - 1)
+	case d.eventIndex:
+		d.Available.SetEventIndex(d.Used.last + d.delay)
+	}
+}
+
 // Pop receives a single used buffer from the virtual queue,
 func (d *VirtualQueue) Pop(buf []byte) (n int, err error) {
 	d.Lock()
 	defer d.Unlock()
 
+	if d.Packed {
+		return d.popPacked(buf)
+	}
+
 	if d.Used.Index() == d.Used.last {
 		return
 	}
@@ -325,6 +496,7 @@ func (d *VirtualQueue) Pop(buf []byte) (n int, err error) {
 	d.Available.SetIndex(d.Available.index)
 
 	d.Used.last += 1
+	d.updateEvent()
 
 	return
 }
@@ -334,6 +506,11 @@ func (d *VirtualQueue) Push(buf []byte) {
 	d.Lock()
 	defer d.Unlock()
 
+	if d.Packed {
+		d.pushPacked(buf)
+		return
+	}
+
 	index := d.Available.Ring(d.Available.index % d.size)
 
 	// update Descriptor length
@@ -346,3 +523,180 @@ func (d *VirtualQueue) Push(buf []byte) {
 	d.Available.index++
 	d.Available.SetIndex(d.Available.index)
 }
+
+func (d *VirtualQueue) setDescriptor(index uint16, length int, flags uint16, next uint16) {
+	desc := d.Descriptors[index]
+	desc.length = uint32(length)
+	desc.Flags = flags
+	desc.Next = next
+
+	off := index * 16
+	binary.LittleEndian.PutUint32(d.buf[off+8:], desc.length)
+	binary.LittleEndian.PutUint16(d.buf[off+12:], desc.Flags)
+	binary.LittleEndian.PutUint16(d.buf[off+14:], desc.Next)
+}
+
+func segments(n int, length int) int {
+	return (n + length - 1) / length
+}
+
+// PushChain supplies a descriptor chain to the virtual queue, the chain is
+// composed of device-readable buffers, copied from out, followed by
+// device-writable buffers with lengths in in. Buffers exceeding the queue
+// descriptor length are split across multiple descriptors.
+//
+// The returned chain head index identifies the chain once returned by
+// [VirtualQueue.PopChain].
+//
+// Descriptor chains must not be mixed with [VirtualQueue.Push] and
+// [VirtualQueue.Pop] on the same queue.
+func (d *VirtualQueue) PushChain(out [][]byte, in []int) (head uint16, err error) {
+	var n int
+
+	d.Lock()
+	defer d.Unlock()
+
+	length := len(d.Descriptors[0].buf)
+
+	for _, buf := range out {
+		n += segments(len(buf), length)
+	}
+
+	for _, size := range in {
+		n += segments(size, length)
+	}
+
+	if n == 0 {
+		return 0, errors.New("empty descriptor chain")
+	}
+
+	if n > len(d.free) {
+		return 0, errQueueFull
+	}
+
+	chain := d.free[len(d.free)-n:]
+	d.free = d.free[:len(d.free)-n]
+
+	lengths := d.lengths[:0]
+	flags := d.flags[:0]
+
+	for _, buf := range out {
+		for off := 0; off < len(buf); off += length {
+			end := min(off+length, len(buf))
+			copy(d.Descriptors[chain[len(lengths)]].buf, buf[off:end])
+
+			lengths = append(lengths, end-off)
+			flags = append(flags, 0)
+		}
+	}
+
+	for _, size := range in {
+		for off := 0; off < size; off += length {
+			lengths = append(lengths, min(length, size-off))
+			flags = append(flags, Write)
+		}
+	}
+
+	for i := range n - 1 {
+		flags[i] |= Next
+	}
+
+	head = chain[0]
+
+	if d.Packed {
+		d.pushChainPacked(chain, lengths, flags)
+		return
+	}
+
+	for i := range n {
+		var next uint16
+
+		if i < n-1 {
+			next = chain[i+1]
+		}
+
+		d.setDescriptor(chain[i], lengths[i], flags[i], next)
+	}
+
+	d.Available.SetRingIndex(d.Available.index%d.size, head)
+	d.Available.index++
+	d.Available.SetIndex(d.Available.index)
+
+	return
+}
+
+// PopChain receives a single used descriptor chain from the virtual queue,
+// copying the contents of its device-writable buffers, in order, across in.
+//
+// The chain head index, as returned by [VirtualQueue.PushChain], is returned
+// along with the number of bytes written by the device, the ok flag is false
+// if no used chain is available.
+func (d *VirtualQueue) PopChain(in [][]byte) (head uint16, n int, ok bool) {
+	var chain []uint16
+	var i, off int
+
+	d.Lock()
+	defer d.Unlock()
+
+	if d.Packed {
+		head, n, chain, ok = d.popChainPacked()
+	} else {
+		head, n, chain, ok = d.popChainSplit()
+	}
+
+	if !ok {
+		return
+	}
+
+	d.updateEvent()
+
+	left := n
+
+	for _, index := range chain {
+		desc := d.Descriptors[index]
+
+		if desc.Flags&Write != 0 && left > 0 {
+			buf := desc.buf[:min(int(desc.length), left)]
+			left -= len(buf)
+
+			for len(buf) > 0 && i < len(in) {
+				c := copy(in[i][off:], buf)
+				buf = buf[c:]
+				off += c
+
+				if off == len(in[i]) {
+					i += 1
+					off = 0
+				}
+			}
+		}
+
+		d.free = append(d.free, index)
+	}
+
+	return
+}
+
+func (d *VirtualQueue) popChainSplit() (head uint16, n int, chain []uint16, ok bool) {
+	if d.Used.Index() == d.Used.last {
+		return
+	}
+
+	used := d.Used.Ring(d.Used.last % d.size)
+	d.Used.last += 1
+
+	head = uint16(used.Index)
+	chain = d.chain[:0]
+
+	for index := head; ; {
+		chain = append(chain, index)
+
+		if desc := d.Descriptors[index]; desc.Flags&Next != 0 {
+			index = desc.Next
+		} else {
+			break
+		}
+	}
+
+	return head, int(used.Length), chain, true
+}
@@ -19,9 +19,22 @@ import (
 	"github.com/usbarmory/tamago/bits"
 )
 
+// Device Types
+const (
+	NetworkCard      = 1
+	BlockDevice      = 2
+	Console          = 3
+	EntropySource    = 4
+	SocketDevice     = 19
+	FileSystemDevice = 26
+)
+
 // Reserved Feature bits
 const (
+	EventIndex       = 29
+	Version1         = 32
 	Packed           = 34
+	InOrder          = 35
 	NotificationData = 38
 )
 
@@ -43,6 +56,9 @@ const (
 	deviceSpecificFeatureMask = 0xfffc000000ffffff
 	// bits 24 to 49
 	deviceReservedFeatureMask = 0x0003ffffff000000
+
+	// reserved features implemented by this package
+	supportedReservedFeatures = 1<<EventIndex | 1<<Version1
 )
 
 // VirtIO represents a VirtIO device.
@@ -83,17 +99,16 @@ type VirtIO interface {
 }
 
 func negotiate(deviceFeatures, driverFeatures uint64) (features uint64) {
-	features = deviceFeatures
+	// keep implemented reserved features and those requested by the driver
+	features = deviceFeatures & deviceReservedFeatureMask
+	features &= supportedReservedFeatures | driverFeatures
 
 	// clear unsupported features
-	bits.Clear64(&features, Packed)
+	bits.Clear64(&features, InOrder)
 	bits.Clear64(&features, NotificationData)
 
-	// keep all remaining reserved features, clear device type ones
-	features &= deviceReservedFeatureMask
-
 	// apply device type features from the driver
-	features &= driverFeatures
+	features |= deviceFeatures & driverFeatures & deviceSpecificFeatureMask
 
 	return
 }
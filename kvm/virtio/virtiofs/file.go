@@ -0,0 +1,373 @@
+// VirtIO File System Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package virtiofs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/fs"
+	"path"
+	"time"
+)
+
+// File represents an open file or directory, it implements the [fs.File],
+// [fs.ReadDirFile], [io.ReaderAt], [io.WriterAt], [io.Seeker] and [io.Writer]
+// interfaces.
+type File struct {
+	fs   *FS
+	name string
+
+	node uint64
+	fh   uint64
+	attr Attr
+	flag int
+	dir  bool
+
+	offset int64
+	closed bool
+
+	// directory stream state
+	dirOffset uint64
+	dirEOF    bool
+	pending   []fs.DirEntry
+}
+
+type fileInfo struct {
+	name string
+	attr Attr
+}
+
+// Name returns the base name of the file.
+func (fi *fileInfo) Name() string { return fi.name }
+
+// Size returns the file length in bytes.
+func (fi *fileInfo) Size() int64 { return int64(fi.attr.Size) }
+
+// Mode returns the file mode bits.
+func (fi *fileInfo) Mode() fs.FileMode { return fi.attr.FileMode() }
+
+// ModTime returns the file modification time.
+func (fi *fileInfo) ModTime() time.Time { return fi.attr.ModTime() }
+
+// IsDir reports whether the file is a directory.
+func (fi *fileInfo) IsDir() bool { return fi.Mode().IsDir() }
+
+// Sys returns the underlying FUSE attributes (*Attr).
+func (fi *fileInfo) Sys() any { return &fi.attr }
+
+type dirEntry struct {
+	fs   *FS
+	dir  string
+	name string
+	typ  uint32
+}
+
+// Name returns the base name of the entry.
+func (d *dirEntry) Name() string { return d.name }
+
+// IsDir reports whether the entry describes a directory.
+func (d *dirEntry) IsDir() bool { return d.Type().IsDir() }
+
+// Type returns the type bits of the entry.
+func (d *dirEntry) Type() fs.FileMode {
+	attr := &Attr{Mode: d.typ << 12}
+	return attr.FileMode().Type()
+}
+
+// Info returns the [fs.FileInfo] of the entry.
+func (d *dirEntry) Info() (fs.FileInfo, error) {
+	return d.fs.Stat(path.Join(d.dir, d.name))
+}
+
+func (f *File) check(op string) error {
+	if f.closed {
+		return &fs.PathError{Op: op, Path: f.name, Err: fs.ErrClosed}
+	}
+
+	return nil
+}
+
+// Stat returns the [fs.FileInfo] describing the file.
+func (f *File) Stat() (fs.FileInfo, error) {
+	if err := f.check("stat"); err != nil {
+		return nil, err
+	}
+
+	f.fs.Lock()
+	defer f.fs.Unlock()
+
+	attr, err := f.fs.getattr(f.node, f.fh, !f.dir)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: f.name, Err: err}
+	}
+
+	f.attr = *attr
+
+	return &fileInfo{name: path.Base(f.name), attr: f.attr}, nil
+}
+
+// ReadAt implements the [io.ReaderAt] interface.
+func (f *File) ReadAt(b []byte, off int64) (n int, err error) {
+	if err = f.check("read"); err != nil {
+		return
+	}
+
+	if f.dir {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: Errno(EISDIR)}
+	}
+
+	if off < 0 {
+		return 0, &fs.PathError{Op: "read", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.fs.Lock()
+	defer f.fs.Unlock()
+
+	for n < len(b) {
+		size := min(len(b)-n, f.fs.maxRead)
+
+		in := &readIn{
+			Fh:     f.fh,
+			Offset: uint64(off) + uint64(n),
+			Size:   uint32(size),
+		}
+
+		buf, err := binary.Append(nil, binary.LittleEndian, in)
+
+		if err != nil {
+			return n, err
+		}
+
+		reply, err := f.fs.request(FUSE_READ, f.node, [][]byte{buf}, size)
+
+		if err != nil {
+			return n, &fs.PathError{Op: "read", Path: f.name, Err: err}
+		}
+
+		if len(reply) == 0 {
+			return n, io.EOF
+		}
+
+		n += copy(b[n:], reply)
+	}
+
+	return
+}
+
+// Read implements the [io.Reader] interface.
+func (f *File) Read(b []byte) (n int, err error) {
+	n, err = f.ReadAt(b, f.offset)
+	f.offset += int64(n)
+
+	if n > 0 && err == io.EOF {
+		err = nil
+	}
+
+	return
+}
+
+// WriteAt implements the [io.WriterAt] interface.
+func (f *File) WriteAt(b []byte, off int64) (n int, err error) {
+	if err = f.check("write"); err != nil {
+		return
+	}
+
+	if f.flag&(O_WRONLY|O_RDWR) == 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrPermission}
+	}
+
+	if off < 0 {
+		return 0, &fs.PathError{Op: "write", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.fs.Lock()
+	defer f.fs.Unlock()
+
+	for n < len(b) {
+		size := min(len(b)-n, f.fs.maxWrite)
+
+		in := &writeIn{
+			Fh:     f.fh,
+			Offset: uint64(off) + uint64(n),
+			Size:   uint32(size),
+		}
+
+		out := &writeOut{}
+
+		if err = f.fs.call(FUSE_WRITE, f.node, in, b[n:n+size], out); err != nil {
+			return n, &fs.PathError{Op: "write", Path: f.name, Err: err}
+		}
+
+		if out.Size == 0 {
+			return n, io.ErrShortWrite
+		}
+
+		n += int(out.Size)
+	}
+
+	return
+}
+
+// Write implements the [io.Writer] interface.
+func (f *File) Write(b []byte) (n int, err error) {
+	if f.flag&O_APPEND != 0 {
+		if _, err = f.Seek(0, io.SeekEnd); err != nil {
+			return
+		}
+	}
+
+	n, err = f.WriteAt(b, f.offset)
+	f.offset += int64(n)
+
+	return
+}
+
+// Seek implements the [io.Seeker] interface.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	if err := f.check("seek"); err != nil {
+		return 0, err
+	}
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		fi, err := f.Stat()
+
+		if err != nil {
+			return 0, err
+		}
+
+		offset += fi.Size()
+	default:
+		offset = -1
+	}
+
+	if offset < 0 {
+		return 0, &fs.PathError{Op: "seek", Path: f.name, Err: fs.ErrInvalid}
+	}
+
+	f.offset = offset
+
+	return offset, nil
+}
+
+func (f *File) readDir() (entries []fs.DirEntry, err error) {
+	in := &readIn{
+		Fh:     f.fh,
+		Offset: f.dirOffset,
+		Size:   segmentSize,
+	}
+
+	buf, err := binary.Append(nil, binary.LittleEndian, in)
+
+	if err != nil {
+		return
+	}
+
+	reply, err := f.fs.request(FUSE_READDIR, f.node, [][]byte{buf}, segmentSize)
+
+	if err != nil {
+		return
+	}
+
+	if len(reply) == 0 {
+		f.dirEOF = true
+		return
+	}
+
+	for len(reply) >= direntSize {
+		d := &dirent{}
+
+		if _, err = binary.Decode(reply, binary.LittleEndian, d); err != nil {
+			return
+		}
+
+		end := direntSize + int(d.NameLen)
+
+		if end > len(reply) {
+			return nil, errUnexpectedReply
+		}
+
+		name := reply[direntSize:end]
+		f.dirOffset = d.Off
+
+		if !bytes.Equal(name, []byte(".")) && !bytes.Equal(name, []byte("..")) {
+			entries = append(entries, &dirEntry{
+				fs:   f.fs,
+				dir:  f.name,
+				name: string(name),
+				typ:  d.Type,
+			})
+		}
+
+		// entries are 8 bytes aligned
+		reply = reply[min(len(reply), (end+7)&^7):]
+	}
+
+	return
+}
+
+// ReadDir reads the contents of the directory, it implements the
+// [fs.ReadDirFile] interface.
+func (f *File) ReadDir(n int) (entries []fs.DirEntry, err error) {
+	if err = f.check("readdir"); err != nil {
+		return
+	}
+
+	if !f.dir {
+		return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: Errno(ENOTDIR)}
+	}
+
+	f.fs.Lock()
+	defer f.fs.Unlock()
+
+	for !f.dirEOF && (n <= 0 || len(f.pending) < n) {
+		e, err := f.readDir()
+
+		if err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: f.name, Err: err}
+		}
+
+		f.pending = append(f.pending, e...)
+	}
+
+	if n > 0 && len(f.pending) == 0 {
+		return nil, io.EOF
+	}
+
+	if n <= 0 || n > len(f.pending) {
+		n = len(f.pending)
+	}
+
+	entries = f.pending[:n]
+	f.pending = f.pending[n:]
+
+	return
+}
+
+// Close releases the file.
+func (f *File) Close() (err error) {
+	if err = f.check("close"); err != nil {
+		return
+	}
+
+	f.fs.Lock()
+	defer f.fs.Unlock()
+
+	f.closed = true
+
+	err = f.fs.release(f.node, f.fh, f.dir)
+	f.fs.forget(f.node, 1)
+
+	return
+}
@@ -0,0 +1,255 @@
+// VirtIO File System Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package virtiofs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// walk resolves a path to its node, the returned entry must be released with
+// hw.forget(). The root node is returned with a nil entry.
+func (hw *FS) walk(name string) (node uint64, entry *entryOut, err error) {
+	node = FUSE_ROOT_ID
+
+	if name == "." {
+		return
+	}
+
+	for elem := range strings.SplitSeq(name, "/") {
+		entry, err = hw.lookup(node, elem)
+		hw.forget(node, 1)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		node = entry.NodeID
+	}
+
+	return
+}
+
+func (hw *FS) stat(name string) (fi *fileInfo, err error) {
+	node, entry, err := hw.walk(name)
+
+	if err != nil {
+		return
+	}
+
+	defer hw.forget(node, 1)
+
+	fi = &fileInfo{
+		name: path.Base(name),
+	}
+
+	if entry != nil {
+		fi.attr = entry.Attr
+		return
+	}
+
+	attr, err := hw.getattr(node, 0, false)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fi.attr = *attr
+
+	return
+}
+
+// Stat returns a [fs.FileInfo] describing the named file, it implements the
+// [fs.StatFS] interface.
+func (hw *FS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrInvalid}
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	fi, err := hw.stat(name)
+
+	if err != nil {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: err}
+	}
+
+	return fi, nil
+}
+
+// Open opens the named file for reading, it implements the [fs.FS] interface.
+func (hw *FS) Open(name string) (fs.File, error) {
+	return hw.OpenFile(name, O_RDONLY, 0)
+}
+
+// OpenFile opens the named file with the specified flag (O_RDONLY etc.), if
+// the file does not exist and the O_CREAT flag is passed it is created with
+// mode perm.
+func (hw *FS) OpenFile(name string, flag int, perm fs.FileMode) (f *File, err error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+
+	hw.Lock()
+	defer hw.Unlock()
+
+	if f, err = hw.open(name, flag, perm); err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+
+	return
+}
+
+func (hw *FS) open(name string, flag int, perm fs.FileMode) (f *File, err error) {
+	f = &File{
+		fs:   hw,
+		name: name,
+	}
+
+	node, entry, err := hw.walk(name)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && flag&O_CREAT != 0:
+		return hw.create(name, flag, perm)
+	case err != nil:
+		return nil, err
+	case flag&(O_CREAT|O_EXCL) == O_CREAT|O_EXCL:
+		hw.forget(node, 1)
+		return nil, fs.ErrExist
+	}
+
+	f.node = node
+
+	if entry != nil {
+		f.attr = entry.Attr
+	} else if attr, err := hw.getattr(node, 0, false); err != nil {
+		return nil, err
+	} else {
+		f.attr = *attr
+	}
+
+	f.dir = f.attr.Mode&S_IFMT == S_IFDIR
+	opcode := uint32(FUSE_OPEN)
+
+	if f.dir {
+		if flag&(O_WRONLY|O_RDWR) != 0 {
+			hw.forget(node, 1)
+			return nil, Errno(EISDIR)
+		}
+
+		opcode = FUSE_OPENDIR
+	}
+
+	in := &openIn{
+		Flags: uint32(flag &^ (O_CREAT | O_EXCL)),
+	}
+
+	out := &openOut{}
+
+	if err = hw.call(opcode, node, in, nil, out); err != nil {
+		hw.forget(node, 1)
+		return nil, err
+	}
+
+	f.fh = out.Fh
+	f.flag = flag
+
+	return
+}
+
+func (hw *FS) create(name string, flag int, perm fs.FileMode) (f *File, err error) {
+	dir, base := path.Split(name)
+	dir = path.Clean(dir)
+
+	parent, _, err := hw.walk(dir)
+
+	if err != nil {
+		return
+	}
+
+	defer hw.forget(parent, 1)
+
+	in := &createIn{
+		Flags: uint32(flag &^ O_EXCL),
+		Mode:  S_IFREG | uint32(perm.Perm()),
+	}
+
+	out := &createOut{}
+
+	if err = hw.call(FUSE_CREATE, parent, in, cstring(base), out); err != nil {
+		return
+	}
+
+	f = &File{
+		fs:   hw,
+		name: name,
+		node: out.Entry.NodeID,
+		fh:   out.Open.Fh,
+		attr: out.Entry.Attr,
+		flag: flag,
+	}
+
+	return
+}
+
+// Create creates or truncates the named file, it is opened for reading and
+// writing.
+func (hw *FS) Create(name string) (*File, error) {
+	return hw.OpenFile(name, O_RDWR|O_CREAT|O_TRUNC, 0666)
+}
+
+// ReadDir reads the named directory, it implements the [fs.ReadDirFS]
+// interface.
+func (hw *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	f, err := hw.OpenFile(name, O_RDONLY, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	return f.ReadDir(-1)
+}
+
+// ReadFile reads the named file and returns its contents, it implements the
+// [fs.ReadFileFS] interface.
+func (hw *FS) ReadFile(name string) (buf []byte, err error) {
+	f, err := hw.OpenFile(name, O_RDONLY, 0)
+
+	if err != nil {
+		return
+	}
+
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
+
+// WriteFile writes data to the named file, creating it with mode perm if
+// necessary.
+func (hw *FS) WriteFile(name string, data []byte, perm fs.FileMode) (err error) {
+	f, err := hw.OpenFile(name, O_WRONLY|O_CREAT|O_TRUNC, perm)
+
+	if err != nil {
+		return
+	}
+
+	_, err = f.Write(data)
+
+	if err1 := f.Close(); err == nil {
+		err = err1
+	}
+
+	return
+}
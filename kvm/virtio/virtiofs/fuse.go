@@ -0,0 +1,306 @@
+// VirtIO File System Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package virtiofs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"time"
+)
+
+// FUSE protocol version
+const (
+	KernelVersion      = 7
+	KernelMinorVersion = 31
+)
+
+// FUSE operations
+const (
+	FUSE_LOOKUP     = 1
+	FUSE_FORGET     = 2
+	FUSE_GETATTR    = 3
+	FUSE_OPEN       = 14
+	FUSE_READ       = 15
+	FUSE_WRITE      = 16
+	FUSE_RELEASE    = 18
+	FUSE_FLUSH      = 25
+	FUSE_INIT       = 26
+	FUSE_OPENDIR    = 27
+	FUSE_READDIR    = 28
+	FUSE_RELEASEDIR = 29
+	FUSE_CREATE     = 35
+	FUSE_DESTROY    = 38
+)
+
+// FUSE_ROOT_ID represents the root directory node identifier.
+const FUSE_ROOT_ID = 1
+
+// FUSE_GETATTR_FH requests attributes through a file handle.
+const FUSE_GETATTR_FH = 1 << 0
+
+// Open flags (Linux open(2) values)
+const (
+	O_RDONLY = 0x0
+	O_WRONLY = 0x1
+	O_RDWR   = 0x2
+	O_CREAT  = 0x40
+	O_EXCL   = 0x80
+	O_TRUNC  = 0x200
+	O_APPEND = 0x400
+)
+
+// File mode bits (Linux stat(2) values)
+const (
+	S_IFMT   = 0170000
+	S_IFSOCK = 0140000
+	S_IFLNK  = 0120000
+	S_IFREG  = 0100000
+	S_IFBLK  = 0060000
+	S_IFDIR  = 0040000
+	S_IFCHR  = 0020000
+	S_IFIFO  = 0010000
+	S_ISUID  = 0004000
+	S_ISGID  = 0002000
+	S_ISVTX  = 0001000
+)
+
+// Linux error numbers
+const (
+	EPERM   = 1
+	ENOENT  = 2
+	EIO     = 5
+	EACCES  = 13
+	EEXIST  = 17
+	ENOTDIR = 20
+	EISDIR  = 21
+	EINVAL  = 22
+	ENOSYS  = 38
+)
+
+const (
+	inHeaderSize  = 40
+	outHeaderSize = 16
+	direntSize    = 24
+)
+
+// Errno represents a FUSE reply error number.
+type Errno int32
+
+// Error implements the error interface.
+func (e Errno) Error() string {
+	return fmt.Sprintf("errno %d", int32(e))
+}
+
+// Is allows [errors.Is] matching against [fs.ErrNotExist], [fs.ErrExist],
+// [fs.ErrPermission] and [fs.ErrInvalid].
+func (e Errno) Is(target error) bool {
+	switch target {
+	case fs.ErrNotExist:
+		return e == ENOENT
+	case fs.ErrExist:
+		return e == EEXIST
+	case fs.ErrPermission:
+		return e == EPERM || e == EACCES
+	case fs.ErrInvalid:
+		return e == EINVAL
+	}
+
+	return false
+}
+
+var errUnexpectedReply = errors.New("unexpected reply")
+
+type inHeader struct {
+	Len         uint32
+	Opcode      uint32
+	Unique      uint64
+	NodeID      uint64
+	UID         uint32
+	GID         uint32
+	PID         uint32
+	TotalExtLen uint16
+	_           uint16
+}
+
+type outHeader struct {
+	Len    uint32
+	Error  int32
+	Unique uint64
+}
+
+type initIn struct {
+	Major        uint32
+	Minor        uint32
+	MaxReadahead uint32
+	Flags        uint32
+}
+
+type initOut struct {
+	Major               uint32
+	Minor               uint32
+	MaxReadahead        uint32
+	Flags               uint32
+	MaxBackground       uint16
+	CongestionThreshold uint16
+	MaxWrite            uint32
+	TimeGran            uint32
+	MaxPages            uint16
+	MapAlignment        uint16
+	Flags2              uint32
+	_                   [7]uint32
+}
+
+// Attr represents FUSE file attributes.
+type Attr struct {
+	Ino       uint64
+	Size      uint64
+	Blocks    uint64
+	Atime     uint64
+	Mtime     uint64
+	Ctime     uint64
+	Atimensec uint32
+	Mtimensec uint32
+	Ctimensec uint32
+	Mode      uint32
+	Nlink     uint32
+	UID       uint32
+	GID       uint32
+	Rdev      uint32
+	Blksize   uint32
+	Flags     uint32
+}
+
+// FileMode converts the attribute mode to [fs.FileMode] format.
+func (a *Attr) FileMode() (mode fs.FileMode) {
+	mode = fs.FileMode(a.Mode & 0777)
+
+	switch a.Mode & S_IFMT {
+	case S_IFDIR:
+		mode |= fs.ModeDir
+	case S_IFLNK:
+		mode |= fs.ModeSymlink
+	case S_IFIFO:
+		mode |= fs.ModeNamedPipe
+	case S_IFSOCK:
+		mode |= fs.ModeSocket
+	case S_IFCHR:
+		mode |= fs.ModeDevice | fs.ModeCharDevice
+	case S_IFBLK:
+		mode |= fs.ModeDevice
+	}
+
+	if a.Mode&S_ISUID != 0 {
+		mode |= fs.ModeSetuid
+	}
+
+	if a.Mode&S_ISGID != 0 {
+		mode |= fs.ModeSetgid
+	}
+
+	if a.Mode&S_ISVTX != 0 {
+		mode |= fs.ModeSticky
+	}
+
+	return
+}
+
+// ModTime returns the attribute modification time.
+func (a *Attr) ModTime() time.Time {
+	return time.Unix(int64(a.Mtime), int64(a.Mtimensec))
+}
+
+type entryOut struct {
+	NodeID         uint64
+	Generation     uint64
+	EntryValid     uint64
+	AttrValid      uint64
+	EntryValidNsec uint32
+	AttrValidNsec  uint32
+	Attr           Attr
+}
+
+type forgetIn struct {
+	Nlookup uint64
+}
+
+type getattrIn struct {
+	GetattrFlags uint32
+	_            uint32
+	Fh           uint64
+}
+
+type attrOut struct {
+	AttrValid     uint64
+	AttrValidNsec uint32
+	_             uint32
+	Attr          Attr
+}
+
+type openIn struct {
+	Flags     uint32
+	OpenFlags uint32
+}
+
+type openOut struct {
+	Fh        uint64
+	OpenFlags uint32
+	BackingID uint32
+}
+
+type createIn struct {
+	Flags     uint32
+	Mode      uint32
+	Umask     uint32
+	OpenFlags uint32
+}
+
+type createOut struct {
+	Entry entryOut
+	Open  openOut
+}
+
+type readIn struct {
+	Fh        uint64
+	Offset    uint64
+	Size      uint32
+	ReadFlags uint32
+	LockOwner uint64
+	Flags     uint32
+	_         uint32
+}
+
+type writeIn struct {
+	Fh         uint64
+	Offset     uint64
+	Size       uint32
+	WriteFlags uint32
+	LockOwner  uint64
+	Flags      uint32
+	_          uint32
+}
+
+type writeOut struct {
+	Size uint32
+	_    uint32
+}
+
+type releaseIn struct {
+	Fh           uint64
+	Flags        uint32
+	ReleaseFlags uint32
+	LockOwner    uint64
+}
+
+type dirent struct {
+	Ino     uint64
+	Off     uint64
+	NameLen uint32
+	Type    uint32
+}
@@ -0,0 +1,384 @@
+// VirtIO File System Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package virtiofs implements a driver for VirtIO file system devices
+// following reference specifications:
+//   - Virtual I/O Device (VIRTIO) - Version 1.2 - 5.11 File System Device
+//   - FUSE kernel protocol - include/uapi/linux/fuse.h
+//
+// The driver acts as a FUSE client over any [virtio.VirtIO] transport (MMIO,
+// PCI), exposing the shared directory as an [fs.FS] with additional support
+// for file creation and writing.
+//
+// This package is only meant to be used with `GOOS=tamago` as
+// supported by the TamaGo framework for bare metal Go, see
+// https://github.com/usbarmory/tamago.
+package virtiofs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/usbarmory/tamago/bits"
+	"github.com/usbarmory/tamago/kvm/virtio"
+)
+
+// Feature bits
+const (
+	Notification = 0
+)
+
+const (
+	hiprioQueue  = 0
+	requestQueue = 1
+
+	defaultQueueSize = 64
+	segmentSize      = 4096
+
+	// maximum data transfer size per request
+	maxTransfer = 64 * 1024
+)
+
+// RequestTimeout is the timeout for device request completion.
+var RequestTimeout = 5 * time.Second
+
+// Config represents a VirtIO file system device configuration layout.
+type Config struct {
+	Tag              [36]byte
+	NumRequestQueues uint32
+	NotifyBufSize    uint32
+}
+
+// FS represents a VirtIO file system device instance.
+type FS struct {
+	sync.Mutex
+
+	// Transport represents the VirtIO transport instance.
+	Transport virtio.VirtIO
+
+	// QueueSize represents the request queue size, it is set to the
+	// device maximum (up to 64) when zero.
+	QueueSize int
+
+	config   Config
+	features uint64
+
+	hiprio   *virtio.VirtualQueue
+	requests *virtio.VirtualQueue
+
+	unique   uint64
+	maxRead  int
+	maxWrite int
+}
+
+// Init initializes a VirtIO file system device instance and its FUSE session.
+func (hw *FS) Init() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.Transport == nil {
+		return errors.New("invalid VirtIO instance")
+	}
+
+	if err = hw.Transport.Init(0); err != nil {
+		return
+	}
+
+	if id := hw.Transport.DeviceID(); id != virtio.FileSystemDevice {
+		return fmt.Errorf("unexpected device ID %d", id)
+	}
+
+	hw.features = hw.Transport.NegotiatedFeatures()
+
+	buf := hw.Transport.Config(binary.Size(hw.config))
+
+	if _, err = binary.Decode(buf, binary.LittleEndian, &hw.config); err != nil {
+		return
+	}
+
+	if hw.config.NumRequestQueues == 0 {
+		return errors.New("request queue unavailable")
+	}
+
+	size := hw.Transport.MaxQueueSize(requestQueue)
+
+	if size == 0 {
+		return errors.New("request queue unavailable")
+	}
+
+	if hw.QueueSize > 0 && hw.QueueSize < size {
+		size = hw.QueueSize
+	} else if size > defaultQueueSize {
+		size = defaultQueueSize
+	}
+
+	// headers and arguments use up to 4 descriptors
+	if hw.maxRead = (size - 4) * segmentSize; hw.maxRead <= 0 {
+		return errors.New("request queue too small")
+	}
+
+	hw.maxRead = min(hw.maxRead, maxTransfer)
+
+	hiprioSize := min(hw.Transport.MaxQueueSize(hiprioQueue), defaultQueueSize)
+
+	if hiprioSize == 0 {
+		return errors.New("high priority queue unavailable")
+	}
+
+	hw.hiprio = &virtio.VirtualQueue{}
+	hw.hiprio.Init(hiprioSize, segmentSize, 0)
+
+	hw.requests = &virtio.VirtualQueue{}
+	hw.requests.Init(size, segmentSize, 0)
+
+	hw.Transport.SetQueueSize(hiprioQueue, hiprioSize)
+	hw.Transport.SetQueue(hiprioQueue, hw.hiprio)
+
+	hw.Transport.SetQueueSize(requestQueue, size)
+	hw.Transport.SetQueue(requestQueue, hw.requests)
+
+	hw.Transport.SetReady()
+
+	return hw.init()
+}
+
+func (hw *FS) init() (err error) {
+	in := &initIn{
+		Major: KernelVersion,
+		Minor: KernelMinorVersion,
+	}
+
+	out := &initOut{}
+
+	if err = hw.call(FUSE_INIT, 0, in, nil, out); err != nil {
+		return
+	}
+
+	if out.Major != KernelVersion {
+		return fmt.Errorf("unsupported FUSE version %d.%d", out.Major, out.Minor)
+	}
+
+	hw.maxWrite = segmentSize
+
+	if out.MaxWrite > 0 {
+		hw.maxWrite = int(out.MaxWrite)
+	}
+
+	hw.maxWrite = min(hw.maxWrite, hw.maxRead)
+
+	return
+}
+
+// Feature returns whether a device type feature bit has been negotiated.
+func (hw *FS) Feature(bit int) bool {
+	return bits.Get64(&hw.features, bit)
+}
+
+// Tag returns the file system name, as configured on the host.
+func (hw *FS) Tag() string {
+	tag := hw.config.Tag[:]
+
+	if i := bytes.IndexByte(tag, 0); i >= 0 {
+		tag = tag[:i]
+	}
+
+	return string(tag)
+}
+
+// Destroy terminates the FUSE session.
+func (hw *FS) Destroy() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	return hw.call(FUSE_DESTROY, 0, nil, nil, nil)
+}
+
+// request submits a FUSE request to the device and waits for its completion,
+// the reply payload (without header) of up to size bytes is returned.
+func (hw *FS) request(opcode uint32, node uint64, args [][]byte, size int) (reply []byte, err error) {
+	var buf []byte
+
+	hw.unique += 1
+
+	hdr := &inHeader{
+		Opcode: opcode,
+		Unique: hw.unique,
+		NodeID: node,
+		Len:    inHeaderSize,
+	}
+
+	for _, arg := range args {
+		hdr.Len += uint32(len(arg))
+	}
+
+	if buf, err = binary.Append(nil, binary.LittleEndian, hdr); err != nil {
+		return
+	}
+
+	out := append([][]byte{buf}, args...)
+	res := make([]byte, outHeaderSize)
+	reply = make([]byte, size)
+
+	head, err := hw.requests.PushChain(out, []int{len(res), size})
+
+	if err != nil {
+		return
+	}
+
+	hw.Transport.QueueNotify(requestQueue)
+
+	var n int
+	var ok bool
+	var h uint16
+
+	start := time.Now()
+
+	for {
+		if h, n, ok = hw.requests.PopChain([][]byte{res, reply}); ok && h == head {
+			break
+		}
+
+		if time.Since(start) >= RequestTimeout {
+			return nil, errors.New("request timeout")
+		}
+
+		runtime.Gosched()
+	}
+
+	reply = reply[:max(0, min(n-outHeaderSize, size))]
+
+	outHdr := &outHeader{}
+
+	if _, err = binary.Decode(res, binary.LittleEndian, outHdr); err != nil {
+		return
+	}
+
+	if outHdr.Unique != hdr.Unique {
+		return nil, errUnexpectedReply
+	}
+
+	if outHdr.Error != 0 {
+		return nil, Errno(-outHdr.Error)
+	}
+
+	return
+}
+
+// call performs a FUSE request with a fixed size argument structure, a name
+// or data argument, and decodes the reply in a fixed size structure.
+func (hw *FS) call(opcode uint32, node uint64, in any, data []byte, out any) (err error) {
+	var args [][]byte
+	var size int
+
+	if in != nil {
+		buf, err := binary.Append(nil, binary.LittleEndian, in)
+
+		if err != nil {
+			return err
+		}
+
+		args = append(args, buf)
+	}
+
+	if data != nil {
+		args = append(args, data)
+	}
+
+	if out != nil {
+		size = binary.Size(out)
+	}
+
+	reply, err := hw.request(opcode, node, args, size)
+
+	if err != nil || out == nil {
+		return
+	}
+
+	if len(reply) < size {
+		// older protocol versions might reply with shorter structures
+		reply = append(reply, make([]byte, size-len(reply))...)
+	}
+
+	_, err = binary.Decode(reply, binary.LittleEndian, out)
+
+	return
+}
+
+// forget releases node lookups on the high priority queue, no reply is
+// expected.
+func (hw *FS) forget(node uint64, n uint64) {
+	if node == FUSE_ROOT_ID || n == 0 {
+		return
+	}
+
+	hw.unique += 1
+
+	hdr := &inHeader{
+		Len:    inHeaderSize + 8,
+		Opcode: FUSE_FORGET,
+		Unique: hw.unique,
+		NodeID: node,
+	}
+
+	buf, _ := binary.Append(nil, binary.LittleEndian, hdr)
+	buf, _ = binary.Append(buf, binary.LittleEndian, &forgetIn{Nlookup: n})
+
+	// reclaim completed requests
+	for {
+		if _, _, ok := hw.hiprio.PopChain(nil); !ok {
+			break
+		}
+	}
+
+	if _, err := hw.hiprio.PushChain([][]byte{buf}, nil); err != nil {
+		return
+	}
+
+	hw.Transport.QueueNotify(hiprioQueue)
+}
+
+func cstring(name string) []byte {
+	return append([]byte(name), 0)
+}
+
+func (hw *FS) lookup(parent uint64, name string) (entry *entryOut, err error) {
+	entry = &entryOut{}
+	err = hw.call(FUSE_LOOKUP, parent, nil, cstring(name), entry)
+	return
+}
+
+func (hw *FS) getattr(node uint64, fh uint64, useFh bool) (attr *Attr, err error) {
+	in := &getattrIn{}
+	out := &attrOut{}
+
+	if useFh {
+		in.GetattrFlags = FUSE_GETATTR_FH
+		in.Fh = fh
+	}
+
+	if err = hw.call(FUSE_GETATTR, node, in, nil, out); err != nil {
+		return
+	}
+
+	return &out.Attr, nil
+}
+
+func (hw *FS) release(node uint64, fh uint64, dir bool) error {
+	opcode := uint32(FUSE_RELEASE)
+
+	if dir {
+		opcode = FUSE_RELEASEDIR
+	}
+
+	return hw.call(opcode, node, &releaseIn{Fh: fh}, nil, nil)
+}
@@ -0,0 +1,437 @@
+// VirtIO Socket Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package vsock
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Connection states
+const (
+	stateConnecting = iota
+	stateEstablished
+	stateClosing
+	stateClosed
+)
+
+// Addr represents a VirtIO socket address.
+type Addr struct {
+	// CID represents the context identifier.
+	CID uint64
+	// Port represents the port number.
+	Port uint32
+}
+
+// Network returns the address network name ("vsock").
+func (a *Addr) Network() string {
+	return "vsock"
+}
+
+// String returns the address string representation.
+func (a *Addr) String() string {
+	return fmt.Sprintf("%d:%d", a.CID, a.Port)
+}
+
+// Conn represents a VirtIO stream socket connection, it implements the
+// [net.Conn] interface.
+type Conn struct {
+	sync.Mutex
+
+	hw *VSock
+
+	local  Addr
+	remote Addr
+
+	state int
+	err   error
+
+	// receive buffer
+	rx bytes.Buffer
+
+	// local credit
+	bufAlloc   uint32
+	fwdCnt     uint32
+	lastFwdCnt uint32
+
+	// peer credit
+	peerBufAlloc    uint32
+	peerFwdCnt      uint32
+	txCnt           uint32
+	creditRequested bool
+
+	// shutdown state
+	peerNoSend  bool
+	peerNoRecv  bool
+	localNoSend bool
+	localClosed bool
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+
+	// closed and replaced on every state change
+	changed chan struct{}
+}
+
+func (hw *VSock) newConn(local uint32, cid uint64, port uint32) *Conn {
+	return &Conn{
+		hw:       hw,
+		local:    Addr{CID: hw.cid, Port: local},
+		remote:   Addr{CID: cid, Port: port},
+		bufAlloc: uint32(hw.BufferSize),
+		changed:  make(chan struct{}),
+	}
+}
+
+func (c *Conn) id() connID {
+	return connID{
+		cid:    c.remote.CID,
+		remote: c.remote.Port,
+		local:  c.local.Port,
+	}
+}
+
+// header must be invoked with the connection lock held.
+func (c *Conn) header(op uint16, flags uint32) *header {
+	c.lastFwdCnt = c.fwdCnt
+
+	return &header{
+		DstCID:   c.remote.CID,
+		SrcPort:  c.local.Port,
+		DstPort:  c.remote.Port,
+		Op:       op,
+		Flags:    flags,
+		BufAlloc: c.bufAlloc,
+		FwdCnt:   c.fwdCnt,
+	}
+}
+
+// signal must be invoked with the connection lock held.
+func (c *Conn) signal() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// close must be invoked with the connection lock held.
+func (c *Conn) close(err error) {
+	if c.state == stateClosed {
+		return
+	}
+
+	if c.err == nil {
+		c.err = err
+	}
+
+	c.state = stateClosed
+	c.hw.remove(c)
+	c.signal()
+}
+
+func wait(ch chan struct{}, deadline time.Time) error {
+	if deadline.IsZero() {
+		<-ch
+		return nil
+	}
+
+	d := time.Until(deadline)
+
+	if d <= 0 {
+		return os.ErrDeadlineExceeded
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ch:
+		return nil
+	case <-t.C:
+		return os.ErrDeadlineExceeded
+	}
+}
+
+func (c *Conn) handle(hdr *header, data []byte) {
+	c.Lock()
+	reply := c.receive(hdr, data)
+	c.signal()
+	c.Unlock()
+
+	// replies are sent without holding the connection lock as the
+	// transmit queue might be unavailable until [SendTimeout]
+	if reply != nil {
+		c.hw.send(reply, nil)
+	}
+}
+
+// receive must be invoked with the connection lock held, it returns the
+// packet reply header, if any.
+func (c *Conn) receive(hdr *header, data []byte) (reply *header) {
+	c.peerBufAlloc = hdr.BufAlloc
+	c.peerFwdCnt = hdr.FwdCnt
+	c.creditRequested = false
+
+	switch hdr.Op {
+	case OpResponse:
+		if c.state == stateConnecting {
+			c.state = stateEstablished
+		}
+	case OpRW:
+		if c.state != stateEstablished || c.peerNoSend {
+			break
+		}
+
+		// the peer must not exceed the advertised credit
+		if uint64(c.rx.Len())+uint64(len(data)) > uint64(c.bufAlloc) {
+			reply = c.header(OpReset, 0)
+			c.close(errors.New("receive buffer overflow"))
+			break
+		}
+
+		c.rx.Write(data)
+	case OpCreditRequest:
+		reply = c.header(OpCreditUpdate, 0)
+	case OpShutdown:
+		if hdr.Flags&ShutdownReceive != 0 {
+			c.peerNoRecv = true
+		}
+
+		if hdr.Flags&ShutdownSend != 0 {
+			c.peerNoSend = true
+		}
+
+		// acknowledge clean disconnect
+		if c.peerNoRecv && c.peerNoSend {
+			reply = c.header(OpReset, 0)
+			c.close(nil)
+		}
+	case OpReset:
+		switch {
+		case c.state == stateConnecting:
+			c.close(errors.New("connection refused"))
+		case c.localClosed || c.peerNoSend:
+			c.close(nil)
+		default:
+			c.close(errors.New("connection reset by peer"))
+		}
+	case OpRequest:
+		reply = c.header(OpReset, 0)
+		c.close(errors.New("connection reset by peer"))
+	}
+
+	return
+}
+
+// Read implements the [net.Conn] interface.
+func (c *Conn) Read(b []byte) (n int, err error) {
+	if len(b) == 0 {
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	for {
+		if c.localClosed {
+			return 0, net.ErrClosed
+		}
+
+		if c.rx.Len() > 0 {
+			n, _ = c.rx.Read(b)
+			c.fwdCnt += uint32(n)
+
+			// update peer credit once a quarter of the buffer is freed
+			if c.state == stateEstablished && c.fwdCnt-c.lastFwdCnt >= c.bufAlloc/4 {
+				c.hw.send(c.header(OpCreditUpdate, 0), nil)
+			}
+
+			return
+		}
+
+		if c.err != nil {
+			return 0, c.err
+		}
+
+		if c.peerNoSend || c.state == stateClosed {
+			return 0, io.EOF
+		}
+
+		ch := c.changed
+		deadline := c.readDeadline
+
+		c.Unlock()
+		err = wait(ch, deadline)
+		c.Lock()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Write implements the [net.Conn] interface.
+func (c *Conn) Write(b []byte) (n int, err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	for n < len(b) {
+		switch {
+		case c.localClosed:
+			return n, net.ErrClosed
+		case c.err != nil:
+			return n, c.err
+		case c.localNoSend || c.peerNoRecv || c.state != stateEstablished:
+			return n, errors.New("broken pipe")
+		}
+
+		if inflight := c.txCnt - c.peerFwdCnt; c.peerBufAlloc > inflight {
+			credit := c.peerBufAlloc - inflight
+			size := min(len(b)-n, int(credit), maxPacketSize)
+
+			if err = c.hw.send(c.header(OpRW, 0), b[n:n+size]); err != nil {
+				return
+			}
+
+			c.txCnt += uint32(size)
+			n += size
+
+			continue
+		}
+
+		if !c.creditRequested {
+			c.creditRequested = true
+			c.hw.send(c.header(OpCreditRequest, 0), nil)
+		}
+
+		ch := c.changed
+		deadline := c.writeDeadline
+
+		c.Unlock()
+		err = wait(ch, deadline)
+		c.Lock()
+
+		if err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// CloseWrite shuts down the writing side of the connection.
+func (c *Conn) CloseWrite() (err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.localClosed {
+		return net.ErrClosed
+	}
+
+	if c.localNoSend || c.state != stateEstablished {
+		return
+	}
+
+	c.localNoSend = true
+
+	return c.hw.send(c.header(OpShutdown, ShutdownSend), nil)
+}
+
+// Close implements the [net.Conn] interface, the connection is shut down and
+// the peer reset acknowledgement is awaited until [CloseTimeout].
+func (c *Conn) Close() (err error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.localClosed {
+		return net.ErrClosed
+	}
+
+	c.localClosed = true
+	c.signal()
+
+	if c.state != stateEstablished {
+		c.close(nil)
+		return
+	}
+
+	c.state = stateClosing
+
+	if err = c.hw.send(c.header(OpShutdown, ShutdownReceive|ShutdownSend), nil); err != nil {
+		c.close(nil)
+		return
+	}
+
+	deadline := time.Now().Add(CloseTimeout)
+
+	for c.state != stateClosed {
+		ch := c.changed
+
+		c.Unlock()
+		err = wait(ch, deadline)
+		c.Lock()
+
+		if err != nil {
+			// force termination
+			c.hw.send(c.header(OpReset, 0), nil)
+			c.close(nil)
+			return nil
+		}
+	}
+
+	return
+}
+
+// LocalAddr implements the [net.Conn] interface.
+func (c *Conn) LocalAddr() net.Addr {
+	return &c.local
+}
+
+// RemoteAddr implements the [net.Conn] interface.
+func (c *Conn) RemoteAddr() net.Addr {
+	return &c.remote
+}
+
+// SetDeadline implements the [net.Conn] interface.
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.readDeadline = t
+	c.writeDeadline = t
+	c.signal()
+
+	return nil
+}
+
+// SetReadDeadline implements the [net.Conn] interface.
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.readDeadline = t
+	c.signal()
+
+	return nil
+}
+
+// SetWriteDeadline implements the [net.Conn] interface.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.writeDeadline = t
+	c.signal()
+
+	return nil
+}
@@ -0,0 +1,109 @@
+// VirtIO Socket Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package vsock
+
+import (
+	"net"
+	"sync"
+)
+
+// maximum number of pending connections
+const backlog = 16
+
+// Listener represents a VirtIO stream socket listener, it implements the
+// [net.Listener] interface.
+type Listener struct {
+	sync.Mutex
+
+	hw   *VSock
+	port uint32
+
+	conns  chan *Conn
+	closed chan struct{}
+	done   bool
+}
+
+func (l *Listener) handle(hdr *header) {
+	hw := l.hw
+
+	c := hw.newConn(hdr.DstPort, hdr.SrcCID, hdr.SrcPort)
+	c.state = stateEstablished
+	c.peerBufAlloc = hdr.BufAlloc
+	c.peerFwdCnt = hdr.FwdCnt
+
+	l.Lock()
+	defer l.Unlock()
+
+	// reject on close or backlog exceeded
+	if l.done || len(l.conns) == cap(l.conns) {
+		hw.reset(hdr)
+		return
+	}
+
+	hw.add(c)
+
+	c.Lock()
+	err := hw.send(c.header(OpResponse, 0), nil)
+	c.Unlock()
+
+	if err != nil {
+		hw.remove(c)
+		return
+	}
+
+	l.conns <- c
+}
+
+// Accept implements the [net.Listener] interface.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements the [net.Listener] interface, pending connections are
+// reset.
+func (l *Listener) Close() error {
+	l.Lock()
+	defer l.Unlock()
+
+	if l.done {
+		return net.ErrClosed
+	}
+
+	l.done = true
+	close(l.closed)
+
+	l.hw.Lock()
+	delete(l.hw.listeners, l.port)
+	l.hw.Unlock()
+
+	for {
+		select {
+		case c := <-l.conns:
+			c.Lock()
+			l.hw.send(c.header(OpReset, 0), nil)
+			c.close(nil)
+			c.Unlock()
+		default:
+			return nil
+		}
+	}
+}
+
+// Addr implements the [net.Listener] interface.
+func (l *Listener) Addr() net.Addr {
+	return &Addr{
+		CID:  l.hw.CID(),
+		Port: l.port,
+	}
+}
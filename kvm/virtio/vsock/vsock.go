@@ -0,0 +1,528 @@
+// VirtIO Socket Device driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package vsock implements a driver for VirtIO socket devices following
+// reference specifications:
+//   - Virtual I/O Device (VIRTIO) - Version 1.2 - 5.10 Socket Device
+//
+// The driver supports stream sockets, exposed through the [net.Conn] and
+// [net.Listener] interfaces, for host/guest communication over any
+// [virtio.VirtIO] transport (MMIO, PCI, LegacyPCI).
+//
+// This package is only meant to be used with `GOOS=tamago` as
+// supported by the TamaGo framework for bare metal Go, see
+// https://github.com/usbarmory/tamago.
+package vsock
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/usbarmory/tamago/kvm/virtio"
+)
+
+// Feature bits
+const (
+	Stream    = 0
+	SeqPacket = 1
+)
+
+// DriverFeatures represents the device type features supported by the driver.
+const DriverFeatures = 1 << Stream
+
+// Well-known context identifiers
+const (
+	HypervisorCID = 0
+	LocalCID      = 1
+	HostCID       = 2
+)
+
+// Socket types
+const (
+	TypeStream    = 1
+	TypeSeqPacket = 2
+)
+
+// Operations
+const (
+	OpInvalid       = 0
+	OpRequest       = 1
+	OpResponse      = 2
+	OpReset         = 3
+	OpShutdown      = 4
+	OpRW            = 5
+	OpCreditUpdate  = 6
+	OpCreditRequest = 7
+)
+
+// Shutdown flags
+const (
+	ShutdownReceive = 1 << 0
+	ShutdownSend    = 1 << 1
+)
+
+// Event IDs
+const (
+	EventTransportReset = 0
+)
+
+const (
+	rxQueue    = 0
+	txQueue    = 1
+	eventQueue = 2
+
+	defaultQueueSize  = 128
+	defaultBufferSize = 256 * 1024
+	eventQueueSize    = 8
+	eventSize         = 4
+
+	headerSize    = 44
+	maxPacketSize = 4096
+	rxBufferSize  = headerSize + maxPacketSize
+
+	// first ephemeral port for outgoing connections
+	ephemeralPort = 1024
+)
+
+// Timeouts
+var (
+	// ConnectTimeout is the timeout for outgoing connection requests.
+	ConnectTimeout = 5 * time.Second
+	// CloseTimeout is the timeout for clean connection termination.
+	CloseTimeout = 2 * time.Second
+	// SendTimeout is the timeout for transmit queue availability.
+	SendTimeout = 1 * time.Second
+	// PollInterval is the device polling interval, when idle, for
+	// [VSock.Start].
+	PollInterval = 1 * time.Millisecond
+)
+
+type header struct {
+	SrcCID   uint64
+	DstCID   uint64
+	SrcPort  uint32
+	DstPort  uint32
+	Len      uint32
+	Type     uint16
+	Op       uint16
+	Flags    uint32
+	BufAlloc uint32
+	FwdCnt   uint32
+}
+
+type connID struct {
+	cid    uint64
+	remote uint32
+	local  uint32
+}
+
+// VSock represents a VirtIO socket device instance.
+type VSock struct {
+	sync.Mutex
+
+	// Transport represents the VirtIO transport instance.
+	Transport virtio.VirtIO
+
+	// QueueSize represents the receive/transmit queue size, it is limited
+	// to the device maximum and defaults to 128.
+	QueueSize int
+
+	// BufferSize represents the per connection receive buffer size
+	// advertised for credit-based flow control, it defaults to 256KB.
+	// Connections are reset when the peer exceeds it.
+	BufferSize int
+
+	cid uint64
+
+	rx    *virtio.VirtualQueue
+	tx    *virtio.VirtualQueue
+	event *virtio.VirtualQueue
+
+	txLock sync.Mutex
+	rxLock sync.Mutex
+
+	// receive scratch buffers
+	rxBuf []byte
+	evBuf []byte
+
+	conns     map[connID]*Conn
+	listeners map[uint32]*Listener
+	nextPort  uint32
+}
+
+// Init initializes a VirtIO socket device instance.
+func (hw *VSock) Init() (err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.Transport == nil {
+		return errors.New("invalid VirtIO instance")
+	}
+
+	if err = hw.Transport.Init(DriverFeatures); err != nil {
+		return
+	}
+
+	if id := hw.Transport.DeviceID(); id != virtio.SocketDevice {
+		return fmt.Errorf("unexpected device ID %d", id)
+	}
+
+	if hw.QueueSize == 0 {
+		hw.QueueSize = defaultQueueSize
+	}
+
+	if hw.BufferSize == 0 {
+		hw.BufferSize = defaultBufferSize
+	}
+
+	hw.readConfig()
+
+	hw.conns = make(map[connID]*Conn)
+	hw.listeners = make(map[uint32]*Listener)
+	hw.nextPort = ephemeralPort
+
+	hw.rx = &virtio.VirtualQueue{}
+	hw.tx = &virtio.VirtualQueue{}
+	hw.event = &virtio.VirtualQueue{}
+
+	if err = hw.initQueue(hw.rx, rxQueue, hw.QueueSize, rxBufferSize, virtio.Write); err != nil {
+		return
+	}
+
+	if err = hw.initQueue(hw.tx, txQueue, hw.QueueSize, rxBufferSize, 0); err != nil {
+		return
+	}
+
+	if err = hw.initQueue(hw.event, eventQueue, eventQueueSize, eventSize, virtio.Write); err != nil {
+		return
+	}
+
+	hw.rxBuf = make([]byte, rxBufferSize)
+	hw.evBuf = make([]byte, eventSize)
+
+	hw.Transport.SetReady()
+
+	// notify receive buffers availability
+	hw.Transport.QueueNotify(rxQueue)
+	hw.Transport.QueueNotify(eventQueue)
+
+	return
+}
+
+func (hw *VSock) initQueue(q *virtio.VirtualQueue, index int, size int, length int, flags uint16) (err error) {
+	n := hw.Transport.MaxQueueSize(index)
+
+	if n == 0 {
+		return fmt.Errorf("queue %d unavailable", index)
+	}
+
+	n = min(n, size)
+
+	q.Init(n, length, flags)
+
+	hw.Transport.SetQueueSize(index, n)
+	hw.Transport.SetQueue(index, q)
+
+	return
+}
+
+func (hw *VSock) readConfig() {
+	buf := hw.Transport.Config(8)
+	hw.cid = binary.LittleEndian.Uint64(buf)
+}
+
+// CID returns the guest context identifier.
+func (hw *VSock) CID() uint64 {
+	hw.Lock()
+	defer hw.Unlock()
+
+	return hw.cid
+}
+
+func (hw *VSock) send(hdr *header, data []byte) (err error) {
+	hdr.SrcCID = hw.cid
+	hdr.Type = TypeStream
+	hdr.Len = uint32(len(data))
+
+	buf, err := binary.Append(nil, binary.LittleEndian, hdr)
+
+	if err != nil {
+		return
+	}
+
+	hw.txLock.Lock()
+	defer hw.txLock.Unlock()
+
+	start := time.Now()
+
+	for {
+		// reclaim completed transmissions
+		for {
+			if _, _, ok := hw.tx.PopChain(nil); !ok {
+				break
+			}
+		}
+
+		if _, err = hw.tx.PushChain([][]byte{buf, data}, nil); err == nil {
+			break
+		}
+
+		if time.Since(start) >= SendTimeout {
+			return
+		}
+
+		hw.Transport.QueueNotify(txQueue)
+		time.Sleep(PollInterval)
+	}
+
+	hw.Transport.QueueNotify(txQueue)
+
+	return
+}
+
+// reset replies to an unexpected packet with a connection reset.
+func (hw *VSock) reset(hdr *header) error {
+	return hw.send(&header{
+		DstCID:  hdr.SrcCID,
+		SrcPort: hdr.DstPort,
+		DstPort: hdr.SrcPort,
+		Op:      OpReset,
+	}, nil)
+}
+
+func (hw *VSock) handle(hdr *header, data []byte) {
+	if hdr.Type != TypeStream {
+		if hdr.Op != OpReset {
+			hw.reset(hdr)
+		}
+
+		return
+	}
+
+	id := connID{
+		cid:    hdr.SrcCID,
+		remote: hdr.SrcPort,
+		local:  hdr.DstPort,
+	}
+
+	hw.Lock()
+	c := hw.conns[id]
+	l := hw.listeners[hdr.DstPort]
+	hw.Unlock()
+
+	switch {
+	case c != nil:
+		c.handle(hdr, data)
+	case hdr.Op == OpRequest && l != nil:
+		l.handle(hdr)
+	case hdr.Op != OpReset:
+		hw.reset(hdr)
+	}
+}
+
+// transportReset handles a device transport reset event, all connections are
+// closed while listeners are preserved.
+func (hw *VSock) transportReset() {
+	hw.Lock()
+	conns := hw.conns
+	hw.conns = make(map[connID]*Conn)
+	hw.readConfig()
+	hw.Unlock()
+
+	for _, c := range conns {
+		c.Lock()
+		c.close(errors.New("transport reset"))
+		c.Unlock()
+	}
+}
+
+// Poll processes all pending received packets and device events, it returns
+// whether any packet or event has been processed.
+//
+// Poll must be invoked periodically, or on device interrupts, unless
+// [VSock.Start] is used.
+func (hw *VSock) Poll() (processed bool) {
+	hw.rxLock.Lock()
+	defer hw.rxLock.Unlock()
+
+	for {
+		n, err := hw.event.Pop(hw.evBuf)
+
+		if err != nil || n < eventSize {
+			break
+		}
+
+		processed = true
+
+		if binary.LittleEndian.Uint32(hw.evBuf) == EventTransportReset {
+			hw.transportReset()
+		}
+	}
+
+	if processed && hw.event.NeedsNotify() {
+		hw.Transport.QueueNotify(eventQueue)
+	}
+
+	for {
+		n, err := hw.rx.Pop(hw.rxBuf)
+
+		if err != nil || n == 0 {
+			break
+		}
+
+		processed = true
+
+		if n < headerSize {
+			continue
+		}
+
+		hdr := &header{}
+
+		if _, err = binary.Decode(hw.rxBuf, binary.LittleEndian, hdr); err != nil {
+			continue
+		}
+
+		data := hw.rxBuf[headerSize:n]
+
+		if int(hdr.Len) < len(data) {
+			data = data[:hdr.Len]
+		}
+
+		hw.handle(hdr, data)
+
+		if hw.rx.NeedsNotify() {
+			hw.Transport.QueueNotify(rxQueue)
+		}
+	}
+
+	return
+}
+
+// Start processes device packets and events in a background goroutine, using
+// [PollInterval] as idle interval.
+func (hw *VSock) Start() {
+	go func() {
+		for {
+			if !hw.Poll() {
+				time.Sleep(PollInterval)
+			}
+		}
+	}()
+}
+
+func (hw *VSock) add(c *Conn) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	hw.conns[c.id()] = c
+}
+
+func (hw *VSock) remove(c *Conn) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	id := c.id()
+
+	if hw.conns[id] == c {
+		delete(hw.conns, id)
+	}
+}
+
+// allocPort returns an unused local port for outgoing connections.
+func (hw *VSock) allocPort() (port uint32, err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	used := make(map[uint32]bool)
+
+	for id := range hw.conns {
+		used[id.local] = true
+	}
+
+	for range 0xffffffff - ephemeralPort {
+		port = hw.nextPort
+
+		if hw.nextPort++; hw.nextPort == 0xffffffff {
+			hw.nextPort = ephemeralPort
+		}
+
+		if !used[port] && hw.listeners[port] == nil {
+			return
+		}
+	}
+
+	return 0, errors.New("no available ports")
+}
+
+// Dial connects to the address on the named context identifier and port.
+func (hw *VSock) Dial(cid uint64, port uint32) (c *Conn, err error) {
+	local, err := hw.allocPort()
+
+	if err != nil {
+		return
+	}
+
+	c = hw.newConn(local, cid, port)
+	c.state = stateConnecting
+
+	hw.add(c)
+
+	c.Lock()
+	defer c.Unlock()
+
+	if err = hw.send(c.header(OpRequest, 0), nil); err != nil {
+		hw.remove(c)
+		return nil, err
+	}
+
+	deadline := time.Now().Add(ConnectTimeout)
+
+	for c.state == stateConnecting {
+		ch := c.changed
+		c.Unlock()
+		err = wait(ch, deadline)
+		c.Lock()
+
+		if err != nil && c.state == stateConnecting {
+			c.close(err)
+			hw.reset(&header{SrcCID: cid, SrcPort: port, DstPort: local})
+			return nil, fmt.Errorf("connection timeout, %v", err)
+		}
+	}
+
+	if c.state != stateEstablished {
+		return nil, c.err
+	}
+
+	return c, nil
+}
+
+// Listen announces on the local port, incoming connections are available
+// through the returned [Listener].
+func (hw *VSock) Listen(port uint32) (l *Listener, err error) {
+	hw.Lock()
+	defer hw.Unlock()
+
+	if hw.listeners[port] != nil {
+		return nil, errors.New("address already in use")
+	}
+
+	l = &Listener{
+		hw:     hw,
+		port:   port,
+		conns:  make(chan *Conn, backlog),
+		closed: make(chan struct{}),
+	}
+
+	hw.listeners[port] = l
+
+	return
+}
@@ -0,0 +1,216 @@
+// Sampling CPU profiler
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package profiler implements a sampling CPU profiler, based on processor
+// timer interrupts, generating profiles in the pprof format (see
+// https://github.com/google/pprof/blob/main/proto/profile.proto).
+//
+// As `runtime/pprof` CPU profiling relies on signals, not available under
+// `GOOS=tamago`, samples are recorded by the processor packages interrupt
+// handlers (see arm, arm64, amd64 and riscv64 packages) which capture the
+// interrupted program counter at each profiler tick. On amd64 and arm64 the
+// interrupted goroutine call stack is also captured by walking its frame
+// pointers.
+//
+// The profiler uses an alarm timer (e.g. arm64.CPU.SetAlarm()), which must
+// have its interrupt enabled, to trigger sampling. The application must
+// invoke [Profiler.Tick] on each alarm interrupt to collect the sample and
+// re-arm the timer.
+//
+// Example:
+//
+//	p := &profiler.Profiler{
+//		Rate:     100,
+//		SetAlarm: imx8mp.ARM64.SetAlarm,
+//		GetTime:  imx8mp.ARM64.GetTime,
+//	}
+//
+//	isr := func() {
+//		if imx8mp.GIC.GetInterrupt() == arm64.TIMER_IRQ {
+//			p.Tick()
+//		}
+//	}
+//
+//	imx8mp.GIC.EnableInterrupt(arm64.TIMER_IRQ)
+//	go arm64.ServiceInterrupts(isr)
+//
+//	p.Start()
+//	// ... workload ...
+//	p.Stop()
+//
+//	p.WriteTo(uart)
+//
+// The amd64 alarm interrupt is serviced internally (see amd64.IRQ_WAKEUP),
+// on such architecture [Profiler.Tick] must therefore be invoked by a
+// goroutine at the sampling rate (e.g. with a [time.Ticker]).
+//
+// This package is only meant to be used with `GOOS=tamago` as supported by the
+// TamaGo framework for bare metal Go, see https://github.com/usbarmory/tamago.
+package profiler
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/usbarmory/tamago/internal/sample"
+)
+
+// DefaultRate is the default sampling frequency in Hz.
+const DefaultRate = 100
+
+// Profiler represents a sampling CPU profiler instance, only one instance can
+// be running at any given time.
+type Profiler struct {
+	sync.Mutex
+
+	// Rate is the sampling frequency in Hz (default: DefaultRate).
+	Rate int
+
+	// SetAlarm arms the timer interrupt used to trigger sampling at the
+	// argument absolute time in nanoseconds (e.g. arm64.CPU.SetAlarm()).
+	SetAlarm func(ns int64)
+	// GetTime returns the system time in nanoseconds, in the time domain
+	// of SetAlarm (e.g. arm64.CPU.GetTime()).
+	GetTime func() int64
+
+	period  int64
+	running bool
+
+	start    time.Time
+	duration int64
+	lost     int
+
+	counts map[sample.Sample]int64
+}
+
+var (
+	runningMutex sync.Mutex
+	active       *Profiler
+)
+
+// Start initializes the profiler and arms the sampling timer, any previously
+// collected sample is discarded.
+func (p *Profiler) Start() (err error) {
+	if p.SetAlarm == nil || p.GetTime == nil {
+		return errors.New("missing timer functions")
+	}
+
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+
+	if active != nil {
+		return errors.New("profiler already running")
+	}
+
+	p.Lock()
+	defer p.Unlock()
+
+	if p.Rate <= 0 {
+		p.Rate = DefaultRate
+	}
+
+	p.period = int64(time.Second) / int64(p.Rate)
+	p.counts = make(map[sample.Sample]int64)
+	p.lost = sample.Lost()
+	p.start = time.Now()
+	p.duration = p.GetTime()
+
+	// discard stale samples
+	var s sample.Sample
+
+	for sample.Read(&s) {
+	}
+
+	active = p
+	p.running = true
+
+	sample.Arm()
+	p.SetAlarm(p.GetTime() + p.period)
+
+	return
+}
+
+// Tick collects the samples recorded since the last invocation and re-arms
+// the sampling timer, it must be invoked on each alarm timer interrupt.
+func (p *Profiler) Tick() {
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.running {
+		return
+	}
+
+	p.collect()
+
+	sample.Arm()
+	p.SetAlarm(p.GetTime() + p.period)
+}
+
+// Stop disarms the sampling timer and collects any pending sample.
+func (p *Profiler) Stop() {
+	runningMutex.Lock()
+	defer runningMutex.Unlock()
+
+	p.Lock()
+	defer p.Unlock()
+
+	if !p.running {
+		return
+	}
+
+	sample.Disarm()
+	p.SetAlarm(0)
+
+	p.collect()
+	p.running = false
+	p.duration = p.GetTime() - p.duration
+	p.lost = sample.Lost() - p.lost
+
+	active = nil
+}
+
+// Lost returns the number of samples dropped, since the profiler start, due
+// to insufficient Tick invocations.
+func (p *Profiler) Lost() int {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.running {
+		return sample.Lost() - p.lost
+	}
+
+	return p.lost
+}
+
+// WriteTo writes the collected samples, in gzip compressed pprof format, to
+// the argument writer, it must be invoked after Stop.
+func (p *Profiler) WriteTo(w io.Writer) (n int64, err error) {
+	p.Lock()
+	defer p.Unlock()
+
+	if p.running {
+		return 0, errors.New("profiler is running")
+	}
+
+	if p.counts == nil {
+		return 0, errors.New("no profile available")
+	}
+
+	return p.write(w)
+}
+
+func (p *Profiler) collect() {
+	var s sample.Sample
+
+	for sample.Read(&s) {
+		clear(s.PC[s.N:])
+		p.counts[s]++
+	}
+}
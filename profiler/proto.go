@@ -0,0 +1,293 @@
+// Sampling CPU profiler
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package profiler
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"runtime"
+)
+
+// pprof protocol buffer field numbers
+// (https://github.com/google/pprof/blob/main/proto/profile.proto).
+const (
+	// Profile
+	profileSampleType    = 1
+	profileSample        = 2
+	profileMapping       = 3
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+	profileComment       = 13
+
+	// ValueType
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	// Sample
+	sampleLocationID = 1
+	sampleValue      = 2
+
+	// Mapping
+	mappingID             = 1
+	mappingMemoryLimit    = 3
+	mappingHasFunctions   = 7
+	mappingHasFilenames   = 8
+	mappingHasLineNumbers = 9
+
+	// Location
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	// Line
+	lineFunctionID = 1
+	lineLine       = 2
+
+	// Function
+	functionID         = 1
+	functionName       = 2
+	functionSystemName = 3
+	functionFilename   = 4
+)
+
+// protocol buffer wire types
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// encoder implements a minimal protocol buffer encoder.
+type encoder struct {
+	buf []byte
+}
+
+func (e *encoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.buf = append(e.buf, byte(v)|0x80)
+		v >>= 7
+	}
+
+	e.buf = append(e.buf, byte(v))
+}
+
+func (e *encoder) key(tag int, wire int) {
+	e.varint(uint64(tag)<<3 | uint64(wire))
+}
+
+func (e *encoder) uint64(tag int, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	e.key(tag, wireVarint)
+	e.varint(v)
+}
+
+func (e *encoder) int64(tag int, v int64) {
+	e.uint64(tag, uint64(v))
+}
+
+func (e *encoder) bool(tag int, v bool) {
+	if v {
+		e.uint64(tag, 1)
+	}
+}
+
+func (e *encoder) bytes(tag int, b []byte) {
+	e.key(tag, wireBytes)
+	e.varint(uint64(len(b)))
+	e.buf = append(e.buf, b...)
+}
+
+func (e *encoder) string(tag int, s string) {
+	e.key(tag, wireBytes)
+	e.varint(uint64(len(s)))
+	e.buf = append(e.buf, s...)
+}
+
+func (e *encoder) packed(tag int, vals []uint64) {
+	var p encoder
+
+	for _, v := range vals {
+		p.varint(v)
+	}
+
+	e.bytes(tag, p.buf)
+}
+
+// message encodes a nested message through the argument function.
+func (e *encoder) message(tag int, fn func(m *encoder)) {
+	var m encoder
+	fn(&m)
+	e.bytes(tag, m.buf)
+}
+
+// profile holds the string, function and location tables of a profile
+// being encoded.
+type profile struct {
+	encoder
+
+	strings   map[string]int
+	functions map[string]uint64
+	locations map[uintptr]uint64
+	table     []string
+}
+
+func (p *profile) str(s string) int64 {
+	if i, ok := p.strings[s]; ok {
+		return int64(i)
+	}
+
+	i := len(p.table)
+	p.strings[s] = i
+	p.table = append(p.table, s)
+
+	return int64(i)
+}
+
+func (p *profile) valueType(tag int, typ string, unit string) {
+	p.message(tag, func(m *encoder) {
+		m.int64(valueTypeType, p.str(typ))
+		m.int64(valueTypeUnit, p.str(unit))
+	})
+}
+
+func (p *profile) function(name string, file string) (id uint64) {
+	if id, ok := p.functions[name]; ok {
+		return id
+	}
+
+	id = uint64(len(p.functions) + 1)
+	p.functions[name] = id
+
+	p.message(profileFunction, func(m *encoder) {
+		m.uint64(functionID, id)
+		m.int64(functionName, p.str(name))
+		m.int64(functionSystemName, p.str(name))
+		m.int64(functionFilename, p.str(file))
+	})
+
+	return
+}
+
+// location returns the location identifier for the argument program counter,
+// return addresses are adjusted to the calling instruction for symbolization.
+func (p *profile) location(pc uintptr, ret bool) (id uint64) {
+	if id, ok := p.locations[pc]; ok {
+		return id
+	}
+
+	id = uint64(len(p.locations) + 1)
+	p.locations[pc] = id
+
+	addr := pc
+
+	if ret && addr > 0 {
+		addr--
+	}
+
+	var fnID uint64
+	var line int
+
+	if fn := runtime.FuncForPC(addr); fn != nil {
+		var file string
+		file, line = fn.FileLine(addr)
+		fnID = p.function(fn.Name(), file)
+	}
+
+	p.message(profileLocation, func(m *encoder) {
+		m.uint64(locationID, id)
+		m.uint64(locationMappingID, 1)
+		m.uint64(locationAddress, uint64(pc))
+
+		if fnID != 0 {
+			m.message(locationLine, func(l *encoder) {
+				l.uint64(lineFunctionID, fnID)
+				l.int64(lineLine, int64(line))
+			})
+		}
+	})
+
+	return
+}
+
+func (p *Profiler) write(w io.Writer) (n int64, err error) {
+	pb := &profile{
+		strings:   make(map[string]int),
+		functions: make(map[string]uint64),
+		locations: make(map[uintptr]uint64),
+	}
+
+	// the string table must start with an empty string
+	pb.str("")
+
+	pb.valueType(profileSampleType, "samples", "count")
+	pb.valueType(profileSampleType, "cpu", "nanoseconds")
+
+	for s, count := range p.counts {
+		ids := make([]uint64, s.N)
+
+		for i := 0; i < s.N; i++ {
+			ids[i] = pb.location(s.PC[i], i > 0)
+		}
+
+		pb.message(profileSample, func(m *encoder) {
+			m.packed(sampleLocationID, ids)
+			m.packed(sampleValue, []uint64{uint64(count), uint64(count * p.period)})
+		})
+	}
+
+	pb.message(profileMapping, func(m *encoder) {
+		m.uint64(mappingID, 1)
+		m.uint64(mappingMemoryLimit, ^uint64(0))
+		m.bool(mappingHasFunctions, true)
+		m.bool(mappingHasFilenames, true)
+		m.bool(mappingHasLineNumbers, true)
+	})
+
+	pb.int64(profileTimeNanos, p.start.UnixNano())
+	pb.int64(profileDurationNanos, p.duration)
+	pb.valueType(profilePeriodType, "cpu", "nanoseconds")
+	pb.int64(profilePeriod, p.period)
+
+	if p.lost > 0 {
+		pb.int64(profileComment, pb.str(fmt.Sprintf("%d lost samples", p.lost)))
+	}
+
+	for _, s := range pb.table {
+		pb.string(profileStringTable, s)
+	}
+
+	cw := &countWriter{w: w}
+	zw := gzip.NewWriter(cw)
+
+	if _, err = zw.Write(pb.buf); err == nil {
+		err = zw.Close()
+	}
+
+	return cw.n, err
+}
+
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (n int, err error) {
+	n, err = cw.w.Write(p)
+	cw.n += int64(n)
+	return
+}
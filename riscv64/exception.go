@@ -11,6 +11,7 @@ package riscv64
 import (
 	"unsafe"
 
+	"github.com/usbarmory/tamago/fault"
 	"github.com/usbarmory/tamago/internal/exception"
 )
 
@@ -48,17 +49,106 @@ func vector(fn ExceptionHandler) uint64 {
 	return **((**uint64)(unsafe.Pointer(&fn)))
 }
 
-// DefaultExceptionHandler handles an exception by printing the exception
-// program counter and trap cause before panicking.
-func DefaultExceptionHandler() {
-	mcause := read_mcause()
-	size := XLEN - 1
+// ExceptionContext represents the processor state captured on machine mode
+// exceptions.
+type ExceptionContext struct {
+	// X holds general purpose registers, X[0] is always zero.
+	X [32]uint64
+	// PC holds the Machine Exception Program Counter (mepc).
+	PC uint64
+
+	// Machine Cause Register (mcause)
+	Cause uint64
+	// Machine Trap Value Register (mtval)
+	TrapValue uint64
+	// Machine Status Register (mstatus)
+	Status uint64
+
+	// fault handling result, read by exception.s
+	handled bool
+}
+
+// Maximum exception nesting level, contexts are not tracked per hart as the Go
+// runtime executes on a single one.
+const excNesting = 2
+
+var (
+	// exception contexts, by nesting level
+	excContexts [excNesting]ExceptionContext
+	// exception nesting level
+	excLevel uint64
+
+	// last unhandled exception context
+	excContext ExceptionContext
+
+	faultHandlerFn = faultHandler
+)
+
+var registerNames = [...]string{
+	"zero", "ra", "sp", "gp", "tp", "t0", "t1", "t2", "s0", "s1", "a0",
+	"a1", "a2", "a3", "a4", "a5", "a6", "a7", "s2", "s3", "s4", "s5",
+	"s6", "s7", "s8", "s9", "s10", "s11", "t3", "t4", "t5", "t6",
+	"pc", "mcause", "mtval", "mstatus",
+}
 
-	irq := int(mcause >> size)
-	code := int(mcause) & ^(1 << size)
+// Class returns the exception class.
+func (ctx *ExceptionContext) Class() fault.Class {
+	switch ctx.Cause {
+	case IllegalInstruction:
+		return fault.UndefinedInstruction
+	case Breakpoint:
+		return fault.Breakpoint
+	case EnvironmentCallFromU, EnvironmentCallFromS, EnvironmentCallFromM:
+		return fault.Syscall
+	case InstructionAccessFault, InstructionPageFault:
+		return fault.InstructionFault
+	case LoadAccessFault, StoreAccessFault, LoadPageFault, StorePageFault:
+		return fault.DataFault
+	case InstructionAddressMisaligned, LoadAddressMisaligned, StoreAddressMisaligned:
+		return fault.Alignment
+	}
+
+	return fault.Unknown
+}
 
-	print("machine exception: interrupt ", irq, " code ", code, "\n")
-	exception.Throw(uintptr(read_mepc()))
+// ProgramCounter returns the exception program counter.
+func (ctx *ExceptionContext) ProgramCounter() uintptr {
+	return uintptr(ctx.PC)
+}
+
+// SetProgramCounter updates the program counter at which execution is
+// resumed.
+func (ctx *ExceptionContext) SetProgramCounter(pc uintptr) {
+	ctx.PC = uint64(pc)
+}
+
+// Address returns the faulting memory address for misaligned, access and
+// page fault exceptions.
+func (ctx *ExceptionContext) Address() uintptr {
+	switch ctx.Class() {
+	case fault.InstructionFault, fault.DataFault, fault.Alignment:
+		return uintptr(ctx.TrapValue)
+	}
+
+	return 0
+}
+
+// Print prints the exception context registers.
+func (ctx *ExceptionContext) Print() {
+	var vals [len(registerNames)]uint64
+
+	copy(vals[:], ctx.X[:])
+	copy(vals[len(ctx.X):], []uint64{ctx.PC, ctx.Cause, ctx.TrapValue, ctx.Status})
+
+	print("machine exception: code ", int(ctx.Cause), " (", ctx.Class().String(), ")\n")
+	exception.PrintRegisters(registerNames[:], vals[:], 16)
+}
+
+// DefaultExceptionHandler handles an exception by printing its context before
+// panicking.
+func DefaultExceptionHandler() {
+	excContext.Print()
+	exception.Throw(uintptr(excContext.PC))
 }
 
 // DefaultSupervisorExceptionHandler handles an exception by printing the
@@ -75,8 +165,22 @@ func DefaultSupervisorExceptionHandler() {
 }
 
 // SystemExceptionHandler allows to override the default exception handler.
+//
+// Handlers registered with fault.SetHandler() take precedence.
 var SystemExceptionHandler = DefaultExceptionHandler
 
+// faultHandler is executed on the system stack (g0) to service exceptions
+// with handlers registered with fault.SetHandler().
+func faultHandler() {
+	ctx := &excContexts[excLevel-1]
+
+	if ctx.handled = fault.Handle(ctx); !ctx.handled {
+		excContext = *ctx
+	}
+}
+
+// systemException is executed on the faulting goroutine stack for exceptions
+// not serviced by faultHandler.
 func systemException() {
 	SystemExceptionHandler()
 }
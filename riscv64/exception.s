@@ -6,6 +6,7 @@
 // Use of this source code is governed by the license
 // that can be found in the LICENSE file.
 
+#include "go_asm.h"
 #include "textflag.h"
 
 // func set_mtvec(addr uint64)
@@ -44,9 +45,143 @@ TEXT ·read_scause(SB),NOSPLIT,$0-8
 	MOV	T0, ret+0(FP)
 	RET
 
+// EXCEPTION_CONTEXT sets T6 to the exception context address for the nesting
+// level in T0, T0 is clobbered.
+#define EXCEPTION_CONTEXT			\
+	ADD	$-1, T0				\
+	MOV	$ExceptionContext__size, T6	\
+	MUL	T6, T0				\
+	MOV	$·excContexts(SB), T6		\
+	ADD	T0, T6
+
 TEXT ·trapHandler(SB),NOSPLIT|NOFRAME,$0
-	CSRRS	ZERO, MCAUSE, T0
-	BLT	ZERO, T0, fault
+	// obtain a scratch register
+	CSRRW	T6, MSCRATCH, T6
+
+	// forward interrupts to the interrupt handler
+	CSRRS	ZERO, MCAUSE, T6
+	BGE	T6, ZERO, exception
+	CSRRW	T6, MSCRATCH, T6
 	JMP	·handleInterrupt(SB)
-fault:
+exception:
+	// increment nesting level, halt when exceeded
+	SUB	$16, SP
+	MOV	T0, 8(SP)
+	MOV	$·excLevel(SB), T6
+	MOV	(T6), T0
+	ADD	$1, T0
+	MOV	T0, (T6)
+	ADD	$-(const_excNesting+1), T0, T6
+	BGE	T6, ZERO, halt
+
+	// save exception context
+	EXCEPTION_CONTEXT
+	MOV	8(SP), T0
+	ADD	$16, SP
+	MOV	X1, (ExceptionContext_X+1*8)(T6)
+	MOV	X2, (ExceptionContext_X+2*8)(T6)
+	MOV	X3, (ExceptionContext_X+3*8)(T6)
+	MOV	TP, (ExceptionContext_X+4*8)(T6)
+	MOV	X5, (ExceptionContext_X+5*8)(T6)
+	MOV	X6, (ExceptionContext_X+6*8)(T6)
+	MOV	X7, (ExceptionContext_X+7*8)(T6)
+	MOV	X8, (ExceptionContext_X+8*8)(T6)
+	MOV	X9, (ExceptionContext_X+9*8)(T6)
+	MOV	X10, (ExceptionContext_X+10*8)(T6)
+	MOV	X11, (ExceptionContext_X+11*8)(T6)
+	MOV	X12, (ExceptionContext_X+12*8)(T6)
+	MOV	X13, (ExceptionContext_X+13*8)(T6)
+	MOV	X14, (ExceptionContext_X+14*8)(T6)
+	MOV	X15, (ExceptionContext_X+15*8)(T6)
+	MOV	X16, (ExceptionContext_X+16*8)(T6)
+	MOV	X17, (ExceptionContext_X+17*8)(T6)
+	MOV	X18, (ExceptionContext_X+18*8)(T6)
+	MOV	X19, (ExceptionContext_X+19*8)(T6)
+	MOV	X20, (ExceptionContext_X+20*8)(T6)
+	MOV	X21, (ExceptionContext_X+21*8)(T6)
+	MOV	X22, (ExceptionContext_X+22*8)(T6)
+	MOV	X23, (ExceptionContext_X+23*8)(T6)
+	MOV	X24, (ExceptionContext_X+24*8)(T6)
+	MOV	X25, (ExceptionContext_X+25*8)(T6)
+	MOV	X26, (ExceptionContext_X+26*8)(T6)
+	MOV	g, (ExceptionContext_X+27*8)(T6)
+	MOV	X28, (ExceptionContext_X+28*8)(T6)
+	MOV	X29, (ExceptionContext_X+29*8)(T6)
+	MOV	X30, (ExceptionContext_X+30*8)(T6)
+
+	CSRRS	ZERO, MSCRATCH, T0
+	MOV	T0, (ExceptionContext_X+31*8)(T6)
+	CSRRS	ZERO, MEPC, T0
+	MOV	T0, ExceptionContext_PC(T6)
+	CSRRS	ZERO, MCAUSE, T0
+	MOV	T0, ExceptionContext_Cause(T6)
+	CSRRS	ZERO, MTVAL, T0
+	MOV	T0, ExceptionContext_TrapValue(T6)
+	CSRRS	ZERO, MSTATUS, T0
+	MOV	T0, ExceptionContext_Status(T6)
+
+	// call fault handlers on system stack (g0)
+	MOV	$·faultHandlerFn(SB), T0
+	MOV	(T0), T0
+	SUB	$16, SP
+	MOV	T0, 8(SP)
+	CALL	runtime·systemstack(SB)
+	ADD	$16, SP
+
+	// decrement nesting level
+	MOV	$·excLevel(SB), T6
+	MOV	(T6), T0
+	ADD	$-1, T0
+	MOV	T0, (T6)
+	ADD	$1, T0
+	EXCEPTION_CONTEXT
+
+	MOVB	ExceptionContext_handled(T6), T0
+	BEQZ	T0, unhandled
+
+	// restore exception context, stack pointer changes are not supported
+	MOV	ExceptionContext_PC(T6), T0
+	CSRRW	T0, MEPC, ZERO
+	MOV	(ExceptionContext_X+1*8)(T6), X1
+	MOV	(ExceptionContext_X+3*8)(T6), X3
+	MOV	(ExceptionContext_X+4*8)(T6), TP
+	MOV	(ExceptionContext_X+5*8)(T6), X5
+	MOV	(ExceptionContext_X+6*8)(T6), X6
+	MOV	(ExceptionContext_X+7*8)(T6), X7
+	MOV	(ExceptionContext_X+8*8)(T6), X8
+	MOV	(ExceptionContext_X+9*8)(T6), X9
+	MOV	(ExceptionContext_X+10*8)(T6), X10
+	MOV	(ExceptionContext_X+11*8)(T6), X11
+	MOV	(ExceptionContext_X+12*8)(T6), X12
+	MOV	(ExceptionContext_X+13*8)(T6), X13
+	MOV	(ExceptionContext_X+14*8)(T6), X14
+	MOV	(ExceptionContext_X+15*8)(T6), X15
+	MOV	(ExceptionContext_X+16*8)(T6), X16
+	MOV	(ExceptionContext_X+17*8)(T6), X17
+	MOV	(ExceptionContext_X+18*8)(T6), X18
+	MOV	(ExceptionContext_X+19*8)(T6), X19
+	MOV	(ExceptionContext_X+20*8)(T6), X20
+	MOV	(ExceptionContext_X+21*8)(T6), X21
+	MOV	(ExceptionContext_X+22*8)(T6), X22
+	MOV	(ExceptionContext_X+23*8)(T6), X23
+	MOV	(ExceptionContext_X+24*8)(T6), X24
+	MOV	(ExceptionContext_X+25*8)(T6), X25
+	MOV	(ExceptionContext_X+26*8)(T6), X26
+	MOV	(ExceptionContext_X+27*8)(T6), g
+	MOV	(ExceptionContext_X+28*8)(T6), X28
+	MOV	(ExceptionContext_X+29*8)(T6), X29
+	MOV	(ExceptionContext_X+30*8)(T6), X30
+	MOV	(ExceptionContext_X+31*8)(T6), T6
+
+	// exception return
+	WORD	$0x30200073	// mret
+
+unhandled:
+	// invoke default handler on the faulting goroutine stack
+	MOV	(ExceptionContext_X+1*8)(T6), X1
 	JMP	·systemException(SB)
+
+halt:
+	// nested exceptions exceeding excNesting are not recoverable
+	WORD	$0x10500073	// wfi
+	JMP	halt
@@ -12,6 +12,8 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+
+	"github.com/usbarmory/tamago/internal/sample"
 )
 
 // IRQ_SIGNAL represents the `os/signal` used to signal and service interrupts.
@@ -33,6 +35,13 @@ func irq_disable()
 func meie_enable()
 func wfi()
 
+// irqSample records the interrupted call stack, when armed by a profiler.
+//
+//go:nosplit
+func irqSample(pc uintptr, fp uintptr) {
+	sample.Record(pc, fp)
+}
+
 // EnableInterrupts unmasks IRQ interrupts.
 func (cpu *CPU) EnableInterrupts() {
 	irq_enable()
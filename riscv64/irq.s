@@ -80,6 +80,14 @@ TEXT ·handleInterrupt(SB),NOSPLIT|NOFRAME,$0
 	MOV	X30, -30*8(SP)
 	MOV	X31, -31*8(SP)
 
+	// sample interrupted program counter for profiling
+	SUB	$(34*8), SP
+	CSRRS	ZERO, MEPC, T0
+	MOV	T0, 8(SP)
+	MOV	ZERO, 16(SP)
+	CALL	·irqSample(SB)
+	ADD	$(34*8), SP
+
 	SUB	$(32*8), SP
 	MOV	$(const_IRQ_SIGNAL), T0
 	MOV	T0, 8(SP)
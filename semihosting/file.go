@@ -0,0 +1,191 @@
+// Semihosting support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build arm || arm64 || riscv64
+
+package semihosting
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"unsafe"
+)
+
+// SYS_OPEN modes, corresponding to ISO C fopen() modes.
+const (
+	MODE_R   = 0  // r
+	MODE_RB  = 1  // rb
+	MODE_RP  = 2  // r+
+	MODE_RPB = 3  // r+b
+	MODE_W   = 4  // w
+	MODE_WB  = 5  // wb
+	MODE_WP  = 6  // w+
+	MODE_WPB = 7  // w+b
+	MODE_A   = 8  // a
+	MODE_AB  = 9  // ab
+	MODE_AP  = 10 // a+
+	MODE_APB = 11 // a+b
+)
+
+// Console is the special file name to open the debug console.
+const Console = ":tt"
+
+// File represents a host file opened through semihosting.
+type File struct {
+	fd  uintptr
+	off int64
+}
+
+func ptr(buf []byte) uintptr {
+	if len(buf) == 0 {
+		return 0
+	}
+
+	return uintptr(unsafe.Pointer(&buf[0]))
+}
+
+// Open opens a host file with the given mode (e.g. [MODE_RB]).
+func Open(name string, mode int) (f *File, err error) {
+	path := make([]byte, len(name)+1)
+	copy(path, name)
+
+	fd := callBlock(SYS_OPEN, []uintptr{ptr(path), uintptr(mode), uintptr(len(name))})
+	runtime.KeepAlive(path)
+
+	if fd == -1 {
+		return nil, fmt.Errorf("could not open %s, errno:%d", name, Errno())
+	}
+
+	return &File{fd: uintptr(fd)}, nil
+}
+
+// ReadFile reads a host file and returns its contents.
+func ReadFile(name string) (buf []byte, err error) {
+	f, err := Open(name, MODE_RB)
+
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	size, err := f.Len()
+
+	if err != nil {
+		return
+	}
+
+	buf = make([]byte, size)
+	_, err = io.ReadFull(f, buf)
+
+	return
+}
+
+// IsTTY returns whether the file is connected to an interactive device.
+func (f *File) IsTTY() bool {
+	return callBlock(SYS_ISTTY, []uintptr{f.fd}) == 1
+}
+
+// Len returns the file length.
+func (f *File) Len() (int64, error) {
+	n := callBlock(SYS_FLEN, []uintptr{f.fd})
+
+	if n == -1 {
+		return 0, fmt.Errorf("could not get file length, errno:%d", Errno())
+	}
+
+	return int64(n), nil
+}
+
+// Read reads up to len(buf) bytes from the file.
+func (f *File) Read(buf []byte) (n int, err error) {
+	if len(buf) == 0 {
+		return
+	}
+
+	// the result is the number of bytes not read
+	left := callBlock(SYS_READ, []uintptr{f.fd, ptr(buf), uintptr(len(buf))})
+	runtime.KeepAlive(buf)
+
+	if left < 0 || left > len(buf) {
+		return 0, fmt.Errorf("read error, errno:%d", Errno())
+	}
+
+	if n = len(buf) - left; n == 0 {
+		return 0, io.EOF
+	}
+
+	f.off += int64(n)
+
+	return
+}
+
+// Write writes len(buf) bytes to the file.
+func (f *File) Write(buf []byte) (n int, err error) {
+	if len(buf) == 0 {
+		return
+	}
+
+	// the result is the number of bytes not written
+	left := callBlock(SYS_WRITE, []uintptr{f.fd, ptr(buf), uintptr(len(buf))})
+	runtime.KeepAlive(buf)
+
+	if left < 0 || left > len(buf) {
+		return 0, fmt.Errorf("write error, errno:%d", Errno())
+	}
+
+	n = len(buf) - left
+	f.off += int64(n)
+
+	if n < len(buf) {
+		err = io.ErrShortWrite
+	}
+
+	return
+}
+
+// Seek sets the offset for the next Read or Write on the file.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		size, err := f.Len()
+
+		if err != nil {
+			return 0, err
+		}
+
+		offset += size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("invalid offset")
+	}
+
+	if callBlock(SYS_SEEK, []uintptr{f.fd, uintptr(offset)}) != 0 {
+		return 0, fmt.Errorf("seek error, errno:%d", Errno())
+	}
+
+	f.off = offset
+
+	return offset, nil
+}
+
+// Close closes the file.
+func (f *File) Close() error {
+	if callBlock(SYS_CLOSE, []uintptr{f.fd}) != 0 {
+		return fmt.Errorf("close error, errno:%d", Errno())
+	}
+
+	return nil
+}
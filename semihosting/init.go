@@ -0,0 +1,28 @@
+// Semihosting support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build semihosting && (arm || arm64 || riscv64)
+
+package semihosting
+
+import (
+	"os"
+	"runtime/goos"
+	"strings"
+)
+
+func init() {
+	goos.Exit = Exit
+
+	// command line arguments are separated by spaces
+	if cmdline, err := CommandLine(); err == nil && len(os.Args) <= 1 {
+		if args := strings.Fields(cmdline); len(args) > 0 {
+			os.Args = args
+		}
+	}
+}
@@ -0,0 +1,125 @@
+// Semihosting support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build arm || arm64 || riscv64
+
+// Package semihosting implements host services access, through debugger or
+// emulator (e.g. `qemu -semihosting`) trapping of semihosting calls, adopting
+// the following reference specifications:
+//   - Semihosting for AArch32 and AArch64 - Release 2023Q3
+//   - RISC-V Semihosting - Version 0.4
+//
+// Semihosting calls are trapped through `SVC 0x123456` (AArch32), `HLT 0xf000`
+// (AArch64) or the `slli/ebreak/srai` sequence (RISC-V), in absence of a
+// debugger or emulator configured to handle them the invocation results in a
+// processor exception.
+//
+// When built with the `semihosting` tag application exit (`goos.Exit`) is
+// redirected to the debugger or emulator and `os.Args` is set from its command
+// line, supported boards also redirect standard output through [WriteC].
+//
+// This package is only meant to be used with `GOOS=tamago` as supported by the
+// TamaGo framework for bare metal Go, see https://github.com/usbarmory/tamago.
+package semihosting
+
+import (
+	"errors"
+	"unsafe"
+)
+
+// Semihosting operations
+const (
+	SYS_OPEN          = 0x01
+	SYS_CLOSE         = 0x02
+	SYS_WRITEC        = 0x03
+	SYS_WRITE0        = 0x04
+	SYS_WRITE         = 0x05
+	SYS_READ          = 0x06
+	SYS_READC         = 0x07
+	SYS_ISTTY         = 0x09
+	SYS_SEEK          = 0x0a
+	SYS_FLEN          = 0x0c
+	SYS_ERRNO         = 0x13
+	SYS_GET_CMDLINE   = 0x15
+	SYS_EXIT          = 0x18
+	SYS_EXIT_EXTENDED = 0x20
+)
+
+// Exit reason code
+const ADP_STOPPED_APPLICATION_EXIT = 0x20026
+
+// defined in semihosting_*.s
+func call(op uintptr, arg uintptr) uintptr
+
+// Call invokes a semihosting operation with a parameter, which is either a
+// value or the address of a parameter block, and returns its result.
+func Call(op int, arg uintptr) int {
+	return int(int32(call(uintptr(op), arg)))
+}
+
+func callBlock(op int, block []uintptr) int {
+	return int(int32(call(uintptr(op), uintptr(unsafe.Pointer(&block[0])))))
+}
+
+// WriteC writes a character to the debug console, it does not allocate and is
+// therefore suitable for use as `runtime/goos.Printk`.
+func WriteC(c byte) {
+	call(SYS_WRITEC, uintptr(unsafe.Pointer(&c)))
+}
+
+// Write0 writes a string to the debug console.
+func Write0(s string) {
+	buf := make([]byte, len(s)+1)
+	copy(buf, s)
+
+	call(SYS_WRITE0, uintptr(unsafe.Pointer(&buf[0])))
+}
+
+// ReadC reads a character from the debug console, blocking until one is
+// available.
+func ReadC() byte {
+	return byte(Call(SYS_READC, 0))
+}
+
+// Errno returns the value of the host C library errno variable, set by the
+// last failed operation.
+func Errno() int {
+	return Call(SYS_ERRNO, 0)
+}
+
+// CommandLine returns the command line passed by the debugger or emulator
+// (e.g. `qemu -semihosting-config arg=...`), limited to 1024 bytes.
+func CommandLine() (string, error) {
+	buf := make([]byte, 1024)
+	block := []uintptr{uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf))}
+
+	if callBlock(SYS_GET_CMDLINE, block) != 0 {
+		return "", errors.New("command line unavailable")
+	}
+
+	return string(buf[:min(block[1], uintptr(len(buf)))]), nil
+}
+
+// Exit reports application termination, with the argument status code, to the
+// debugger or emulator. On 64-bit architectures the status is reported with
+// SYS_EXIT, while AArch32 requires SYS_EXIT_EXTENDED support.
+//
+// The function does not return, if the host ignores the request the calling
+// goroutine loops forever.
+func Exit(code int32) {
+	block := []uintptr{ADP_STOPPED_APPLICATION_EXIT, uintptr(code)}
+
+	if unsafe.Sizeof(uintptr(0)) == 8 {
+		callBlock(SYS_EXIT, block)
+	} else {
+		callBlock(SYS_EXIT_EXTENDED, block)
+	}
+
+	for {
+	}
+}
@@ -0,0 +1,20 @@
+// Semihosting support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func call(op uintptr, arg uintptr) uintptr
+TEXT ·call(SB),$0-12
+	MOVW	op+0(FP), R0
+	MOVW	arg+4(FP), R1
+
+	// preserve LR, clobbered when the SVC is taken by a debugger
+	MOVW	R14, R4
+	WORD	$0xef123456 // svc 0x123456
+	MOVW	R4, R14
+
+	MOVW	R0, ret+8(FP)
+	RET
@@ -0,0 +1,15 @@
+// Semihosting support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func call(op uintptr, arg uintptr) uintptr
+TEXT ·call(SB),$0-24
+	MOVD	op+0(FP), R0
+	MOVD	arg+8(FP), R1
+	WORD	$0xd45e0000 // hlt #0xf000
+	MOVD	R0, ret+16(FP)
+	RET
@@ -0,0 +1,22 @@
+// Semihosting support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// func call(op uintptr, arg uintptr) uintptr
+TEXT ·call(SB),$0-24
+	MOV	op+0(FP), A0
+	MOV	arg+8(FP), A1
+
+	// The semihosting trap sequence must not cross a page boundary, as
+	// instructions are fetched individually by the debugger.
+	PCALIGN	$16
+	WORD	$0x01f01013 // slli zero, zero, 0x1f
+	WORD	$0x00100073 // ebreak
+	WORD	$0x40705013 // srai zero, zero, 7
+
+	MOV	A0, ret+16(FP)
+	RET
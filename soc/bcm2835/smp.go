@@ -0,0 +1,75 @@
+// BCM2836 SoC multi-core support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) the bcm2835 package authors
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package bcm2835
+
+import (
+	"github.com/usbarmory/tamago/arm"
+	"github.com/usbarmory/tamago/internal/reg"
+)
+
+// BCM2836 ARM local peripherals registers
+// (QA7 - ARM Quad A7 core).
+const (
+	LOCAL_BASE = 0x40000000
+
+	// Core mailboxes interrupt control
+	LOCAL_MAILBOX_INT_CTRL = LOCAL_BASE + 0x50
+	// Core mailboxes write-set
+	LOCAL_MAILBOX_SET = LOCAL_BASE + 0x80
+	// Core mailboxes read & write-high-to-clear
+	LOCAL_MAILBOX_CLR = LOCAL_BASE + 0xc0
+
+	// mailbox used to signal wake-up interrupts
+	WAKE_MAILBOX = 0
+	// mailbox polled by the firmware secondary core spin loop
+	START_MAILBOX = 3
+)
+
+func localMailbox(base uint32, core int, n int) uint32 {
+	return base + uint32(core)*0x10 + uint32(n)*4
+}
+
+// SMP represents the BCM2836 (e.g. Raspberry Pi 2) secondary cores control,
+// based on the ARM local peripherals mailboxes, for Symmetric Multiprocessing
+// operation.
+//
+// Example:
+//
+//	bcm2835.ARM.InitSMP(-1, bcm2835.SMP)
+var SMP = &arm.SMP{
+	Start:  startCore,
+	Init:   initCore,
+	Signal: signalCore,
+	Clear:  clearCore,
+}
+
+// startCore releases a secondary core from the firmware spin loop, which
+// waits for a non-zero entry address on its mailbox 3.
+func startCore(core int, entry uint32) error {
+	reg.Write(localMailbox(LOCAL_MAILBOX_SET, core, START_MAILBOX), entry)
+	ARM.SendEvent()
+
+	return nil
+}
+
+func initCore(core int) {
+	// clear entry address set by startCore
+	reg.Write(localMailbox(LOCAL_MAILBOX_CLR, core, START_MAILBOX), 0xffffffff)
+
+	// route wake-up mailbox to core IRQ
+	reg.Set(LOCAL_MAILBOX_INT_CTRL+uint32(core)*4, WAKE_MAILBOX)
+}
+
+func signalCore(core int) {
+	reg.Write(localMailbox(LOCAL_MAILBOX_SET, core, WAKE_MAILBOX), 1)
+}
+
+func clearCore(core int) {
+	reg.Write(localMailbox(LOCAL_MAILBOX_CLR, core, WAKE_MAILBOX), 0xffffffff)
+}
@@ -54,7 +54,7 @@ func (msix *CapabilityMSIX) TableSize() int {
 // EnableInterrupt configures an MSI-X interrupt entry and enables the MSI-X
 // table.
 func (msix *CapabilityMSIX) EnableInterrupt(n int, addr uint64, data uint32) (err error) {
-	if n > msix.TableSize() || msix.device == nil {
+	if n >= msix.TableSize() || msix.device == nil {
 		return errors.New("invalid capabilty instance")
 	}
 
@@ -192,6 +192,11 @@ var (
 		Base: MIIM1_BASE,
 	}
 
+	// EL3 Secure Monitor Call dispatcher (see arm64.CPU.Boot)
+	Monitor = &arm64.Monitor{
+		SystemReset: Reset,
+	}
+
 	// One Time Programmable Controller
 	OTPC = &otpc.OTPC{
 		Base: OTPC_BASE,
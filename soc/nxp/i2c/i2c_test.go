@@ -0,0 +1,111 @@
+// NXP I2C driver
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build regsim
+
+package i2c
+
+import (
+	"testing"
+	"time"
+
+	"github.com/usbarmory/tamago/internal/reg"
+)
+
+const (
+	testBase = 0x021a0000
+	testCCGR = 0x020c4070
+)
+
+// testTarget simulates an I2C target which acknowledges only the first nak
+// transmitted bytes.
+func testTarget(t *testing.T, nak int) (hw *I2C, data *[]byte) {
+	data = &[]byte{}
+
+	reg.MMIO.Reset()
+	t.Cleanup(reg.MMIO.Reset)
+
+	// bus busy state follows master mode
+	reg.MMIO.OnWrite(testBase+I2Cx_I2CR, func(_ uint64, val uint64) uint64 {
+		sr := reg.MMIO.Peek(testBase + I2Cx_I2SR)
+
+		if (val>>I2CR_MSTA)&1 == 1 {
+			sr |= 1 << I2SR_IBB
+		} else {
+			sr &^= 1 << I2SR_IBB
+		}
+
+		reg.MMIO.Poke(testBase+I2Cx_I2SR, sr)
+
+		return val
+	})
+
+	// each transmitted byte completes a transfer with (N)ACK
+	reg.MMIO.OnWrite(testBase+I2Cx_I2DR, func(_ uint64, val uint64) uint64 {
+		*data = append(*data, byte(val))
+
+		sr := reg.MMIO.Peek(testBase+I2Cx_I2SR) | 1<<I2SR_IIF
+
+		if len(*data) > nak {
+			sr |= 1 << I2SR_RXAK
+		}
+
+		reg.MMIO.Poke(testBase+I2Cx_I2SR, sr)
+
+		return val
+	})
+
+	hw = &I2C{
+		Base:    testBase,
+		CCGR:    testCCGR,
+		CG:      6,
+		Timeout: 10 * time.Millisecond,
+	}
+
+	hw.Init()
+
+	return
+}
+
+func TestWrite(t *testing.T) {
+	hw, data := testTarget(t, 5)
+
+	if err := hw.Write([]byte{0xaa, 0xbb}, 0x50, 0x0102, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	if string(*data) != "\xa0\x01\x02\xaa\xbb" {
+		t.Errorf("unexpected transfer %x", *data)
+	}
+
+	if reg.GetN16(hw.i2cr, I2CR_MSTA, 1) != 0 {
+		t.Error("master mode not released")
+	}
+
+	if reg.Read16(hw.ifdr) != I2C_DEFAULT_IFDR {
+		t.Error("unexpected frequency divider")
+	}
+}
+
+func TestWriteNAK(t *testing.T) {
+	hw, data := testTarget(t, 1)
+
+	if err := hw.Write([]byte{0xaa}, 0x50, 0x01, 1); err == nil {
+		t.Fatal("missing acknowledgement error")
+	}
+
+	if len(*data) != 2 {
+		t.Errorf("unexpected transfer %x", *data)
+	}
+
+	for _, w := range reg.MMIO.Writes() {
+		if w.Addr == testCCGR && (w.Val>>hw.CG)&0b11 != 0b11 {
+			t.Error("clock gate not enabled")
+		}
+	}
+}
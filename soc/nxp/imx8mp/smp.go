@@ -0,0 +1,47 @@
+// NXP i.MX8MP multi-core support
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imx8mp
+
+import (
+	"github.com/usbarmory/tamago/arm64"
+)
+
+// Software Generated Interrupt used to wake up idle cores.
+const WAKE_SGI = 0
+
+// PSCI represents the Power State Coordination Interface client, implemented
+// by the Secure Monitor (e.g. TF-A BL31).
+var PSCI = &arm64.PSCI{}
+
+// SMP represents the i.MX8MP secondary Cortex-A53 cores control, based on
+// PSCI and GIC Software Generated Interrupts (SGIs), for Symmetric
+// Multiprocessing operation.
+//
+// Example:
+//
+//	imx8mp.ARM64.InitSMP(-1, imx8mp.SMP)
+var SMP = &arm64.SMP{
+	Start:  PSCI.Start,
+	Init:   initCore,
+	Signal: signalCore,
+	Clear:  clearCore,
+}
+
+func initCore(_ int) {
+	GIC.InitRedistributor()
+	GIC.EnableInterrupt(WAKE_SGI)
+}
+
+func signalCore(core int) {
+	GIC.SendSGI(WAKE_SGI, core)
+}
+
+func clearCore(_ int) {
+	GIC.ClearPending(WAKE_SGI)
+}
@@ -0,0 +1,210 @@
+// NXP i.MX boot image generation
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imximage
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// IVT represents an Image Vector Table
+// (8.7.1.1 Image Vector Table structure, IMX6ULLRM).
+type IVT struct {
+	Entry    uint32
+	DCD      uint32
+	BootData uint32
+	Self     uint32
+	CSF      uint32
+}
+
+// BootData represents the Boot Data structure
+// (8.7.1.2 Boot data structure, IMX6ULLRM).
+type BootData struct {
+	Start  uint32
+	Length uint32
+	Plugin uint32
+}
+
+// Image represents a bootable image.
+type Image struct {
+	IVT      IVT
+	BootData BootData
+	DCD      []byte
+
+	// Payload is the executable payload.
+	Payload []byte
+
+	// initial load region headers size
+	headerSize uint32
+	// IVT offset
+	offset uint32
+	// CSF size
+	csfSize uint32
+}
+
+func align(n uint32) uint32 {
+	return (n + alignment - 1) &^ (alignment - 1)
+}
+
+// Build creates a bootable image for a flat binary payload, loaded and
+// executed at the argument addresses.
+//
+// Following U-Boot `mkimage` layout the payload is preceded by the initial load
+// region, holding the IVT, Boot Data and DCD, and padded to a 4 kB boundary.
+// When the configuration defines a CSF size, the CSF pointer references the
+// area following the padded image, which is included in the Boot Data length.
+func (c *Config) Build(payload []byte, load uint32, entry uint32) (img *Image, err error) {
+	if c.LoadSize == 0 || c.Offset >= c.LoadSize {
+		return nil, errors.New("invalid boot device")
+	}
+
+	if load < c.LoadSize {
+		return nil, fmt.Errorf("load address (%#x) must exceed initial load size (%#x)", load, c.LoadSize)
+	}
+
+	img = &Image{
+		Payload:    payload,
+		headerSize: c.LoadSize - c.Offset,
+		offset:     c.Offset,
+		csfSize:    c.CSFSize,
+	}
+
+	if img.DCD, err = c.DCDBytes(); err != nil {
+		return nil, err
+	}
+
+	if size := IVT_SIZE + BOOT_DATA_SIZE + len(img.DCD); uint32(size) > img.headerSize {
+		return nil, fmt.Errorf("headers size (%d) exceeds initial load region (%d)", size, img.headerSize)
+	}
+
+	start := load - c.LoadSize
+	self := start + c.Offset
+	size := img.headerSize + align(uint32(len(payload)))
+
+	img.IVT = IVT{
+		Entry:    entry,
+		BootData: self + IVT_SIZE,
+		Self:     self,
+	}
+
+	if len(img.DCD) > 0 {
+		img.IVT.DCD = self + IVT_SIZE + BOOT_DATA_SIZE
+	}
+
+	img.BootData = BootData{
+		Start:  start,
+		Length: align(size + c.Offset),
+	}
+
+	if c.CSFSize > 0 {
+		img.IVT.CSF = start + img.BootData.Length
+		img.BootData.Length += c.CSFSize
+	}
+
+	return
+}
+
+// Header returns the initial load region, preceding the payload.
+func (img *Image) Header() []byte {
+	buf := make([]byte, 0, img.headerSize)
+
+	buf = append(buf, IVT_TAG, 0, IVT_SIZE, IVT_VERSION)
+	buf = binary.LittleEndian.AppendUint32(buf, img.IVT.Entry)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = binary.LittleEndian.AppendUint32(buf, img.IVT.DCD)
+	buf = binary.LittleEndian.AppendUint32(buf, img.IVT.BootData)
+	buf = binary.LittleEndian.AppendUint32(buf, img.IVT.Self)
+	buf = binary.LittleEndian.AppendUint32(buf, img.IVT.CSF)
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+
+	buf = binary.LittleEndian.AppendUint32(buf, img.BootData.Start)
+	buf = binary.LittleEndian.AppendUint32(buf, img.BootData.Length)
+	buf = binary.LittleEndian.AppendUint32(buf, img.BootData.Plugin)
+
+	buf = append(buf, img.DCD...)
+
+	return buf[:img.headerSize]
+}
+
+// Bytes returns the image encoding, meant to be written at the boot device
+// IVT offset. When csf is true the image is padded to include a zero-filled
+// CSF placeholder, to be replaced with the HAB signature.
+func (img *Image) Bytes(csf bool) []byte {
+	size := img.headerSize + align(uint32(len(img.Payload)))
+
+	if csf && img.csfSize > 0 {
+		size = img.IVT.CSF - img.IVT.Self + img.csfSize
+	}
+
+	buf := make([]byte, size)
+
+	copy(buf, img.Header())
+	copy(buf[img.headerSize:], img.Payload)
+
+	return buf
+}
+
+// HABBlocks returns the start address, file offset and length of the image
+// area to be authenticated by HAB, as required by the Code Signing Tool (CST)
+// `Blocks` parameter.
+func (img *Image) HABBlocks() (start uint32, offset uint32, length uint32) {
+	return img.IVT.Self, 0, img.BootData.Length - img.offset - img.csfSize
+}
+
+// ParseELF converts an ELF executable to a flat binary payload, spanning all
+// allocated sections, and returns it along with its load address and entry
+// point.
+func ParseELF(r io.ReaderAt) (payload []byte, load uint32, entry uint32, err error) {
+	f, err := elf.NewFile(r)
+
+	if err != nil {
+		return
+	}
+
+	if f.Class != elf.ELFCLASS32 {
+		return nil, 0, 0, errors.New("unsupported ELF class")
+	}
+
+	var start, end uint64
+	var sections []*elf.Section
+
+	for _, s := range f.Sections {
+		if s.Flags&elf.SHF_ALLOC == 0 || s.Size == 0 {
+			continue
+		}
+
+		if len(sections) == 0 || s.Addr < start {
+			start = s.Addr
+		}
+
+		end = max(end, s.Addr+s.Size)
+		sections = append(sections, s)
+	}
+
+	if len(sections) == 0 {
+		return nil, 0, 0, errors.New("no allocated sections")
+	}
+
+	payload = make([]byte, end-start)
+
+	for _, s := range sections {
+		if s.Type == elf.SHT_NOBITS {
+			continue
+		}
+
+		if _, err = s.ReadAt(payload[s.Addr-start:s.Addr-start+s.Size], 0); err != nil {
+			return nil, 0, 0, fmt.Errorf("could not read section %s, %v", s.Name, err)
+		}
+	}
+
+	return payload, uint32(start), uint32(f.Entry), nil
+}
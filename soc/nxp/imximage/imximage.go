@@ -0,0 +1,267 @@
+// NXP i.MX boot image generation
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package imximage implements the generation of NXP i.MX bootable images,
+// from `imximage.cfg` configuration files as supported by U-Boot `mkimage -T
+// imximage`, adopting the following reference specifications:
+//   - IMX6ULLRM - i.MX 6ULL Applications Processor Reference Manual - Rev 1 2017/11
+//
+// The generated images include the Image Vector Table (IVT), Boot Data and
+// Device Configuration Data (DCD) headers, followed by the executable payload
+// and optionally a placeholder for the Command Sequence File (CSF) required
+// for High Assurance Boot (HAB) signing.
+//
+// Unlike most tamago packages, this package is meant to be used on the build
+// host.
+package imximage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Image Vector Table and DCD constants
+// (8.7 Program image, IMX6ULLRM).
+const (
+	IVT_TAG     = 0xd1
+	IVT_VERSION = 0x40
+	IVT_SIZE    = 32
+
+	BOOT_DATA_SIZE = 12
+
+	DCD_TAG     = 0xd2
+	DCD_VERSION = 0x40
+	// maximum DCD size supported by the boot ROM
+	DCD_MAX_SIZE = 1768
+
+	DCD_WRITE = 0xcc
+	DCD_CHECK = 0xcf
+	DCD_NOP   = 0xc0
+
+	// DCD command parameter flags
+	DCD_MASK = 1 << 3
+	DCD_SET  = 1 << 4
+)
+
+// Boot image alignment
+const alignment = 4096
+
+// BootDevice represents the image offset and initial load region size for a
+// boot device.
+type BootDevice struct {
+	// Offset is the IVT offset within the boot device.
+	Offset uint32
+	// LoadSize is the size of the initial load region.
+	LoadSize uint32
+}
+
+// BootDevices lists the supported BOOT_FROM values.
+var BootDevices = map[string]BootDevice{
+	"onenand": {0x100, 0x400},
+	"nand":    {0x400, 0x1000},
+	"sd":      {0x400, 0x1000},
+	"spi":     {0x400, 0x1000},
+	"sata":    {0x400, 0x1000},
+}
+
+// Command represents a DCD command.
+type Command struct {
+	// Tag is the command tag (e.g. [DCD_WRITE]).
+	Tag uint8
+	// Param is the command parameter, combining the access width in
+	// bytes with flags (e.g. [DCD_MASK]).
+	Param uint8
+	// Args holds address/value pairs (write commands) or the address,
+	// mask and optional count (check commands).
+	Args []uint32
+}
+
+// Config represents a parsed `imximage.cfg` configuration file.
+type Config struct {
+	// Boot device name
+	BootFrom string
+	// Boot device parameters
+	BootDevice
+
+	// CSFSize is the size reserved for the Command Sequence File, a
+	// non-zero value enables HAB signing layout.
+	CSFSize uint32
+
+	// DCD commands
+	DCD []Command
+}
+
+var checkParams = map[string]uint8{
+	"CHECK_BITS_CLR":    0,
+	"CHECK_BITS_SET":    DCD_SET,
+	"CHECK_ANY_BIT_CLR": DCD_MASK,
+	"CHECK_ANY_BIT_SET": DCD_MASK | DCD_SET,
+}
+
+var writeParams = map[string]uint8{
+	"DATA":    0,
+	"CLR_BIT": DCD_MASK,
+	"SET_BIT": DCD_MASK | DCD_SET,
+}
+
+func parseUint32(s string) (uint32, error) {
+	val, err := strconv.ParseUint(s, 0, 32)
+	return uint32(val), err
+}
+
+// Parse parses an `imximage.cfg` configuration file. Only IMAGE_VERSION 2
+// configurations, without PLUGIN support, are supported.
+func Parse(r io.Reader) (c *Config, err error) {
+	var args []uint32
+
+	c = &Config{}
+	s := bufio.NewScanner(r)
+
+	for n := 1; s.Scan(); n++ {
+		line, _, _ := strings.Cut(s.Text(), "#")
+		fields := strings.Fields(line)
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		cmd := strings.ToUpper(fields[0])
+		fields = fields[1:]
+
+		if cmd != "BOOT_FROM" {
+			args = make([]uint32, len(fields))
+
+			for i, f := range fields {
+				if args[i], err = parseUint32(f); err != nil {
+					return nil, fmt.Errorf("line %d: invalid value %q", n, f)
+				}
+			}
+		}
+
+		switch {
+		case cmd == "IMAGE_VERSION":
+			if len(args) != 1 || args[0] != 2 {
+				return nil, fmt.Errorf("line %d: unsupported image version", n)
+			}
+		case cmd == "BOOT_FROM":
+			if len(fields) != 1 {
+				return nil, fmt.Errorf("line %d: invalid BOOT_FROM", n)
+			}
+
+			dev, ok := BootDevices[strings.ToLower(fields[0])]
+
+			if !ok {
+				return nil, fmt.Errorf("line %d: unsupported boot device %q", n, fields[0])
+			}
+
+			c.BootFrom = strings.ToLower(fields[0])
+			c.BootDevice = dev
+		case cmd == "CSF":
+			if len(args) != 1 {
+				return nil, fmt.Errorf("line %d: invalid CSF", n)
+			}
+
+			c.CSFSize = args[0]
+		case cmd == "NOP":
+			c.DCD = append(c.DCD, Command{Tag: DCD_NOP})
+		case writeParams[cmd] != 0 || cmd == "DATA":
+			if len(args) != 3 || (args[0] != 1 && args[0] != 2 && args[0] != 4) {
+				return nil, fmt.Errorf("line %d: invalid %s", n, cmd)
+			}
+
+			c.write(uint8(args[0])|writeParams[cmd], args[1], args[2])
+		case strings.HasPrefix(cmd, "CHECK_"):
+			param, ok := checkParams[cmd]
+
+			if !ok || len(args) < 3 || len(args) > 4 || (args[0] != 1 && args[0] != 2 && args[0] != 4) {
+				return nil, fmt.Errorf("line %d: invalid %s", n, cmd)
+			}
+
+			c.DCD = append(c.DCD, Command{
+				Tag:   DCD_CHECK,
+				Param: uint8(args[0]) | param,
+				Args:  args[1:],
+			})
+		default:
+			return nil, fmt.Errorf("line %d: unsupported command %q", n, cmd)
+		}
+	}
+
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	if c.BootFrom == "" {
+		return nil, errors.New("missing BOOT_FROM")
+	}
+
+	return
+}
+
+// write adds a write command, consecutive writes with identical parameters
+// are grouped in a single command.
+func (c *Config) write(param uint8, addr uint32, val uint32) {
+	if n := len(c.DCD); n > 0 {
+		last := &c.DCD[n-1]
+
+		if last.Tag == DCD_WRITE && last.Param == param {
+			last.Args = append(last.Args, addr, val)
+			return
+		}
+	}
+
+	c.DCD = append(c.DCD, Command{
+		Tag:   DCD_WRITE,
+		Param: param,
+		Args:  []uint32{addr, val},
+	})
+}
+
+// Bytes returns the command encoding.
+func (cmd *Command) Bytes() []byte {
+	buf := make([]byte, 4, 4+len(cmd.Args)*4)
+
+	buf[0] = cmd.Tag
+	binary.BigEndian.PutUint16(buf[1:3], uint16(cap(buf)))
+	buf[3] = cmd.Param
+
+	for _, arg := range cmd.Args {
+		buf = binary.BigEndian.AppendUint32(buf, arg)
+	}
+
+	return buf
+}
+
+// DCDBytes returns the Device Configuration Data table encoding, an empty
+// slice is returned when no DCD commands are present.
+func (c *Config) DCDBytes() (buf []byte, err error) {
+	if len(c.DCD) == 0 {
+		return
+	}
+
+	buf = make([]byte, 4)
+
+	for _, cmd := range c.DCD {
+		buf = append(buf, cmd.Bytes()...)
+	}
+
+	if len(buf) > DCD_MAX_SIZE {
+		return nil, fmt.Errorf("DCD size (%d) exceeds maximum (%d)", len(buf), DCD_MAX_SIZE)
+	}
+
+	buf[0] = DCD_TAG
+	binary.BigEndian.PutUint16(buf[1:3], uint16(len(buf)))
+	buf[3] = DCD_VERSION
+
+	return
+}
@@ -0,0 +1,96 @@
+// NXP i.MX boot image generation
+// https://github.com/usbarmory/tamago
+//
+// Copyright (c) The TamaGo Authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package imximage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+IMAGE_VERSION 2
+BOOT_FROM sd
+CSF 0x2000
+
+DATA 4 0x020c4068 0xffffffff  # CCM_CCGR0
+DATA 4 0x020c406c 0x0000ffff  # CCM_CCGR1
+CLR_BIT 4 0x020e0000 0x00000001
+CHECK_BITS_SET 4 0x021b0018 0x40000000
+`
+
+// header layout, matching U-Boot `mkimage -T imximage -e 0x80010000` output
+const testHeader = `
+d1002040 00000180 00000000 2cf40080 20f40080 00f40080 00200180 00000000
+00f00080 00500000 00000000
+d2003040
+cc001404 020c4068 ffffffff 020c406c 0000ffff
+cc000c0c 020e0000 00000001
+cf000c14 021b0018 40000000
+`
+
+func TestBuild(t *testing.T) {
+	c, err := Parse(strings.NewReader(testConfig))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := bytes.Repeat([]byte{0xaa}, 0x1800)
+	img, err := c.Build(payload, 0x80010000, 0x80010000)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hdr, _ := hex.DecodeString(strings.Join(strings.Fields(testHeader), ""))
+	buf := img.Bytes(false)
+
+	if !bytes.Equal(buf[:len(hdr)], hdr) {
+		t.Errorf("header mismatch\n%x\n%x", buf[:len(hdr)], hdr)
+	}
+
+	if len(buf) != 0x2c00 || !bytes.Equal(buf[0xc00:0x2400], payload) {
+		t.Errorf("invalid image layout")
+	}
+
+	if n := len(img.Bytes(true)); n != 0x4c00 {
+		t.Errorf("invalid CSF placeholder layout (%#x)", n)
+	}
+
+	if start, off, size := img.HABBlocks(); start != 0x8000f400 || off != 0 || size != 0x2c00 {
+		t.Errorf("invalid HAB blocks %#x %#x %#x", start, off, size)
+	}
+}
+
+func TestBoardConfig(t *testing.T) {
+	for _, name := range []string{
+		"../../../board/nxp/mx6ullevk/imximage.cfg",
+		"../../../board/usbarmory/mk2/imximage.cfg",
+	} {
+		f, err := os.Open(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		c, err := Parse(f)
+		f.Close()
+
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+
+		if _, err = c.Build(make([]byte, 0x100000), 0x80010000, 0x80010000); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
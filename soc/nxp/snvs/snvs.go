@@ -56,6 +56,10 @@ const (
 	SNVS_LPPGDR = 0x64
 	// Power Glitch Detector Register hardwired value
 	LPPGDR_PGD_VAL = 0x41736166
+
+	SNVS_LPGPR0 = 0x90
+	// General Purpose Registers count
+	LPGPR_NUM = 4
 )
 
 // System Security Monitor (SSM) states
@@ -113,6 +117,7 @@ type SNVS struct {
 	lptdcr   uint32
 	lpsr     uint32
 	lppgdr   uint32
+	lpgpr    uint32
 
 	// DryIce registers
 	dtocr uint32
@@ -187,6 +192,7 @@ func (hw *SNVS) Init(calibrationData uint32) {
 	hw.lptdcr = hw.Base + SNVS_LPTDCR
 	hw.lpsr = hw.Base + SNVS_LPSR
 	hw.lppgdr = hw.Base + SNVS_LPPGDR
+	hw.lpgpr = hw.Base + SNVS_LPGPR0
 
 	if hw.DryIce > 0 {
 		hw.initDryIce(calibrationData)
@@ -298,3 +304,23 @@ func (hw *SNVS) Available() bool {
 		return false
 	}
 }
+
+// ReadGPR returns the value of the argument LP General Purpose Register, such
+// registers retain their content across system resets as long as the SNVS is
+// powered.
+func (hw *SNVS) ReadGPR(n int) uint32 {
+	if n < 0 || n >= LPGPR_NUM {
+		return 0
+	}
+
+	return reg.Read(hw.lpgpr + uint32(n*4))
+}
+
+// WriteGPR sets the value of the argument LP General Purpose Register.
+func (hw *SNVS) WriteGPR(n int, val uint32) {
+	if n < 0 || n >= LPGPR_NUM {
+		return
+	}
+
+	reg.Write(hw.lpgpr+uint32(n*4), val)
+}